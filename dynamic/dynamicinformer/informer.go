@@ -25,6 +25,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamiclister"
@@ -64,6 +65,7 @@ type dynamicSharedInformerFactory struct {
 }
 
 var _ DynamicSharedInformerFactory = &dynamicSharedInformerFactory{}
+var _ DynamicSharedInformerFactoryWithContext = &dynamicSharedInformerFactory{}
 
 func (f *dynamicSharedInformerFactory) ForResource(gvr schema.GroupVersionResource) informers.GenericInformer {
 	f.lock.Lock()
@@ -83,12 +85,30 @@ func (f *dynamicSharedInformerFactory) ForResource(gvr schema.GroupVersionResour
 
 // Start initializes all requested informers.
 func (f *dynamicSharedInformerFactory) Start(stopCh <-chan struct{}) {
+	f.start(func(informer cache.SharedIndexInformer) {
+		informer.Run(stopCh)
+	})
+}
+
+// StartWithContext initializes all requested informers, which run until ctx
+// is done.
+func (f *dynamicSharedInformerFactory) StartWithContext(ctx context.Context) {
+	f.start(func(informer cache.SharedIndexInformer) {
+		if informer, ok := informer.(cache.SharedInformerWithContext); ok {
+			informer.RunWithContext(ctx)
+		} else {
+			informer.Run(ctx.Done())
+		}
+	})
+}
+
+func (f *dynamicSharedInformerFactory) start(run func(cache.SharedIndexInformer)) {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
 	for informerType, informer := range f.informers {
 		if !f.startedInformers[informerType] {
-			go informer.Informer().Run(stopCh)
+			go run(informer.Informer())
 			f.startedInformers[informerType] = true
 		}
 	}
@@ -96,6 +116,14 @@ func (f *dynamicSharedInformerFactory) Start(stopCh <-chan struct{}) {
 
 // WaitForCacheSync waits for all started informers' cache were synced.
 func (f *dynamicSharedInformerFactory) WaitForCacheSync(stopCh <-chan struct{}) map[schema.GroupVersionResource]bool {
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	return f.WaitForCacheSyncWithContext(ctx)
+}
+
+// WaitForCacheSyncWithContext waits for all started informers' cache were
+// synced, or until ctx is done.
+func (f *dynamicSharedInformerFactory) WaitForCacheSyncWithContext(ctx context.Context) map[schema.GroupVersionResource]bool {
 	informers := func() map[schema.GroupVersionResource]cache.SharedIndexInformer {
 		f.lock.Lock()
 		defer f.lock.Unlock()
@@ -111,7 +139,7 @@ func (f *dynamicSharedInformerFactory) WaitForCacheSync(stopCh <-chan struct{})
 
 	res := map[schema.GroupVersionResource]bool{}
 	for informType, informer := range informers {
-		res[informType] = cache.WaitForCacheSync(stopCh, informer.HasSynced)
+		res[informType] = cache.WaitForCacheSyncWithContext(ctx, informer.HasSynced)
 	}
 	return res
 }
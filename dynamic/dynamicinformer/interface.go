@@ -17,6 +17,8 @@ limitations under the License.
 package dynamicinformer
 
 import (
+	"context"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/informers"
@@ -29,6 +31,16 @@ type DynamicSharedInformerFactory interface {
 	WaitForCacheSync(stopCh <-chan struct{}) map[schema.GroupVersionResource]bool
 }
 
+// DynamicSharedInformerFactoryWithContext is a DynamicSharedInformerFactory which can also be used with
+// a context. The factories of this package implement it, but it is not part
+// of DynamicSharedInformerFactory so that other implementations keep working; use a
+// type assertion to check for it.
+type DynamicSharedInformerFactoryWithContext interface {
+	DynamicSharedInformerFactory
+	StartWithContext(ctx context.Context)
+	WaitForCacheSyncWithContext(ctx context.Context) map[schema.GroupVersionResource]bool
+}
+
 // TweakListOptionsFunc defines the signature of a helper function
 // that wants to provide more listing options to API
 type TweakListOptionsFunc func(*metav1.ListOptions)
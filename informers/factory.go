@@ -19,6 +19,7 @@ limitations under the License.
 package informers
 
 import (
+	context "context"
 	reflect "reflect"
 	sync "sync"
 	time "time"
@@ -26,6 +27,7 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	wait "k8s.io/apimachinery/pkg/util/wait"
 	admissionregistration "k8s.io/client-go/informers/admissionregistration"
 	apiserverinternal "k8s.io/client-go/informers/apiserverinternal"
 	apps "k8s.io/client-go/informers/apps"
@@ -131,6 +133,22 @@ func NewSharedInformerFactoryWithOptions(client kubernetes.Interface, defaultRes
 }
 
 func (f *sharedInformerFactory) Start(stopCh <-chan struct{}) {
+	f.start(func(informer cache.SharedIndexInformer) {
+		informer.Run(stopCh)
+	})
+}
+
+func (f *sharedInformerFactory) StartWithContext(ctx context.Context) {
+	f.start(func(informer cache.SharedIndexInformer) {
+		if informer, ok := informer.(cache.SharedInformerWithContext); ok {
+			informer.RunWithContext(ctx)
+		} else {
+			informer.Run(ctx.Done())
+		}
+	})
+}
+
+func (f *sharedInformerFactory) start(run func(cache.SharedIndexInformer)) {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
@@ -147,7 +165,7 @@ func (f *sharedInformerFactory) Start(stopCh <-chan struct{}) {
 			informer := informer
 			go func() {
 				defer f.wg.Done()
-				informer.Run(stopCh)
+				run(informer)
 			}()
 			f.startedInformers[informerType] = true
 		}
@@ -164,6 +182,12 @@ func (f *sharedInformerFactory) Shutdown() {
 }
 
 func (f *sharedInformerFactory) WaitForCacheSync(stopCh <-chan struct{}) map[reflect.Type]bool {
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	return f.WaitForCacheSyncWithContext(ctx)
+}
+
+func (f *sharedInformerFactory) WaitForCacheSyncWithContext(ctx context.Context) map[reflect.Type]bool {
 	informers := func() map[reflect.Type]cache.SharedIndexInformer {
 		f.lock.Lock()
 		defer f.lock.Unlock()
@@ -179,7 +203,7 @@ func (f *sharedInformerFactory) WaitForCacheSync(stopCh <-chan struct{}) map[ref
 
 	res := map[reflect.Type]bool{}
 	for informType, informer := range informers {
-		res[informType] = cache.WaitForCacheSync(stopCh, informer.HasSynced)
+		res[informType] = cache.WaitForCacheSyncWithContext(ctx, informer.HasSynced)
 	}
 	return res
 }
@@ -207,6 +231,25 @@ func (f *sharedInformerFactory) InformerFor(obj runtime.Object, newFunc internal
 	return informer
 }
 
+// SharedInformerFactoryWithContext is a SharedInformerFactory which can also
+// be used with a context. The factories of this package implement it, but it
+// is not part of SharedInformerFactory so that other implementations keep
+// working; use a type assertion to check for it.
+type SharedInformerFactoryWithContext interface {
+	SharedInformerFactory
+
+	// StartWithContext initializes all requested informers. They are handled in
+	// goroutines which run until the context is done, and log through the
+	// logger of the context.
+	StartWithContext(ctx context.Context)
+
+	// WaitForCacheSyncWithContext blocks until all started informers' caches
+	// were synced or the context is done.
+	WaitForCacheSyncWithContext(ctx context.Context) map[reflect.Type]bool
+}
+
+var _ SharedInformerFactoryWithContext = &sharedInformerFactory{}
+
 // SharedInformerFactory provides shared informers for resources in all known
 // API group versions.
 //
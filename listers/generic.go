@@ -0,0 +1,118 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package listers provides typed listers for any type stored in a
+// cache.Indexer, without the need for generated code. The generated listers
+// of the built-in types live in the subpackages.
+package listers
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Lister helps list and get objects of type T.
+// All objects returned here must be treated as read-only.
+type Lister[T runtime.Object] interface {
+	// List lists all objects in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []T, err error)
+	// Get retrieves a cluster-scoped object from the indexer by name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (T, error)
+	// ByNamespace returns an object that can list and get objects in the
+	// given namespace.
+	ByNamespace(namespace string) NamespaceLister[T]
+}
+
+// NamespaceLister helps list and get objects of type T in a namespace.
+// All objects returned here must be treated as read-only.
+type NamespaceLister[T runtime.Object] interface {
+	// List lists all objects in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []T, err error)
+	// Get retrieves the object from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (T, error)
+}
+
+// lister implements the Lister interface.
+type lister[T runtime.Object] struct {
+	indexer  cache.Indexer
+	resource schema.GroupResource
+}
+
+// New returns a Lister for the objects of type T in indexer, which must be
+// keyed by cache.MetaNamespaceKeyFunc like the indexers of informers are.
+// resource is used for the NotFound errors returned by Get, e.g.
+// schema.GroupResource{Group: "example.com", Resource: "widgets"}.
+func New[T runtime.Object](indexer cache.Indexer, resource schema.GroupResource) Lister[T] {
+	return &lister[T]{indexer: indexer, resource: resource}
+}
+
+// List lists all objects in the indexer.
+func (s *lister[T]) List(selector labels.Selector) (ret []T, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(T))
+	})
+	return ret, err
+}
+
+// Get retrieves a cluster-scoped object from the indexer by name.
+func (s *lister[T]) Get(name string) (T, error) {
+	return get[T](s.indexer, s.resource, name, name)
+}
+
+// ByNamespace returns an object that can list and get objects in the given
+// namespace.
+func (s *lister[T]) ByNamespace(namespace string) NamespaceLister[T] {
+	return namespaceLister[T]{indexer: s.indexer, resource: s.resource, namespace: namespace}
+}
+
+// namespaceLister implements the NamespaceLister interface.
+type namespaceLister[T runtime.Object] struct {
+	indexer   cache.Indexer
+	resource  schema.GroupResource
+	namespace string
+}
+
+// List lists all objects in the indexer for a given namespace.
+func (s namespaceLister[T]) List(selector labels.Selector) (ret []T, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(T))
+	})
+	return ret, err
+}
+
+// Get retrieves the object from the indexer for a given namespace and name.
+func (s namespaceLister[T]) Get(name string) (T, error) {
+	return get[T](s.indexer, s.resource, s.namespace+"/"+name, name)
+}
+
+func get[T runtime.Object](indexer cache.Indexer, resource schema.GroupResource, key, name string) (T, error) {
+	var zero T
+	obj, exists, err := indexer.GetByKey(key)
+	if err != nil {
+		return zero, err
+	}
+	if !exists {
+		return zero, errors.NewNotFound(resource, name)
+	}
+	return obj.(T), nil
+}
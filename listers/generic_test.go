@@ -0,0 +1,124 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package listers
+
+import (
+	"sort"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestIndexer(t *testing.T, objs ...interface{}) cache.Indexer {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, obj := range objs {
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return indexer
+}
+
+func names[T interface{ GetName() string }](objs []T) []string {
+	ret := []string{}
+	for _, obj := range objs {
+		ret = append(ret, obj.GetName())
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestNamespacedLister(t *testing.T) {
+	pod := func(namespace, name string, labels map[string]string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels}}
+	}
+	indexer := newTestIndexer(t,
+		pod("ns1", "a", map[string]string{"app": "web"}),
+		pod("ns1", "b", nil),
+		pod("ns2", "c", map[string]string{"app": "web"}),
+	)
+	lister := New[*v1.Pod](indexer, v1.Resource("pods"))
+
+	all, err := lister.List(labels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(all); len(got) != 3 {
+		t.Errorf("expected 3 pods, got %v", got)
+	}
+	web, err := lister.List(labels.SelectorFromSet(labels.Set{"app": "web"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(web); len(got) != 2 || got[0] != "a" || got[1] != "c" {
+		t.Errorf("expected pods a and c, got %v", got)
+	}
+
+	ns1, err := lister.ByNamespace("ns1").List(labels.Everything())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(ns1); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("expected pods a and b, got %v", got)
+	}
+
+	got, err := lister.ByNamespace("ns2").Get("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Namespace != "ns2" || got.Name != "c" {
+		t.Errorf("unexpected pod %s/%s", got.Namespace, got.Name)
+	}
+
+	_, err = lister.ByNamespace("ns2").Get("a")
+	if !errors.IsNotFound(err) {
+		t.Fatalf("expected NotFound error, got %v", err)
+	}
+	if status := err.(errors.APIStatus).Status(); status.Details.Kind != "pods" || status.Details.Name != "a" {
+		t.Errorf("unexpected NotFound details %#v", status.Details)
+	}
+}
+
+func TestClusterScopedLister(t *testing.T) {
+	widgetResource := schema.GroupResource{Group: "example.com", Resource: "widgets"}
+	widget := &unstructured.Unstructured{}
+	widget.SetAPIVersion("example.com/v1")
+	widget.SetKind("Widget")
+	widget.SetName("w")
+	lister := New[*unstructured.Unstructured](newTestIndexer(t, widget), widgetResource)
+
+	got, err := lister.Get("w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != widget {
+		t.Errorf("expected the indexed object to be returned")
+	}
+	_, err = lister.Get("missing")
+	if !errors.IsNotFound(err) {
+		t.Fatalf("expected NotFound error, got %v", err)
+	}
+	if status := err.(errors.APIStatus).Status(); status.Details.Group != "example.com" || status.Details.Kind != "widgets" {
+		t.Errorf("unexpected NotFound details %#v", status.Details)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/metadata"
@@ -63,6 +64,7 @@ type metadataSharedInformerFactory struct {
 }
 
 var _ SharedInformerFactory = &metadataSharedInformerFactory{}
+var _ SharedInformerFactoryWithContext = &metadataSharedInformerFactory{}
 
 func (f *metadataSharedInformerFactory) ForResource(gvr schema.GroupVersionResource) informers.GenericInformer {
 	f.lock.Lock()
@@ -82,12 +84,30 @@ func (f *metadataSharedInformerFactory) ForResource(gvr schema.GroupVersionResou
 
 // Start initializes all requested informers.
 func (f *metadataSharedInformerFactory) Start(stopCh <-chan struct{}) {
+	f.start(func(informer cache.SharedIndexInformer) {
+		informer.Run(stopCh)
+	})
+}
+
+// StartWithContext initializes all requested informers, which run until ctx
+// is done.
+func (f *metadataSharedInformerFactory) StartWithContext(ctx context.Context) {
+	f.start(func(informer cache.SharedIndexInformer) {
+		if informer, ok := informer.(cache.SharedInformerWithContext); ok {
+			informer.RunWithContext(ctx)
+		} else {
+			informer.Run(ctx.Done())
+		}
+	})
+}
+
+func (f *metadataSharedInformerFactory) start(run func(cache.SharedIndexInformer)) {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
 	for informerType, informer := range f.informers {
 		if !f.startedInformers[informerType] {
-			go informer.Informer().Run(stopCh)
+			go run(informer.Informer())
 			f.startedInformers[informerType] = true
 		}
 	}
@@ -95,6 +115,14 @@ func (f *metadataSharedInformerFactory) Start(stopCh <-chan struct{}) {
 
 // WaitForCacheSync waits for all started informers' cache were synced.
 func (f *metadataSharedInformerFactory) WaitForCacheSync(stopCh <-chan struct{}) map[schema.GroupVersionResource]bool {
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	return f.WaitForCacheSyncWithContext(ctx)
+}
+
+// WaitForCacheSyncWithContext waits for all started informers' cache were
+// synced, or until ctx is done.
+func (f *metadataSharedInformerFactory) WaitForCacheSyncWithContext(ctx context.Context) map[schema.GroupVersionResource]bool {
 	informers := func() map[schema.GroupVersionResource]cache.SharedIndexInformer {
 		f.lock.Lock()
 		defer f.lock.Unlock()
@@ -110,7 +138,7 @@ func (f *metadataSharedInformerFactory) WaitForCacheSync(stopCh <-chan struct{})
 
 	res := map[schema.GroupVersionResource]bool{}
 	for informType, informer := range informers {
-		res[informType] = cache.WaitForCacheSync(stopCh, informer.HasSynced)
+		res[informType] = cache.WaitForCacheSyncWithContext(ctx, informer.HasSynced)
 	}
 	return res
 }
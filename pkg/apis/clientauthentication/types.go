@@ -98,6 +98,11 @@ type Cluster struct {
 	// cluster.
 	// +optional
 	ProxyURL string
+	// TLSPins are pins of the certificate or the public key of the server, at least
+	// one of which must match.
+	// +listType=atomic
+	// +optional
+	TLSPins []string
 	// DisableCompression allows client to opt-out of response compression for all requests to the server. This is useful
 	// to speed up requests (specifically lists) when client-server network bandwidth is ample, by saving time on
 	// compression (server-side) and decompression (client-side): https://github.com/kubernetes/kubernetes/issues/112296.
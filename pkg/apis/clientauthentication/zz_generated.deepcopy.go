@@ -33,6 +33,11 @@ func (in *Cluster) DeepCopyInto(out *Cluster) {
 		*out = make([]byte, len(*in))
 		copy(*out, *in)
 	}
+	if in.TLSPins != nil {
+		in, out := &in.TLSPins, &out.TLSPins
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Config != nil {
 		out.Config = in.Config.DeepCopyObject()
 	}
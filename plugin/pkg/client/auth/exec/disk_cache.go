@@ -0,0 +1,235 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/pkg/apis/clientauthentication"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/homedir"
+	"k8s.io/klog/v2"
+)
+
+// credentialCacheDir is the directory the credentials of plugins with
+// CacheCredentials are stored in.
+var credentialCacheDir = filepath.Join(homedir.HomeDir(), ".kube", "cache", "exec-credentials")
+
+// diskCache stores the output of a plugin on disk, so that processes using
+// the same plugin for the same cluster share its credentials. Processes
+// serialize access to an entry by locking a file next to it, which is
+// removed along with the entry.
+type diskCache struct {
+	path string
+}
+
+// credentialEnv are the variables of the inherited environment which are
+// known to select the credentials plugins return. Other variables, many of
+// which differ between terminal sessions, don't keep processes from sharing
+// credentials.
+var credentialEnv = sets.NewString(
+	"HOME",
+	"KUBECONFIG",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+	"AWS_CONFIG_FILE",
+	"AWS_SHARED_CREDENTIALS_FILE",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_ROLE_ARN",
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+	"CLOUDSDK_CONFIG",
+	"CLOUDSDK_ACTIVE_CONFIG_NAME",
+	"CLOUDSDK_CORE_ACCOUNT",
+	"CLOUDSDK_CORE_PROJECT",
+	"GOOGLE_APPLICATION_CREDENTIALS",
+	"AZURE_CONFIG_DIR",
+	"AZURE_CLIENT_ID",
+	"AZURE_TENANT_ID",
+	"AZURE_FEDERATED_TOKEN_FILE",
+)
+
+// newDiskCache returns the cache entry of the plugin for the cluster. Besides
+// the config, which includes the environment set for the plugin, the key
+// holds the variables of credentialEnv which the plugin inherits.
+func newDiskCache(config *api.ExecConfig, cluster *clientauthentication.Cluster, environ []string) *diskCache {
+	// How the plugin interacts with the user doesn't change its credentials.
+	conf := *config
+	conf.InstallHint = ""
+	conf.InteractiveMode = ""
+	conf.StdinUnavailable = false
+	conf.StdinUnavailableMessage = ""
+
+	var env []string
+	for _, kv := range environ {
+		if name, _, _ := strings.Cut(kv, "="); credentialEnv.Has(name) {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+
+	key := struct {
+		conf          *api.ExecConfig
+		env           []string
+		server        string
+		tlsServerName string
+		config        runtime.Object
+	}{conf: &conf, env: env}
+	if cluster != nil {
+		key.server = cluster.Server
+		key.tlsServerName = cluster.TLSServerName
+		key.config = cluster.Config
+	}
+	sum := sha256.Sum256([]byte(spewConfig.Sprint(key)))
+	return &diskCache{path: filepath.Join(credentialCacheDir, hex.EncodeToString(sum[:]))}
+}
+
+// lock blocks until the process holds the lock of the entry and returns
+// the function releasing it. Releasing the lock of an entry without data
+// removes the lock file.
+func (c *diskCache) lock() (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return nil, err
+	}
+	for {
+		f, err := os.OpenFile(c.path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		// The lock file may have been removed by the previous holder
+		// while this process waited for it.
+		if locked, err := f.Stat(); err == nil {
+			if current, err := os.Stat(f.Name()); err == nil && os.SameFile(locked, current) {
+				return func() { c.unlock(f) }, nil
+			}
+		}
+		c.unlock(f)
+	}
+}
+
+func (c *diskCache) unlock(f *os.File) {
+	if _, err := os.Stat(c.path); os.IsNotExist(err) {
+		// Removing the lock file may fail on Windows, where it is open.
+		if err := os.Remove(f.Name()); err != nil && !os.IsNotExist(err) {
+			klog.V(5).Infof("exec plugin: failed to remove %s: %v", f.Name(), err)
+		}
+	}
+	if err := unlockFile(f); err != nil {
+		klog.V(2).Infof("exec plugin: failed to unlock %s: %v", f.Name(), err)
+	}
+	f.Close()
+}
+
+// read returns the cached plugin output, or nil if there is none.
+func (c *diskCache) read() ([]byte, error) {
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// write replaces the cached plugin output. The entry is replaced
+// atomically, so that it is never read partially written.
+func (c *diskCache) write(data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), c.path)
+}
+
+// invalidate removes the entry if it still holds data, so that credentials
+// rejected by the server are not used by other processes. Newer credentials
+// cached by another process are kept.
+func (c *diskCache) invalidate(data []byte) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	cached, err := c.read()
+	if err != nil || !bytes.Equal(cached, data) {
+		return err
+	}
+	return c.remove()
+}
+
+// remove removes the data of the entry.
+func (c *diskCache) remove() error {
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// loadCachedCredsLocked uses the credentials cached on disk unless they
+// expired and returns whether it did. Credentials without an expiration
+// timestamp are never cached on disk. It must be called while holding the
+// Authenticator's mutex and the lock of the disk cache.
+func (a *Authenticator) loadCachedCredsLocked() bool {
+	data, err := a.diskCache.read()
+	if err != nil {
+		klog.V(2).Infof("exec plugin: failed to read cached credentials: %v", err)
+		return false
+	}
+	if data == nil {
+		return false
+	}
+	creds, exp, err := a.parseCredsLocked(data)
+	if err == nil && (exp.IsZero() || a.now().After(exp)) {
+		err = fmt.Errorf("expired at %v", exp)
+	}
+	if err != nil {
+		// Entries are removed once they can't be used, so that they
+		// don't accumulate.
+		klog.V(2).Infof("exec plugin: removing unusable cached credentials: %v", err)
+		if err := a.diskCache.remove(); err != nil {
+			klog.V(2).Infof("exec plugin: failed to remove cached credentials: %v", err)
+		}
+		return false
+	}
+	a.setCredsLocked(creds, exp, data)
+	return true
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package exec
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/pkg/apis/clientauthentication"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/transport"
+)
+
+func TestDiskCacheKey(t *testing.T) {
+	config := func() *api.ExecConfig {
+		return &api.ExecConfig{
+			Command:          "./testdata/test-plugin.sh",
+			Args:             []string{"get-token"},
+			APIVersion:       "client.authentication.k8s.io/v1",
+			InteractiveMode:  api.IfAvailableExecInteractiveMode,
+			CacheCredentials: true,
+		}
+	}
+	cluster := &clientauthentication.Cluster{Server: "https://cluster-a", CertificateAuthorityData: []byte("ca")}
+	env := []string{"HOME=/home/user", "PWD=/home/user", "SSH_CONNECTION=10.0.0.1 52113 10.0.0.2 22", "AWS_PROFILE=dev"}
+	path := newDiskCache(config(), cluster, env).path
+
+	interactive := config()
+	interactive.InteractiveMode = api.AlwaysExecInteractiveMode
+	interactive.StdinUnavailable = true
+	if got := newDiskCache(interactive, cluster, env).path; got != path {
+		t.Errorf("expected the interactive mode not to change the key")
+	}
+	rotatedCA := &clientauthentication.Cluster{Server: "https://cluster-a", CertificateAuthorityData: []byte("new-ca")}
+	if got := newDiskCache(config(), rotatedCA, env).path; got != path {
+		t.Errorf("expected the certificate authority not to change the key")
+	}
+	otherCluster := &clientauthentication.Cluster{Server: "https://cluster-b"}
+	if got := newDiskCache(config(), otherCluster, env).path; got == path {
+		t.Errorf("expected clusters to have different keys")
+	}
+	otherArgs := config()
+	otherArgs.Args = []string{"get-token", "--role=admin"}
+	if got := newDiskCache(otherArgs, cluster, env).path; got == path {
+		t.Errorf("expected plugin configs to have different keys")
+	}
+	otherSession := []string{"AWS_PROFILE=dev", "TERM_SESSION_ID=w0t0p0", "PWD=/tmp", "HOME=/home/user"}
+	if got := newDiskCache(config(), cluster, otherSession).path; got != path {
+		t.Errorf("expected variables of terminal sessions and the order of the environment not to change the key")
+	}
+	otherProfile := []string{"HOME=/home/user", "PWD=/home/user", "AWS_PROFILE=prod"}
+	if got := newDiskCache(config(), cluster, otherProfile).path; got == path {
+		t.Errorf("expected credential selecting variables to change the key")
+	}
+	otherEnv := config()
+	otherEnv.Env = []api.ExecEnvVar{{Name: "ROLE", Value: "admin"}}
+	if got := newDiskCache(otherEnv, cluster, env).path; got == path {
+		t.Errorf("expected the environment of the plugin to change the key")
+	}
+}
+
+func TestDiskCacheLockFileRemoval(t *testing.T) {
+	defer func(dir string) { credentialCacheDir = dir }(credentialCacheDir)
+	credentialCacheDir = t.TempDir()
+	c := newDiskCache(&api.ExecConfig{Command: "plugin"}, nil, nil)
+
+	unlock, err := c.lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan func())
+	go func() {
+		unlock, err := c.lock()
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+	// Wait for the other holder to open the lock file.
+	time.Sleep(100 * time.Millisecond)
+	// Releasing the lock of the entry without data removes the lock file,
+	// the other holder locks a new one.
+	unlock()
+	unlock = <-locked
+	if _, err := os.Stat(c.path + ".lock"); err != nil {
+		t.Errorf("expected the lock file to be recreated by the next holder: %v", err)
+	}
+	if err := c.write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if _, err := os.Stat(c.path + ".lock"); err != nil {
+		t.Errorf("expected the lock file of an entry with data to be kept: %v", err)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	defer func(dir string) { credentialCacheDir = dir }(credentialCacheDir)
+	credentialCacheDir = t.TempDir()
+
+	n := time.Now()
+	output := ""
+	cluster := &clientauthentication.Cluster{Server: "https://cluster"}
+	// newProcess returns an Authenticator not sharing memory with the
+	// others, as if it was running in another process.
+	newProcess := func(t *testing.T) *Authenticator {
+		t.Helper()
+		c := &api.ExecConfig{
+			Command:          "./testdata/test-plugin.sh",
+			APIVersion:       "client.authentication.k8s.io/v1",
+			InteractiveMode:  api.IfAvailableExecInteractiveMode,
+			CacheCredentials: true,
+		}
+		a, err := newAuthenticator(newCache(), func(_ int) bool { return false }, c, cluster)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.environ = func() []string { return []string{"TEST_OUTPUT=" + output} }
+		a.now = func() time.Time { return n }
+		a.stderr = io.Discard
+		return a
+	}
+	setToken := func(token string, exp time.Time) {
+		expiration := ""
+		if !exp.IsZero() {
+			expiration = fmt.Sprintf(`, "expirationTimestamp": %q`, exp.Format(time.RFC3339Nano))
+		}
+		output = fmt.Sprintf(`{
+			"kind": "ExecCredential",
+			"apiVersion": "client.authentication.k8s.io/v1",
+			"status": {"token": %q%s}
+		}`, token, expiration)
+	}
+	wantToken := func(t *testing.T, a *Authenticator, want string) {
+		t.Helper()
+		creds, err := a.getCreds()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if creds.token != want {
+			t.Errorf("expected token %q, got %q", want, creds.token)
+		}
+	}
+
+	setToken("token1", n.Add(time.Hour))
+	wantToken(t, newProcess(t), "token1")
+
+	info, err := os.Stat(newProcess(t).diskCache.path)
+	if err != nil {
+		t.Fatalf("expected the credentials to be cached: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("expected the cached credentials to be only accessible by the user, got %v", info.Mode())
+	}
+
+	// Other processes use the cached credentials rather than run the plugin.
+	setToken("token2", n.Add(time.Hour))
+	wantToken(t, newProcess(t), "token1")
+
+	// Expired credentials are not used.
+	n = n.Add(2 * time.Hour)
+	setToken("token3", time.Time{})
+	p := newProcess(t)
+	wantToken(t, p, "token3")
+	// Credentials without an expiration timestamp are not cached, and the
+	// expired entry is removed.
+	if data, err := p.diskCache.read(); err != nil || data != nil {
+		t.Errorf("expected credentials without an expiration timestamp not to be cached, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(p.diskCache.path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("expected the lock file of the removed entry to be removed, got %v", err)
+	}
+	setToken("token4", n.Add(time.Hour))
+	wantToken(t, newProcess(t), "token4")
+	wantToken(t, newProcess(t), "token4")
+
+	// Credentials rejected by the server are removed from the cache.
+	accepted := "token5"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer "+accepted {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+	a := newProcess(t)
+	tc := &transport.Config{}
+	if err := a.UpdateTransportConfig(tc); err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: tc.WrapTransport(http.DefaultTransport)}
+	get := func(t *testing.T, statusCode int) {
+		t.Helper()
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != statusCode {
+			t.Errorf("wanted status %d got %d", statusCode, resp.StatusCode)
+		}
+	}
+	setToken("token5", n.Add(time.Hour))
+	get(t, http.StatusUnauthorized)
+	get(t, http.StatusOK)
+	wantToken(t, newProcess(t), "token5")
+
+	// Credentials refreshed by another process in the meantime are kept.
+	b := newProcess(t)
+	wantToken(t, b, "token5")
+	accepted = "token6"
+	setToken("token6", n.Add(time.Hour))
+	get(t, http.StatusUnauthorized)
+	setToken("token7", n.Add(time.Hour))
+	if err := b.maybeRefreshCreds(b.cachedCreds); err != nil {
+		t.Fatal(err)
+	}
+	wantToken(t, b, "token6")
+}
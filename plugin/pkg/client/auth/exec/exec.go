@@ -211,6 +211,10 @@ func newAuthenticator(c *cache, isTerminalFunc func(int) bool, config *api.ExecC
 	a.getCert = &transport.GetCertHolder{GetCert: a.cert}
 	a.dial = &transport.DialHolder{Dial: defaultDialer.DialContext}
 
+	if config.CacheCredentials {
+		a.diskCache = newDiskCache(config, cluster, a.environ())
+	}
+
 	return c.put(key, a), nil
 }
 
@@ -275,6 +279,11 @@ type Authenticator struct {
 	mu          sync.Mutex
 	cachedCreds *credentials
 	exp         time.Time
+	// cachedOutput is the plugin output cachedCreds were parsed from.
+	cachedOutput []byte
+
+	// diskCache shares the credentials with other processes, if enabled.
+	diskCache *diskCache
 
 	// getCert makes Authenticator.cert comparable to support TLS config caching
 	getCert *transport.GetCertHolder
@@ -407,15 +416,56 @@ func (a *Authenticator) maybeRefreshCreds(creds *credentials) error {
 		return nil
 	}
 
+	if a.diskCache != nil {
+		if err := a.diskCache.invalidate(a.cachedOutput); err != nil {
+			klog.V(2).Infof("exec plugin: failed to invalidate cached credentials: %v", err)
+		}
+	}
 	return a.refreshCredsLocked()
 }
 
 // refreshCredsLocked executes the plugin and reads the credentials from
-// stdout. It must be called while holding the Authenticator's mutex.
+// stdout, unless credentials cached on disk can be used. It must be called
+// while holding the Authenticator's mutex.
 func (a *Authenticator) refreshCredsLocked() error {
+	if a.diskCache != nil {
+		// Holding the lock while the plugin runs makes other processes wait
+		// for its credentials rather than run the plugin as well.
+		unlock, err := a.diskCache.lock()
+		if err != nil {
+			klog.V(2).Infof("exec plugin: failed to lock the credential cache: %v", err)
+		} else {
+			defer unlock()
+			if a.loadCachedCredsLocked() {
+				return nil
+			}
+		}
+	}
+
+	output, err := a.runPluginLocked()
+	if err != nil {
+		return err
+	}
+	creds, exp, err := a.parseCredsLocked(output)
+	if err != nil {
+		return err
+	}
+	a.setCredsLocked(creds, exp, output)
+
+	if a.diskCache != nil && !exp.IsZero() {
+		if err := a.diskCache.write(output); err != nil {
+			klog.V(2).Infof("exec plugin: failed to cache credentials: %v", err)
+		}
+	}
+	return nil
+}
+
+// runPluginLocked executes the plugin and returns its stdout. It must be
+// called while holding the Authenticator's mutex.
+func (a *Authenticator) runPluginLocked() ([]byte, error) {
 	interactive, err := a.interactiveFunc()
 	if err != nil {
-		return fmt.Errorf("exec plugin cannot support interactive mode: %w", err)
+		return nil, fmt.Errorf("exec plugin cannot support interactive mode: %w", err)
 	}
 
 	cred := &clientauthentication.ExecCredential{
@@ -430,7 +480,7 @@ func (a *Authenticator) refreshCredsLocked() error {
 	env := append(a.environ(), a.env...)
 	data, err := runtime.Encode(codecs.LegacyCodec(a.group), cred)
 	if err != nil {
-		return fmt.Errorf("encode ExecCredentials: %v", err)
+		return nil, fmt.Errorf("encode ExecCredentials: %v", err)
 	}
 	env = append(env, fmt.Sprintf("%s=%s", execInfoEnv, data))
 
@@ -446,32 +496,38 @@ func (a *Authenticator) refreshCredsLocked() error {
 	err = cmd.Run()
 	incrementCallsMetric(err)
 	if err != nil {
-		return a.wrapCmdRunErrorLocked(err)
+		return nil, a.wrapCmdRunErrorLocked(err)
 	}
+	return stdout.Bytes(), nil
+}
 
-	_, gvk, err := codecs.UniversalDecoder(a.group).Decode(stdout.Bytes(), nil, cred)
+// parseCredsLocked decodes the output of the plugin and returns the
+// credentials and their expiration, zero if they don't expire. It must be
+// called while holding the Authenticator's mutex.
+func (a *Authenticator) parseCredsLocked(output []byte) (*credentials, time.Time, error) {
+	cred := &clientauthentication.ExecCredential{}
+	_, gvk, err := codecs.UniversalDecoder(a.group).Decode(output, nil, cred)
 	if err != nil {
-		return fmt.Errorf("decoding stdout: %v", err)
+		return nil, time.Time{}, fmt.Errorf("decoding stdout: %v", err)
 	}
 	if gvk.Group != a.group.Group || gvk.Version != a.group.Version {
-		return fmt.Errorf("exec plugin is configured to use API version %s, plugin returned version %s",
+		return nil, time.Time{}, fmt.Errorf("exec plugin is configured to use API version %s, plugin returned version %s",
 			a.group, schema.GroupVersion{Group: gvk.Group, Version: gvk.Version})
 	}
 
 	if cred.Status == nil {
-		return fmt.Errorf("exec plugin didn't return a status field")
+		return nil, time.Time{}, fmt.Errorf("exec plugin didn't return a status field")
 	}
 	if cred.Status.Token == "" && cred.Status.ClientCertificateData == "" && cred.Status.ClientKeyData == "" {
-		return fmt.Errorf("exec plugin didn't return a token or cert/key pair")
+		return nil, time.Time{}, fmt.Errorf("exec plugin didn't return a token or cert/key pair")
 	}
 	if (cred.Status.ClientCertificateData == "") != (cred.Status.ClientKeyData == "") {
-		return fmt.Errorf("exec plugin returned only certificate or key, not both")
+		return nil, time.Time{}, fmt.Errorf("exec plugin returned only certificate or key, not both")
 	}
 
+	var exp time.Time
 	if cred.Status.ExpirationTimestamp != nil {
-		a.exp = cred.Status.ExpirationTimestamp.Time
-	} else {
-		a.exp = time.Time{}
+		exp = cred.Status.ExpirationTimestamp.Time
 	}
 
 	newCreds := &credentials{
@@ -480,7 +536,7 @@ func (a *Authenticator) refreshCredsLocked() error {
 	if cred.Status.ClientKeyData != "" && cred.Status.ClientCertificateData != "" {
 		cert, err := tls.X509KeyPair([]byte(cred.Status.ClientCertificateData), []byte(cred.Status.ClientKeyData))
 		if err != nil {
-			return fmt.Errorf("failed parsing client key/certificate: %v", err)
+			return nil, time.Time{}, fmt.Errorf("failed parsing client key/certificate: %v", err)
 		}
 
 		// Leaf is initialized to be nil:
@@ -491,10 +547,18 @@ func (a *Authenticator) refreshCredsLocked() error {
 		// certificate values.
 		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
 		if err != nil {
-			return fmt.Errorf("failed parsing client leaf certificate: %v", err)
+			return nil, time.Time{}, fmt.Errorf("failed parsing client leaf certificate: %v", err)
 		}
 		newCreds.cert = &cert
 	}
+	return newCreds, exp, nil
+}
+
+// setCredsLocked replaces the cached credentials. It must be called while
+// holding the Authenticator's mutex.
+func (a *Authenticator) setCredsLocked(newCreds *credentials, exp time.Time, output []byte) {
+	a.exp = exp
+	a.cachedOutput = output
 
 	oldCreds := a.cachedCreds
 	a.cachedCreds = newCreds
@@ -513,7 +577,6 @@ func (a *Authenticator) refreshCredsLocked() error {
 		expiry = a.cachedCreds.cert.Leaf.NotAfter
 	}
 	expirationMetrics.set(a, expiry)
-	return nil
 }
 
 // wrapCmdRunErrorLocked pulls out the code to construct a helpful error message
@@ -0,0 +1,340 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// loginFlowAuthCode is the authorization code flow with PKCE, receiving
+	// the authorization code through a redirect to a loopback listener.
+	//
+	// https://www.rfc-editor.org/rfc/rfc8252#section-7.3
+	loginFlowAuthCode = "auth-code"
+	// loginFlowDeviceCode is the device authorization flow, in which the
+	// user enters a code on another device.
+	//
+	// https://www.rfc-editor.org/rfc/rfc8628
+	loginFlowDeviceCode = "device-code"
+
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+var (
+	// loginTimeout bounds how long the authorization code flow waits for
+	// the user to log in.
+	loginTimeout = 5 * time.Minute
+	// defaultDevicePollInterval is how often the token endpoint is polled
+	// during the device authorization flow if the provider does not say.
+	defaultDevicePollInterval = 5 * time.Second
+)
+
+// login obtains and persists new tokens through the configured interactive
+// flow and returns the id token. The mutex is only held to persist the
+// tokens, so that requests don't wait for the user to log in.
+func (p *oidcAuthProvider) login(ctx context.Context) (string, error) {
+	// The config is replaced rather than modified when tokens are persisted.
+	p.mu.Lock()
+	cfg := p.cfg
+	p.mu.Unlock()
+
+	metadata, err := discover(p.client, cfg[cfgIssuerURL])
+	if err != nil {
+		return "", err
+	}
+	if metadata.TokenURL == "" {
+		return "", fmt.Errorf("oidc: discovery object doesn't contain a token_endpoint")
+	}
+
+	var idToken, refreshToken string
+	switch flow := cfg[cfgLoginFlow]; flow {
+	case "", loginFlowAuthCode:
+		idToken, refreshToken, err = p.authCodeLogin(ctx, cfg, metadata)
+	case loginFlowDeviceCode:
+		idToken, refreshToken, err = p.deviceCodeLogin(ctx, cfg, metadata)
+	default:
+		err = fmt.Errorf("unknown %s %q", cfgLoginFlow, flow)
+	}
+	if err != nil {
+		return "", fmt.Errorf("oidc: login failed: %v", err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.persistTokensLocked(idToken, refreshToken); err != nil {
+		return "", err
+	}
+	return idToken, nil
+}
+
+// scopes returns the scopes requested by interactive logins with the
+// given config.
+func scopes(cfg map[string]string) []string {
+	scopes := []string{"openid"}
+	for _, scope := range strings.Split(cfg[cfgExtraScopes], ",") {
+		if scope = strings.TrimSpace(scope); len(scope) > 0 && scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// authCodeLogin runs the authorization code flow with PKCE. The user is
+// sent to the authorization endpoint, which redirects back to a listener
+// on the loopback interface with the authorization code.
+func (p *oidcAuthProvider) authCodeLogin(ctx context.Context, cfg map[string]string, metadata *providerMetadata) (string, string, error) {
+	if metadata.AuthURL == "" {
+		return "", "", fmt.Errorf("discovery object doesn't contain an authorization_endpoint")
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", cfg[cfgLoginRedirectPort]))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to listen for the redirect: %v", err)
+	}
+	defer listener.Close()
+
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	config := oauth2.Config{
+		ClientID:     cfg[cfgClientID],
+		ClientSecret: cfg[cfgClientSecret],
+		Endpoint:     oauth2.Endpoint{AuthURL: metadata.AuthURL, TokenURL: metadata.TokenURL},
+		RedirectURL:  "http://" + listener.Addr().String() + "/callback",
+		Scopes:       scopes(cfg),
+	}
+	authURL := config.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+
+	type callback struct {
+		code string
+		err  error
+	}
+	callbacks := make(chan callback, 1)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if req.URL.Path != "/callback" || query.Get("state") != state {
+			// Ignore requests not originating from the authorization
+			// endpoint, they must not abort the login.
+			http.Error(w, "Invalid login callback.", http.StatusBadRequest)
+			return
+		}
+		result := callback{code: query.Get("code")}
+		switch {
+		case len(query.Get("error")) > 0:
+			result.err = fmt.Errorf("authorization failed: %s %s", query.Get("error"), query.Get("error_description"))
+			http.Error(w, "Login failed, return to the terminal for details.", http.StatusUnauthorized)
+		case len(result.code) == 0:
+			result.err = fmt.Errorf("authorization response doesn't contain a code")
+			http.Error(w, "Login failed, return to the terminal for details.", http.StatusBadRequest)
+		default:
+			fmt.Fprintln(w, "Login succeeded, you can close this window.")
+		}
+		select {
+		case callbacks <- result:
+		default:
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	if err := p.openURL(authURL); err != nil {
+		return "", "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+	var result callback
+	select {
+	case result = <-callbacks:
+	case <-ctx.Done():
+		return "", "", fmt.Errorf("timed out waiting for the login: %v", ctx.Err())
+	}
+	if result.err != nil {
+		return "", "", result.err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := config.Exchange(ctx, result.code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to exchange the authorization code: %v", err)
+	}
+	idToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", "", fmt.Errorf("token response did not contain an id_token")
+	}
+	return idToken, token.RefreshToken, nil
+}
+
+// deviceAuthorization is the response of the device authorization endpoint.
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+	Error                   string `json:"error"`
+	ErrorDescription        string `json:"error_description"`
+}
+
+// tokenResponse is the response of the token endpoint, successful or not.
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	RefreshToken     string `json:"refresh_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// deviceCodeLogin runs the device authorization flow. The user is asked
+// to enter a code at the verification URI of the provider, possibly on
+// another device, while the token endpoint is polled until the user did.
+func (p *oidcAuthProvider) deviceCodeLogin(ctx context.Context, cfg map[string]string, metadata *providerMetadata) (string, string, error) {
+	if metadata.DeviceURL == "" {
+		return "", "", fmt.Errorf("discovery object doesn't contain a device_authorization_endpoint")
+	}
+	var authorization deviceAuthorization
+	if err := p.postForm(ctx, cfg, metadata.DeviceURL, url.Values{"scope": {strings.Join(scopes(cfg), " ")}}, &authorization); err != nil {
+		return "", "", fmt.Errorf("device authorization failed: %v", err)
+	}
+	if authorization.Error != "" {
+		return "", "", fmt.Errorf("device authorization failed: %s %s", authorization.Error, authorization.ErrorDescription)
+	}
+	if authorization.DeviceCode == "" || authorization.UserCode == "" || authorization.VerificationURI == "" {
+		return "", "", fmt.Errorf("device authorization response is incomplete")
+	}
+
+	if authorization.VerificationURIComplete != "" {
+		fmt.Fprintf(p.prompt, "To log in, visit %s and confirm the code %s\n", authorization.VerificationURIComplete, authorization.UserCode)
+	} else {
+		fmt.Fprintf(p.prompt, "To log in, visit %s and enter the code %s\n", authorization.VerificationURI, authorization.UserCode)
+	}
+
+	if authorization.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(authorization.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	interval := defaultDevicePollInterval
+	if authorization.Interval > 0 {
+		interval = time.Duration(authorization.Interval) * time.Second
+	}
+	form := url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {authorization.DeviceCode},
+	}
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return "", "", fmt.Errorf("timed out waiting for the login: %v", ctx.Err())
+		}
+
+		var token tokenResponse
+		if err := p.postForm(ctx, cfg, metadata.TokenURL, form, &token); err != nil {
+			return "", "", err
+		}
+		switch token.Error {
+		case "":
+			if token.IDToken == "" {
+				return "", "", fmt.Errorf("token response did not contain an id_token")
+			}
+			return token.IDToken, token.RefreshToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return "", "", fmt.Errorf("authorization failed: %s %s", token.Error, token.ErrorDescription)
+		}
+	}
+}
+
+// postForm posts the form, with the client credentials of cfg, to an
+// endpoint of the provider and decodes the JSON response into v. Error
+// responses of the OAuth2 token endpoint are decoded as well.
+func (p *oidcAuthProvider) postForm(ctx context.Context, cfg map[string]string, endpoint string, form url.Values, v interface{}) error {
+	form.Set("client_id", cfg[cfgClientID])
+	if secret := cfg[cfgClientSecret]; len(secret) > 0 {
+		form.Set("client_secret", secret)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+		// Don't produce an error that's too huge (e.g. if we get HTML back for some reason).
+		const n = 80
+		if len(body) > n {
+			body = append(body[:n], []byte("...")...)
+		}
+		return fmt.Errorf("oidc: request to %s failed %s: %q", endpoint, resp.Status, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("oidc: failed to decode response of %s: %v", endpoint, err)
+	}
+	return nil
+}
+
+// randomString returns a random string suitable as state and PKCE code
+// verifier.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// printURL asks the user to open the URL in a browser.
+func printURL(authURL string) error {
+	_, err := fmt.Fprintf(os.Stderr, "To log in, open the following URL in your browser:\n\n\t%s\n\n", authURL)
+	return err
+}
@@ -0,0 +1,349 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oidc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// mockIssuer is an OpenID Connect provider supporting the authorization
+// code flow with PKCE and the device authorization flow.
+type mockIssuer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu sync.Mutex
+	// challenges maps issued authorization codes to their PKCE challenge.
+	challenges map[string]string
+	// devicePolls is the number of polls before a device code is
+	// authorized.
+	devicePolls int
+	// deny makes the issuer deny all authorizations.
+	deny   bool
+	scopes string
+}
+
+const mockUserCode = "ABCD-EFGH"
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	issuer := &mockIssuer{t: t, challenges: map[string]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                        issuer.URL,
+			"authorization_endpoint":        issuer.URL + "/authorize",
+			"token_endpoint":                issuer.URL + "/token",
+			"device_authorization_endpoint": issuer.URL + "/device",
+		})
+	})
+	mux.HandleFunc("/authorize", issuer.authorize)
+	mux.HandleFunc("/device", issuer.device)
+	mux.HandleFunc("/token", issuer.token)
+	issuer.Server = httptest.NewServer(mux)
+	t.Cleanup(issuer.Close)
+	return issuer
+}
+
+func (m *mockIssuer) authorize(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirect.Hostname() != "127.0.0.1" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("client_id") != "client" || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	m.scopes = query.Get("scope")
+	values := url.Values{"state": {query.Get("state")}}
+	if m.deny {
+		values.Set("error", "access_denied")
+	} else {
+		code := fmt.Sprintf("code-%d", len(m.challenges))
+		m.challenges[code] = query.Get("code_challenge")
+		values.Set("code", code)
+	}
+	m.mu.Unlock()
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, req, redirect.String(), http.StatusFound)
+}
+
+func (m *mockIssuer) device(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	m.mu.Lock()
+	m.scopes = req.PostForm.Get("scope")
+	m.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"device_code":      "device-code",
+		"user_code":        mockUserCode,
+		"verification_uri": m.URL + "/activate",
+		"expires_in":       60,
+	})
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	form := req.PostForm
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tokenError := func(code string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	if form.Get("client_id") != "client" {
+		tokenError("invalid_client")
+		return
+	}
+	switch form.Get("grant_type") {
+	case "authorization_code":
+		challenge, ok := m.challenges[form.Get("code")]
+		delete(m.challenges, form.Get("code"))
+		sum := sha256.Sum256([]byte(form.Get("code_verifier")))
+		if !ok || challenge != base64.RawURLEncoding.EncodeToString(sum[:]) {
+			tokenError("invalid_grant")
+			return
+		}
+	case deviceCodeGrantType:
+		switch {
+		case form.Get("device_code") != "device-code":
+			tokenError("invalid_grant")
+			return
+		case m.deny:
+			tokenError("access_denied")
+			return
+		case m.devicePolls > 0:
+			m.devicePolls--
+			tokenError("authorization_pending")
+			return
+		}
+	default:
+		tokenError("unsupported_grant_type")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":  "access-token",
+		"token_type":    "Bearer",
+		"id_token":      testIDToken,
+		"refresh_token": "refresh-token",
+	})
+}
+
+var testIDToken = encodeJWT("{}", fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix()), "signature")
+
+type persister struct {
+	cfg map[string]string
+}
+
+func (p *persister) Persist(cfg map[string]string) error {
+	p.cfg = cfg
+	return nil
+}
+
+func newLoginTestProvider(issuer *mockIssuer, flow string) (*oidcAuthProvider, *persister, *bytes.Buffer) {
+	persister := &persister{}
+	prompt := &bytes.Buffer{}
+	return &oidcAuthProvider{
+		client: issuer.Client(),
+		now:    time.Now,
+		// The browser follows the redirect to the loopback listener.
+		openURL: func(authURL string) error {
+			resp, err := http.Get(authURL)
+			if err != nil {
+				return err
+			}
+			io.Copy(io.Discard, resp.Body)
+			return resp.Body.Close()
+		},
+		prompt: prompt,
+		cfg: map[string]string{
+			cfgIssuerURL:    issuer.URL,
+			cfgClientID:     "client",
+			cfgLoginFlow:    flow,
+			cfgExtraScopes:  "email, groups",
+			cfgRefreshToken: "",
+		},
+		persister: persister,
+	}, persister, prompt
+}
+
+func TestAuthCodeLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider, persister, _ := newLoginTestProvider(issuer, loginFlowAuthCode)
+
+	if err := provider.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if persister.cfg[cfgIDToken] != testIDToken || persister.cfg[cfgRefreshToken] != "refresh-token" {
+		t.Errorf("expected the tokens to be persisted, got %v", persister.cfg)
+	}
+	if issuer.scopes != "openid email groups" {
+		t.Errorf("unexpected scopes %q", issuer.scopes)
+	}
+
+	issuer.deny = true
+	if err := provider.Login(); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("expected the login to be denied, got %v", err)
+	}
+}
+
+func TestAuthCodeLoginIgnoresForgedCallbacks(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider, persister, _ := newLoginTestProvider(issuer, loginFlowAuthCode)
+	browser := provider.openURL
+	provider.openURL = func(authURL string) error {
+		u, _ := url.Parse(authURL)
+		forged := u.Query().Get("redirect_uri") + "?state=forged&error=access_denied"
+		resp, err := http.Get(forged)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected the forged callback to be rejected, got %s", resp.Status)
+		}
+		return browser(authURL)
+	}
+	if err := provider.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if persister.cfg[cfgIDToken] != testIDToken {
+		t.Errorf("expected the tokens to be persisted, got %v", persister.cfg)
+	}
+}
+
+func TestDeviceCodeLogin(t *testing.T) {
+	defer func(interval time.Duration) { defaultDevicePollInterval = interval }(defaultDevicePollInterval)
+	defaultDevicePollInterval = time.Millisecond
+
+	issuer := newMockIssuer(t)
+	issuer.devicePolls = 2
+	provider, persister, prompt := newLoginTestProvider(issuer, loginFlowDeviceCode)
+
+	if err := provider.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(prompt.String(), issuer.URL+"/activate") || !strings.Contains(prompt.String(), mockUserCode) {
+		t.Errorf("expected the user to be prompted for the code, got %q", prompt.String())
+	}
+	if persister.cfg[cfgIDToken] != testIDToken || persister.cfg[cfgRefreshToken] != "refresh-token" {
+		t.Errorf("expected the tokens to be persisted, got %v", persister.cfg)
+	}
+	if issuer.devicePolls != 0 {
+		t.Errorf("expected the token endpoint to be polled until the login was authorized")
+	}
+
+	issuer.deny = true
+	if err := provider.Login(); err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("expected the login to be denied, got %v", err)
+	}
+}
+
+func TestRequestsDoNotLogIn(t *testing.T) {
+	defer func(interval time.Duration) { defaultDevicePollInterval = interval }(defaultDevicePollInterval)
+	defaultDevicePollInterval = time.Millisecond
+
+	issuer := newMockIssuer(t)
+	provider, _, prompt := newLoginTestProvider(issuer, loginFlowDeviceCode)
+
+	var authorization string
+	rt := provider.WrapTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		authorization = req.Header.Get("Authorization")
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}))
+	req, _ := http.NewRequest("GET", "https://cluster.example.com", nil)
+	if _, err := rt.RoundTrip(req); err == nil {
+		t.Errorf("expected requests to fail without tokens")
+	}
+	if prompt.Len() != 0 {
+		t.Errorf("expected requests not to start a login, got prompt %q", prompt.String())
+	}
+
+	if err := provider.Login(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+	if authorization != "Bearer "+testIDToken {
+		t.Errorf("expected the token of the login to be used, got %q", authorization)
+	}
+}
+
+func TestRequestsDoNotWaitForLogin(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider, _, _ := newLoginTestProvider(issuer, loginFlowAuthCode)
+	rt := provider.WrapTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}))
+
+	browser := provider.openURL
+	provider.openURL = func(authURL string) error {
+		// The user is logging in while a request is sent.
+		done := make(chan error, 1)
+		go func() {
+			req, _ := http.NewRequest("GET", "https://cluster.example.com", nil)
+			_, err := rt.RoundTrip(req)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("expected the request to fail without tokens")
+			}
+		case <-time.After(wait.ForeverTestTimeout):
+			return fmt.Errorf("expected the request not to wait for the login")
+		}
+		return browser(authURL)
+	}
+	if err := provider.Login(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestInvalidLoginFlow(t *testing.T) {
+	_, err := newOIDCAuthProvider("https://cluster.example.com", map[string]string{
+		cfgIssuerURL: "https://issuer.example.com",
+		cfgClientID:  "client",
+		cfgLoginFlow: "implicit",
+	}, &persister{})
+	if err == nil || !strings.Contains(err.Error(), cfgLoginFlow) {
+		t.Errorf("expected an invalid login flow to be rejected, got %v", err)
+	}
+}
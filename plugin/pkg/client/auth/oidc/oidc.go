@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -42,8 +43,11 @@ const (
 	cfgCertificateAuthorityData = "idp-certificate-authority-data"
 	cfgIDToken                  = "id-token"
 	cfgRefreshToken             = "refresh-token"
+	cfgLoginFlow                = "login-flow"
+	cfgLoginRedirectPort        = "login-redirect-port"
 
-	// Unused. Scopes aren't sent during refreshing.
+	// Scopes requested by interactive logins in addition to "openid",
+	// separated by commas. Scopes aren't sent during refreshing.
 	cfgExtraScopes = "extra-scopes"
 )
 
@@ -124,9 +128,10 @@ func newOIDCAuthProvider(clusterAddress string, cfg map[string]string, persister
 		return provider, nil
 	}
 
-	if len(cfg[cfgExtraScopes]) > 0 {
-		klog.V(2).Infof("%s auth provider field depricated, refresh request don't send scopes",
-			cfgExtraScopes)
+	switch cfg[cfgLoginFlow] {
+	case "", loginFlowAuthCode, loginFlowDeviceCode:
+	default:
+		return nil, fmt.Errorf("%s must be %q or %q, got %q", cfgLoginFlow, loginFlowAuthCode, loginFlowDeviceCode, cfg[cfgLoginFlow])
 	}
 
 	var certAuthData []byte
@@ -154,6 +159,8 @@ func newOIDCAuthProvider(clusterAddress string, cfg map[string]string, persister
 	provider := &oidcAuthProvider{
 		client:    hc,
 		now:       time.Now,
+		openURL:   printURL,
+		prompt:    os.Stderr,
 		cfg:       cfg,
 		persister: persister,
 	}
@@ -167,6 +174,11 @@ type oidcAuthProvider struct {
 	// Method for determining the current time.
 	now func() time.Time
 
+	// openURL sends the user to the authorization endpoint of the provider
+	// during interactive logins, prompt receives instructions for the user.
+	openURL func(url string) error
+	prompt  io.Writer
+
 	// Mutex guards persisting to the kubeconfig file and allows synchronized
 	// updates to the in-memory config. It also ensures concurrent calls to
 	// the RoundTripper only trigger a single refresh request.
@@ -182,8 +194,15 @@ func (p *oidcAuthProvider) WrapTransport(rt http.RoundTripper) http.RoundTripper
 	}
 }
 
+// Login obtains new tokens through the interactive flow configured by
+// login-flow, the authorization code flow by default, and persists them.
+// Requests never log in interactively, they fail until Login succeeds if
+// the tokens are missing or cannot be refreshed. Login cannot be canceled,
+// it waits for the user for up to five minutes with the authorization code
+// flow and until the device code expires with the device code flow.
 func (p *oidcAuthProvider) Login() error {
-	return errors.New("not yet implemented")
+	_, err := p.login(context.Background())
+	return err
 }
 
 type roundTripper struct {
@@ -234,6 +253,8 @@ func (p *oidcAuthProvider) idToken() (string, error) {
 	}
 
 	// Try to request a new token using the refresh token.
+	// Interactive logins are left to Login, requests fail instead of
+	// waiting for the user.
 	rt, ok := p.cfg[cfgRefreshToken]
 	if !ok || len(rt) == 0 {
 		return "", errors.New("No valid id-token, and cannot refresh without refresh-token")
@@ -266,6 +287,15 @@ func (p *oidcAuthProvider) idToken() (string, error) {
 		return "", fmt.Errorf("token response did not contain an id_token, either the scope \"openid\" wasn't requested upon login, or the provider doesn't support id_tokens as part of the refresh response")
 	}
 
+	if err := p.persistTokensLocked(idToken, token.RefreshToken); err != nil {
+		return "", err
+	}
+	return idToken, nil
+}
+
+// persistTokensLocked persists the given tokens and updates the in memory
+// config. The refresh token is only updated if the server returned one.
+func (p *oidcAuthProvider) persistTokensLocked(idToken, refreshToken string) error {
 	// Create a new config to persist.
 	newCfg := make(map[string]string)
 	for key, val := range p.cfg {
@@ -273,37 +303,58 @@ func (p *oidcAuthProvider) idToken() (string, error) {
 	}
 
 	// Update the refresh token if the server returned another one.
-	if token.RefreshToken != "" && token.RefreshToken != rt {
-		newCfg[cfgRefreshToken] = token.RefreshToken
+	if refreshToken != "" {
+		newCfg[cfgRefreshToken] = refreshToken
 	}
 	newCfg[cfgIDToken] = idToken
 
 	// Persist new config and if successful, update the in memory config.
-	if err = p.persister.Persist(newCfg); err != nil {
-		return "", fmt.Errorf("could not persist new tokens: %v", err)
+	if err := p.persister.Persist(newCfg); err != nil {
+		return fmt.Errorf("could not persist new tokens: %v", err)
 	}
 	p.cfg = newCfg
-
-	return idToken, nil
+	return nil
 }
 
 // tokenEndpoint uses OpenID Connect discovery to determine the OAuth2 token
 // endpoint for the provider, the endpoint the client will use the refresh
 // token against.
 func tokenEndpoint(client *http.Client, issuer string) (string, error) {
+	metadata, err := discover(client, issuer)
+	if err != nil {
+		return "", err
+	}
+	if metadata.TokenURL == "" {
+		return "", fmt.Errorf("oidc: discovery object doesn't contain a token_endpoint")
+	}
+	return metadata.TokenURL, nil
+}
+
+// providerMetadata holds the endpoints of the provider the client uses.
+//
+// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
+type providerMetadata struct {
+	AuthURL   string `json:"authorization_endpoint"`
+	TokenURL  string `json:"token_endpoint"`
+	DeviceURL string `json:"device_authorization_endpoint"`
+}
+
+// discover uses OpenID Connect discovery to determine the endpoints of the
+// provider.
+func discover(client *http.Client, issuer string) (*providerMetadata, error) {
 	// Well known URL for getting OpenID Connect metadata.
 	//
 	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderConfig
 	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
 	resp, err := client.Get(wellKnown)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
 		// Don't produce an error that's too huge (e.g. if we get HTML back for some reason).
@@ -311,23 +362,14 @@ func tokenEndpoint(client *http.Client, issuer string) (string, error) {
 		if len(body) > n {
 			body = append(body[:n], []byte("...")...)
 		}
-		return "", fmt.Errorf("oidc: failed to query metadata endpoint %s: %q", resp.Status, body)
+		return nil, fmt.Errorf("oidc: failed to query metadata endpoint %s: %q", resp.Status, body)
 	}
 
-	// Metadata object. We only care about the token_endpoint, the thing endpoint
-	// we'll be refreshing against.
-	//
-	// https://openid.net/specs/openid-connect-discovery-1_0.html#ProviderMetadata
-	var metadata struct {
-		TokenURL string `json:"token_endpoint"`
-	}
+	var metadata providerMetadata
 	if err := json.Unmarshal(body, &metadata); err != nil {
-		return "", fmt.Errorf("oidc: failed to decode provider discovery object: %v", err)
+		return nil, fmt.Errorf("oidc: failed to decode provider discovery object: %v", err)
 	}
-	if metadata.TokenURL == "" {
-		return "", fmt.Errorf("oidc: discovery object doesn't contain a token_endpoint")
-	}
-	return metadata.TokenURL, nil
+	return &metadata, nil
 }
 
 func idTokenExpired(now func() time.Time, idToken string) (bool, error) {
@@ -22,6 +22,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -98,6 +99,30 @@ type RESTClient struct {
 	// If not set, defaultWarningHandler is used.
 	warningHandler WarningHandler
 
+	// retryPolicy is shared among all requests created by this client.
+	// If not set, only responses with a 'Retry-After' header are retried.
+	retryPolicy RetryPolicy
+
+	// tracer starts the spans of all requests created by this client.
+	tracer Tracer
+
+	// requestCompressionThreshold is the minimum size of request bodies
+	// which are gzip compressed, zero disables compression.
+	requestCompressionThreshold int
+	// requestCompressionRejected is set once the server rejected a
+	// compressed request body, compression is not attempted again.
+	requestCompressionRejected atomic.Bool
+	// requestCompressionProbed is set while a compressed request body
+	// which the server responded to with 400 Bad Request is retried
+	// without compression. Other such responses are not retried meanwhile.
+	requestCompressionProbed atomic.Bool
+
+	// reads coalesces concurrent identical reads, it is nil unless enabled.
+	reads *readGroup
+
+	// webSocketWatch makes watches upgrade to a WebSocket.
+	webSocketWatch bool
+
 	// Set specific behavior of the client.  If not set http.DefaultClient will be used.
 	Client *http.Client
 }
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// coalesceKey returns the key identifying identical reads made by the given
+// method, and false if the request must not be coalesced.
+func (r *Request) coalesceKey(ctx context.Context, method string) (string, bool) {
+	if r.c == nil || r.c.reads == nil || r.err != nil {
+		return "", false
+	}
+	if r.verb != http.MethodGet || r.body != nil || r.bodyBytes != nil {
+		return "", false
+	}
+	if watch := r.params.Get("watch"); watch == "true" || watch == "1" {
+		return "", false
+	}
+
+	var key strings.Builder
+	key.WriteString(method)
+	key.WriteString(" ")
+	key.WriteString(r.URL().String())
+	headers := r.headers
+	if impersonate, ok := r.contextImpersonation(ctx); ok {
+		headers = impersonationHeaders(headers, impersonate)
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			key.WriteString("\n")
+			key.WriteString(name)
+			key.WriteString(": ")
+			key.WriteString(value)
+		}
+	}
+	return key.String(), true
+}
+
+// readGroup shares the result of a read among the callers making the same
+// read while it is in flight.
+type readGroup struct {
+	lock  sync.Mutex
+	calls map[string]*readCall
+}
+
+type readCall struct {
+	done    chan struct{}
+	waiters int
+	result  Result
+	// canceled is set if the caller making the call gave up on it.
+	canceled bool
+}
+
+func newReadGroup() *readGroup {
+	return &readGroup{calls: map[string]*readCall{}}
+}
+
+// do returns the result of fn for key, calling fn unless a call for key is
+// in flight already. Callers waiting for another call return early when
+// their context is done, and make their own call if the context of the
+// caller making the call ended the call.
+func (g *readGroup) do(ctx context.Context, key string, fn func(context.Context) Result) Result {
+	g.lock.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.waiters++
+		g.lock.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return Result{err: ctx.Err()}
+		}
+		if call.canceled && ctx.Err() == nil {
+			return fn(ctx)
+		}
+		return call.result.copy()
+	}
+	call := &readCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.lock.Unlock()
+
+	call.result = fn(ctx)
+	call.canceled = ctx.Err() != nil
+
+	g.lock.Lock()
+	delete(g.calls, key)
+	shared := call.waiters > 0
+	g.lock.Unlock()
+	close(call.done)
+
+	if shared {
+		// The body of call.result is copied by the waiters.
+		return call.result.copy()
+	}
+	return call.result
+}
+
+// copy returns a copy of the result with its own body.
+func (r Result) copy() Result {
+	if r.body != nil {
+		r.body = append([]byte(nil), r.body...)
+	}
+	return r
+}
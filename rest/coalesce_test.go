@@ -0,0 +1,189 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// waitForWaiters waits until n callers wait for the in-flight call of key.
+func waitForWaiters(t *testing.T, g *readGroup, key string, n int) {
+	err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		call, ok := g.calls[key]
+		return ok && call.waiters == n, nil
+	})
+	if err != nil {
+		t.Fatalf("timed out waiting for %d waiters", n)
+	}
+}
+
+func TestCoalesceReads(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.Write([]byte(`{"kind":"Pod","apiVersion":"v1","metadata":{"name":"a"}}`))
+	}))
+	defer server.Close()
+	c := testRESTClient(t, server)
+	c.reads = newReadGroup()
+
+	const callers = 5
+	key, ok := c.Get().Resource("pods").Name("a").coalesceKey(context.Background(), "Do")
+	if !ok {
+		t.Fatal("expected the request to be coalesced")
+	}
+	bodies := make([][]byte, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, err := c.Get().Resource("pods").Name("a").Do(context.Background()).Raw()
+			if err != nil {
+				t.Error(err)
+			}
+			bodies[i] = body
+		}(i)
+	}
+	waitForWaiters(t, c.reads, key, callers-1)
+	close(release)
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("expected a single call to the server, got %d", calls)
+	}
+	for i := range bodies {
+		if string(bodies[i]) != string(bodies[0]) || len(bodies[i]) == 0 {
+			t.Fatalf("caller %d got a different body %q", i, bodies[i])
+		}
+	}
+	bodies[0][0] = 'x'
+	if bodies[1][0] == 'x' {
+		t.Errorf("expected every caller to get its own body")
+	}
+}
+
+func TestCoalesceReadsCanceled(t *testing.T) {
+	var calls int32
+	first := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(first)
+			<-req.Context().Done()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	c := testRESTClient(t, server)
+	c.reads = newReadGroup()
+	key, _ := c.Get().AbsPath("/healthz").coalesceKey(context.Background(), "DoRaw")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderDone := make(chan error)
+	go func() {
+		_, err := c.Get().AbsPath("/healthz").DoRaw(ctx)
+		leaderDone <- err
+	}()
+	<-first
+	followerDone := make(chan []byte)
+	go func() {
+		body, err := c.Get().AbsPath("/healthz").DoRaw(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		followerDone <- body
+	}()
+	waitForWaiters(t, c.reads, key, 1)
+	cancel()
+
+	if err := <-leaderDone; err == nil {
+		t.Errorf("expected the canceled call to fail")
+	}
+	if body := <-followerDone; string(body) != "ok" {
+		t.Errorf("expected the waiting caller to make its own call, got %q", body)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 2 {
+		t.Errorf("expected two calls to the server, got %d", calls)
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	c := testRESTClient(t, nil)
+	if _, ok := c.Get().Resource("pods").coalesceKey(context.Background(), "Do"); ok {
+		t.Errorf("expected no coalescing unless enabled")
+	}
+	c.reads = newReadGroup()
+
+	get := func() *Request { return c.Get().Resource("pods").Namespace("ns") }
+	key, ok := get().coalesceKey(context.Background(), "Do")
+	if !ok {
+		t.Fatal("expected GET requests to be coalesced")
+	}
+	if other, _ := get().coalesceKey(context.Background(), "Do"); other != key {
+		t.Errorf("expected identical requests to have the same key")
+	}
+	for name, r := range map[string]*Request{
+		"watch":    get().Param("watch", "true"),
+		"mutation": c.Post().Resource("pods").Namespace("ns"),
+		"body":     c.Get().Resource("pods").Namespace("ns").Body([]byte("{}")),
+	} {
+		if _, ok := r.coalesceKey(context.Background(), "Do"); ok {
+			t.Errorf("%s: expected no coalescing", name)
+		}
+	}
+	for name, r := range map[string]*Request{
+		"param":  get().Param("labelSelector", "a=b"),
+		"header": get().SetHeader("Accept", "application/yaml"),
+	} {
+		if other, _ := r.coalesceKey(context.Background(), "Do"); other == key {
+			t.Errorf("%s: expected a different key", name)
+		}
+	}
+	if other, _ := get().coalesceKey(context.Background(), "DoRaw"); other == key {
+		t.Errorf("expected Do and DoRaw to be coalesced separately")
+	}
+}
+
+func TestCoalesceKeyImpersonation(t *testing.T) {
+	c := testRESTClient(t, nil)
+	c.reads = newReadGroup()
+
+	alice := WithImpersonation(context.Background(), ImpersonationConfig{UserName: "alice"})
+	bob := WithImpersonation(context.Background(), ImpersonationConfig{UserName: "bob"})
+	aliceKey, _ := c.Get().Resource("pods").coalesceKey(alice, "Do")
+	bobKey, _ := c.Get().Resource("pods").coalesceKey(bob, "Do")
+	if aliceKey == bobKey {
+		t.Errorf("expected reads impersonating different users to be coalesced separately")
+	}
+	explicitKey, _ := c.Get().Resource("pods").Impersonate(ImpersonationConfig{UserName: "alice"}).coalesceKey(context.Background(), "Do")
+	if explicitKey != aliceKey {
+		t.Errorf("expected the impersonation of the context and the request to be equivalent")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+// requestBodyBytes returns the body of the request as it is sent to the
+// server, which is bodyBytes compressed with gzip if the client compresses
+// request bodies of its size. Bodies which do not shrink are sent as is.
+func (r *Request) requestBodyBytes() ([]byte, bool, error) {
+	if !r.compressBody() {
+		return r.bodyBytes, false, nil
+	}
+	if r.compressedBodyBytes == nil {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(r.bodyBytes); err != nil {
+			return nil, false, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, false, err
+		}
+		r.compressedBodyBytes = buf.Bytes()
+	}
+	if len(r.compressedBodyBytes) >= len(r.bodyBytes) {
+		return r.bodyBytes, false, nil
+	}
+	return r.compressedBodyBytes, true, nil
+}
+
+// compressBody returns whether the body of the request should be compressed.
+func (r *Request) compressBody() bool {
+	if r.c == nil || r.disableBodyCompression {
+		return false
+	}
+	if r.c.requestCompressionThreshold <= 0 || len(r.bodyBytes) < r.c.requestCompressionThreshold {
+		return false
+	}
+	if r.c.requestCompressionRejected.Load() {
+		return false
+	}
+	// Leave bodies alone which the caller encoded already.
+	return len(r.headers.Get("Content-Encoding")) == 0
+}
+
+// compressionRetry reports whether an attempt with a compressed body has
+// to be retried without compression because the server rejected the body.
+// It is consulted by withRetry before any retry policy, so the uncompressed
+// attempt is throttled and accounted for like any other retry. Servers which
+// do not support compressed bodies either reject them with 415 Unsupported
+// Media Type or fail to decode them and respond with 400 Bad Request. Since
+// the latter is also the response to an invalid body, a client retries only
+// one 400 at a time without compression. Compression is turned off for the
+// client if the uncompressed body is accepted, otherwise the next 400 is
+// retried without compression again.
+func (r *Request) compressionRetry(req *http.Request, resp *http.Response, err error) bool {
+	if r.probingCompression {
+		// This is the uncompressed attempt after a 400 Bad Request.
+		r.probingCompression = false
+		if err == nil && resp.StatusCode != http.StatusBadRequest {
+			r.disableRequestCompression()
+		} else {
+			// The body is invalid or the outcome is unknown, probe the
+			// next rejected compressed body.
+			r.c.requestCompressionProbed.Store(false)
+		}
+		return false
+	}
+	if err != nil || r.compressedBodyBytes == nil || r.disableBodyCompression || req.Header.Get("Content-Encoding") != "gzip" {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusUnsupportedMediaType:
+		r.disableRequestCompression()
+	case http.StatusBadRequest:
+		if r.c.requestCompressionProbed.Swap(true) {
+			return false
+		}
+		r.probingCompression = true
+	default:
+		return false
+	}
+	r.disableBodyCompression = true
+	return true
+}
+
+func (r *Request) disableRequestCompression() {
+	if !r.c.requestCompressionRejected.Swap(true) {
+		klog.V(2).Infof("The server at %s rejected a compressed request body, request compression is disabled", r.c.base)
+	}
+}
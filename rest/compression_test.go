@@ -0,0 +1,238 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+type receivedBody struct {
+	encoding string
+	body     string
+}
+
+// newCompressionTestServer returns a server which records the bodies it
+// receives. Compressed bodies are answered with rejectStatus if set.
+func newCompressionTestServer(t *testing.T, rejectStatus int) (*httptest.Server, func() []receivedBody) {
+	var lock sync.Mutex
+	var received []receivedBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		encoding := req.Header.Get("Content-Encoding")
+		var body io.Reader = req.Body
+		if encoding == "gzip" {
+			if rejectStatus != 0 {
+				w.WriteHeader(rejectStatus)
+				return
+			}
+			gz, err := gzip.NewReader(req.Body)
+			if err != nil {
+				t.Error(err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			body = gz
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Error(err)
+		}
+		lock.Lock()
+		received = append(received, receivedBody{encoding: encoding, body: string(data)})
+		lock.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []receivedBody {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]receivedBody{}, received...)
+	}
+}
+
+func TestRequestBodyCompression(t *testing.T) {
+	server, received := newCompressionTestServer(t, 0)
+	c := testRESTClient(t, server)
+	c.requestCompressionThreshold = 100
+
+	large := strings.Repeat("a", 1000)
+	for _, body := range []string{"small", large} {
+		if err := c.Post().Resource("configmaps").Body([]byte(body)).Do(context.Background()).Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Bodies which do not shrink are sent uncompressed.
+	random := "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ-_=+[]{};:,.<>/?!@#$%^&*()~`|0123456789abcdefghijklmnopqrstuvwxyz"
+	if err := c.Post().Resource("configmaps").Body([]byte(random)).Do(context.Background()).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []receivedBody{{body: "small"}, {encoding: "gzip", body: large}, {body: random}}
+	if got := received(); len(got) != len(expected) {
+		t.Fatalf("expected %d requests, got %d", len(expected), len(got))
+	} else {
+		for i := range expected {
+			if got[i] != expected[i] {
+				t.Errorf("request %d: expected encoding %q and %d bytes, got encoding %q and %d bytes", i, expected[i].encoding, len(expected[i].body), got[i].encoding, len(got[i].body))
+			}
+		}
+	}
+}
+
+type countingRateLimiter struct {
+	flowcontrol.RateLimiter
+	waits atomic.Int32
+}
+
+func (l *countingRateLimiter) Wait(ctx context.Context) error {
+	l.waits.Add(1)
+	return l.RateLimiter.Wait(ctx)
+}
+
+func TestRequestBodyCompressionFallback(t *testing.T) {
+	large := strings.Repeat("a", 1000)
+	for _, status := range []int{http.StatusUnsupportedMediaType, http.StatusBadRequest} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server, received := newCompressionTestServer(t, status)
+			c := testRESTClient(t, server)
+			c.requestCompressionThreshold = 100
+			limiter := &countingRateLimiter{RateLimiter: flowcontrol.NewFakeAlwaysRateLimiter()}
+			c.rateLimiter = limiter
+
+			for i := 0; i < 2; i++ {
+				if err := c.Put().Resource("configmaps").Name("large").Body([]byte(large)).Do(context.Background()).Error(); err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+			}
+			got := received()
+			if len(got) != 2 || got[0].encoding != "" || got[0].body != large || got[1] != got[0] {
+				t.Errorf("expected the bodies to be sent uncompressed, got %d requests", len(got))
+			}
+			if !c.requestCompressionRejected.Load() {
+				t.Errorf("expected compression to be disabled for the client")
+			}
+			// The uncompressed retry is throttled like any other retry.
+			if waits := limiter.waits.Load(); waits != 3 {
+				t.Errorf("expected 3 waits for the rate limiter, got %d", waits)
+			}
+		})
+	}
+}
+
+func TestRequestBodyCompressionInvalidBody(t *testing.T) {
+	// A server which rejects the body whether or not it is compressed does
+	// not turn off compression.
+	var lock sync.Mutex
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		encodings = append(encodings, req.Header.Get("Content-Encoding"))
+		lock.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	c := testRESTClient(t, server)
+	c.requestCompressionThreshold = 100
+
+	for i := 0; i < 2; i++ {
+		err := c.Post().Resource("configmaps").Body([]byte(strings.Repeat("a", 1000))).Do(context.Background()).Error()
+		if err == nil {
+			t.Fatalf("request %d: expected an error", i)
+		}
+	}
+	if !reflect.DeepEqual(encodings, []string{"gzip", "", "gzip", ""}) {
+		t.Errorf("expected a compressed and an uncompressed attempt for every request, got %q", encodings)
+	}
+	if c.requestCompressionRejected.Load() {
+		t.Errorf("expected compression to stay enabled")
+	}
+}
+
+func TestRequestBodyCompressionFallbackAfterInvalidBody(t *testing.T) {
+	// An invalid body does not keep a later body the server fails to
+	// decompress from being retried without compression.
+	var lock sync.Mutex
+	var encodings []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		encoding := req.Header.Get("Content-Encoding")
+		lock.Lock()
+		encodings = append(encodings, encoding)
+		lock.Unlock()
+		if strings.Contains(req.URL.Path, "invalid") || encoding == "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	c := testRESTClient(t, server)
+	c.requestCompressionThreshold = 100
+	body := []byte(strings.Repeat("a", 1000))
+
+	if err := c.Post().Resource("configmaps").Name("invalid").Body(body).Do(context.Background()).Error(); err == nil {
+		t.Fatal("expected the invalid body to be rejected")
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.Post().Resource("configmaps").Body(body).Do(context.Background()).Error(); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if !reflect.DeepEqual(encodings, []string{"gzip", "", "gzip", "", ""}) {
+		t.Errorf("expected compression to be turned off after the second fallback, got %q", encodings)
+	}
+	if !c.requestCompressionRejected.Load() {
+		t.Errorf("expected compression to be disabled")
+	}
+}
+
+func TestRequestBodyCompressionDisabled(t *testing.T) {
+	server, received := newCompressionTestServer(t, 0)
+	c := testRESTClient(t, server)
+	large := strings.Repeat("a", 1000)
+
+	// Compression is off by default, and bodies passed as a reader or
+	// encoded by the caller are never compressed.
+	requests := []*Request{
+		c.Post().Resource("configmaps").Body([]byte(large)),
+	}
+	c2 := testRESTClient(t, server)
+	c2.requestCompressionThreshold = 100
+	requests = append(requests,
+		c2.Post().Resource("configmaps").Body(strings.NewReader(large)),
+		c2.Post().Resource("configmaps").SetHeader("Content-Encoding", "identity").Body([]byte(large)),
+	)
+	for _, r := range requests {
+		if err := r.Do(context.Background()).Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, got := range received() {
+		if got.encoding == "gzip" {
+			t.Errorf("request %d: expected no compression", i)
+		}
+	}
+}
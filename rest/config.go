@@ -55,6 +55,21 @@ type Config struct {
 	// be appended to all request URIs used to access the apiserver. This allows a frontend
 	// proxy to easily relocate all of the apiserver endpoints.
 	Host string
+	// AlternateHosts is an optional list of additional API server endpoints
+	// equivalent to Host, in the same format. All hosts share the TLS and
+	// authentication settings of this config. When set, requests are sent to
+	// a healthy host chosen according to HostSelection, failing over to the
+	// other hosts when one becomes unreachable. Watches established against
+	// a host which turns unhealthy are closed so they can be re-established.
+	AlternateHosts []string
+	// HostSelection controls how requests are distributed across Host and
+	// AlternateHosts. Defaults to transport.EndpointSelectionOrdered, which
+	// prefers Host and the alternates in order.
+	HostSelection transport.EndpointSelection
+	// HostHealthCheckInterval is how often the hosts are checked against
+	// their /readyz endpoint. If zero, transport.DefaultEndpointHealthCheckInterval
+	// is used.
+	HostHealthCheckInterval time.Duration
 	// APIPath is a sub-path that points to an API root.
 	APIPath string
 
@@ -98,6 +113,26 @@ type Config struct {
 	// server.
 	DisableCompression bool
 
+	// RequestCompressionThreshold, if positive, enables gzip compression of
+	// request bodies of at least this many bytes. Bodies are only sent
+	// compressed when they were passed to Request.Body as bytes, a string or
+	// an object. If the server rejects a compressed body, the request is
+	// retried uncompressed and compression is turned off for the client.
+	RequestCompressionThreshold int
+
+	// CoalesceReads, if true, shares a single in-flight call among
+	// concurrent identical GET requests, those with the same URL and
+	// headers, made through Request.Do or Request.DoRaw. Every caller
+	// receives its own copy of the response body. Watches, streams and
+	// requests with a body are never coalesced.
+	CoalesceReads bool
+
+	// WebSocketWatch, if true, makes watches use the WebSocket support of
+	// the API server instead of a chunked HTTP response, for proxies which
+	// buffer chunked responses. Watches fall back to streaming if the
+	// server does not upgrade the connection.
+	WebSocketWatch bool
+
 	// Transport may be used for custom HTTP behavior. This attribute may not
 	// be specified with the TLS client certificate options. Use WrapTransport
 	// to provide additional per-server middleware behavior.
@@ -119,7 +154,9 @@ type Config struct {
 	// If it's zero, the created RESTClient will use DefaultBurst: 10.
 	Burst int
 
-	// Rate limiter for limiting connections to the master from this client. If present overwrites QPS/Burst
+	// Rate limiter for limiting connections to the master from this client. If present overwrites QPS/Burst.
+	// A flowcontrol.FeedbackRateLimiter, such as the one returned by flowcontrol.NewAdaptiveRateLimiter,
+	// is informed about the responses of the server.
 	RateLimiter flowcontrol.RateLimiter
 
 	// WarningHandler handles warnings in server responses.
@@ -127,6 +164,17 @@ type Config struct {
 	// See documentation for SetDefaultWarningHandler() for details.
 	WarningHandler WarningHandler
 
+	// RetryPolicy decides which failed requests are retried and how long to
+	// wait in between. If not set, requests are only retried when the server
+	// responds with a 'Retry-After' header, and reads on connection resets.
+	// See NewDefaultRetryPolicy for a policy with exponential backoff.
+	RetryPolicy RetryPolicy
+
+	// Tracer, if set, starts a span for every request and propagates the
+	// trace context to the server. Watches get a span which lasts until the
+	// watch ends, with an event for every watch event received.
+	Tracer Tracer
+
 	// The maximum length of time to wait before giving up on a server request. A value of zero means no timeout.
 	Timeout time.Duration
 
@@ -242,6 +290,14 @@ type TLSClientConfig struct {
 	// To indicate to the server http/1.1 is preferred over http/2, set to ["http/1.1", "h2"] (though the server is free to ignore that preference).
 	// To use only http/1.1, set to ["http/1.1"].
 	NextProtos []string
+
+	// Pins are pins of the certificate or the public key of the server, at
+	// least one of which must match in addition to the usual verification.
+	// Public key pins have the format "sha256/<base64 SHA-256 hash of the
+	// DER encoded SubjectPublicKeyInfo>", certificate pins the format
+	// "cert-sha256/<base64 SHA-256 hash of the DER encoded certificate>".
+	// Configure backup pins for the next certificate ahead of a rotation.
+	Pins []string
 }
 
 var _ fmt.Stringer = TLSClientConfig{}
@@ -268,6 +324,7 @@ func (c TLSClientConfig) String() string {
 		KeyData:    c.KeyData,
 		CAData:     c.CAData,
 		NextProtos: c.NextProtos,
+		Pins:       c.Pins,
 	}
 	// Explicitly mark non-empty credential fields as redacted.
 	if len(cc.CertData) != 0 {
@@ -378,6 +435,15 @@ func RESTClientForConfigAndClient(config *Config, httpClient *http.Client) (*RES
 	if err == nil && config.WarningHandler != nil {
 		restClient.warningHandler = config.WarningHandler
 	}
+	if err == nil {
+		restClient.retryPolicy = config.RetryPolicy
+		restClient.tracer = config.Tracer
+		restClient.requestCompressionThreshold = config.RequestCompressionThreshold
+		if config.CoalesceReads {
+			restClient.reads = newReadGroup()
+		}
+		restClient.webSocketWatch = config.WebSocketWatch
+	}
 	return restClient, err
 }
 
@@ -445,6 +511,15 @@ func UnversionedRESTClientForConfigAndClient(config *Config, httpClient *http.Cl
 	if err == nil && config.WarningHandler != nil {
 		restClient.warningHandler = config.WarningHandler
 	}
+	if err == nil {
+		restClient.retryPolicy = config.RetryPolicy
+		restClient.tracer = config.Tracer
+		restClient.requestCompressionThreshold = config.RequestCompressionThreshold
+		if config.CoalesceReads {
+			restClient.reads = newReadGroup()
+		}
+		restClient.webSocketWatch = config.WebSocketWatch
+	}
 	return restClient, err
 }
 
@@ -600,38 +675,50 @@ func AddUserAgent(config *Config, userAgent string) *Config {
 func AnonymousClientConfig(config *Config) *Config {
 	// copy only known safe fields
 	return &Config{
-		Host:          config.Host,
-		APIPath:       config.APIPath,
-		ContentConfig: config.ContentConfig,
+		Host:                    config.Host,
+		AlternateHosts:          config.AlternateHosts,
+		HostSelection:           config.HostSelection,
+		HostHealthCheckInterval: config.HostHealthCheckInterval,
+		APIPath:                 config.APIPath,
+		ContentConfig:           config.ContentConfig,
 		TLSClientConfig: TLSClientConfig{
 			Insecure:   config.Insecure,
 			ServerName: config.ServerName,
 			CAFile:     config.TLSClientConfig.CAFile,
 			CAData:     config.TLSClientConfig.CAData,
 			NextProtos: config.TLSClientConfig.NextProtos,
+			Pins:       config.TLSClientConfig.Pins,
 		},
-		RateLimiter:        config.RateLimiter,
-		WarningHandler:     config.WarningHandler,
-		UserAgent:          config.UserAgent,
-		DisableCompression: config.DisableCompression,
-		QPS:                config.QPS,
-		Burst:              config.Burst,
-		Timeout:            config.Timeout,
-		Dial:               config.Dial,
-		Proxy:              config.Proxy,
+		RateLimiter:                 config.RateLimiter,
+		WarningHandler:              config.WarningHandler,
+		RetryPolicy:                 config.RetryPolicy,
+		Tracer:                      config.Tracer,
+		UserAgent:                   config.UserAgent,
+		DisableCompression:          config.DisableCompression,
+		QPS:                         config.QPS,
+		RequestCompressionThreshold: config.RequestCompressionThreshold,
+		CoalesceReads:               config.CoalesceReads,
+		WebSocketWatch:              config.WebSocketWatch,
+		Burst:                       config.Burst,
+		Timeout:                     config.Timeout,
+		Dial:                        config.Dial,
+		Proxy:                       config.Proxy,
 	}
 }
 
 // CopyConfig returns a copy of the given config
 func CopyConfig(config *Config) *Config {
 	c := &Config{
-		Host:            config.Host,
-		APIPath:         config.APIPath,
-		ContentConfig:   config.ContentConfig,
-		Username:        config.Username,
-		Password:        config.Password,
-		BearerToken:     config.BearerToken,
-		BearerTokenFile: config.BearerTokenFile,
+		Host:                    config.Host,
+		AlternateHosts:          config.AlternateHosts,
+		HostSelection:           config.HostSelection,
+		HostHealthCheckInterval: config.HostHealthCheckInterval,
+		APIPath:                 config.APIPath,
+		ContentConfig:           config.ContentConfig,
+		Username:                config.Username,
+		Password:                config.Password,
+		BearerToken:             config.BearerToken,
+		BearerTokenFile:         config.BearerTokenFile,
 		Impersonate: ImpersonationConfig{
 			UserName: config.Impersonate.UserName,
 			UID:      config.Impersonate.UID,
@@ -651,18 +738,24 @@ func CopyConfig(config *Config) *Config {
 			KeyData:    config.TLSClientConfig.KeyData,
 			CAData:     config.TLSClientConfig.CAData,
 			NextProtos: config.TLSClientConfig.NextProtos,
+			Pins:       config.TLSClientConfig.Pins,
 		},
-		UserAgent:          config.UserAgent,
-		DisableCompression: config.DisableCompression,
-		Transport:          config.Transport,
-		WrapTransport:      config.WrapTransport,
-		QPS:                config.QPS,
-		Burst:              config.Burst,
-		RateLimiter:        config.RateLimiter,
-		WarningHandler:     config.WarningHandler,
-		Timeout:            config.Timeout,
-		Dial:               config.Dial,
-		Proxy:              config.Proxy,
+		UserAgent:                   config.UserAgent,
+		DisableCompression:          config.DisableCompression,
+		RequestCompressionThreshold: config.RequestCompressionThreshold,
+		CoalesceReads:               config.CoalesceReads,
+		WebSocketWatch:              config.WebSocketWatch,
+		Transport:                   config.Transport,
+		WrapTransport:               config.WrapTransport,
+		QPS:                         config.QPS,
+		Burst:                       config.Burst,
+		RateLimiter:                 config.RateLimiter,
+		WarningHandler:              config.WarningHandler,
+		RetryPolicy:                 config.RetryPolicy,
+		Tracer:                      config.Tracer,
+		Timeout:                     config.Timeout,
+		Dial:                        config.Dial,
+		Proxy:                       config.Proxy,
 	}
 	if config.ExecProvider != nil && config.ExecProvider.Config != nil {
 		c.ExecProvider.Config = config.ExecProvider.Config.DeepCopyObject()
@@ -62,6 +62,7 @@ func TestConfigToExecCluster(t *testing.T) {
 					ServerName: "some-server-name",
 					Insecure:   true,
 					CAData:     []byte("some-ca-data"),
+					Pins:       []string{"sha256/some-pin"},
 				},
 				Proxy: proxy,
 			},
@@ -71,6 +72,7 @@ func TestConfigToExecCluster(t *testing.T) {
 				InsecureSkipTLSVerify:    true,
 				CertificateAuthorityData: []byte("some-ca-data"),
 				ProxyURL:                 proxyURL,
+				TLSPins:                  []string{"sha256/some-pin"},
 				Config: &runtime.Unknown{
 					Raw: []byte("stuff"),
 				},
@@ -242,6 +244,12 @@ func TestConfigToExecClusterRoundtrip(t *testing.T) {
 		func(h *WarningHandler, f fuzz.Continue) {
 			*h = &fakeWarningHandler{}
 		},
+		func(p *RetryPolicy, f fuzz.Continue) {
+			*p = &BackoffRetryPolicy{MaxReadRetries: f.Intn(10), MaxMutationRetries: f.Intn(10)}
+		},
+		func(t *Tracer, f fuzz.Continue) {
+			*t = &fakeTracer{}
+		},
 		// Authentication does not require fuzzer
 		func(r *AuthProviderConfigPersister, f fuzz.Continue) {},
 		func(r *clientcmdapi.AuthProviderConfig, f fuzz.Continue) {
@@ -283,14 +291,22 @@ func TestConfigToExecClusterRoundtrip(t *testing.T) {
 		expected.TLSClientConfig.NextProtos = nil
 		expected.UserAgent = ""
 		expected.DisableCompression = false
+		expected.RequestCompressionThreshold = 0
+		expected.CoalesceReads = false
+		expected.WebSocketWatch = false
 		expected.Transport = nil
 		expected.WrapTransport = nil
 		expected.QPS = 0.0
 		expected.Burst = 0
 		expected.RateLimiter = nil
 		expected.WarningHandler = nil
+		expected.RetryPolicy = nil
+		expected.Tracer = nil
 		expected.Timeout = 0
 		expected.Dial = nil
+		expected.AlternateHosts = nil
+		expected.HostSelection = ""
+		expected.HostHealthCheckInterval = 0
 
 		// Manually set URLs so we don't get an error when parsing these during the roundtrip.
 		if expected.Host != "" {
@@ -0,0 +1,91 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"k8s.io/client-go/transport"
+)
+
+type impersonationKey struct{}
+
+// WithImpersonation returns a context which makes requests executed with it
+// impersonate the given user, overriding the impersonation configured for
+// the client. It allows impersonating a different user per call of a typed
+// clientset, sharing its transport and connections. Impersonation set with
+// Request.Impersonate takes precedence.
+func WithImpersonation(ctx context.Context, impersonate ImpersonationConfig) context.Context {
+	return context.WithValue(ctx, impersonationKey{}, impersonate)
+}
+
+// ImpersonationFrom returns the impersonation set with WithImpersonation.
+func ImpersonationFrom(ctx context.Context) (ImpersonationConfig, bool) {
+	impersonate, ok := ctx.Value(impersonationKey{}).(ImpersonationConfig)
+	return impersonate, ok
+}
+
+// Impersonate makes the request impersonate the given user, overriding the
+// impersonation configured for the client. A user name is required.
+func (r *Request) Impersonate(impersonate ImpersonationConfig) *Request {
+	if r.err != nil {
+		return r
+	}
+	if len(impersonate.UserName) == 0 {
+		r.err = fmt.Errorf("impersonation requires a user name")
+		return r
+	}
+	r.headers = impersonationHeaders(r.headers, impersonate)
+	return r
+}
+
+// impersonationHeaders returns a copy of header impersonating the given
+// user instead of any user impersonated by header.
+func impersonationHeaders(header http.Header, impersonate ImpersonationConfig) http.Header {
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	for key := range header {
+		if strings.HasPrefix(key, "Impersonate-") {
+			header.Del(key)
+		}
+	}
+	transport.SetImpersonationHeaders(header, transport.ImpersonationConfig{
+		UserName: impersonate.UserName,
+		UID:      impersonate.UID,
+		Groups:   impersonate.Groups,
+		Extra:    impersonate.Extra,
+	})
+	return header
+}
+
+// contextImpersonation returns the impersonation of the context which
+// applies to the request, if any.
+func (r *Request) contextImpersonation(ctx context.Context) (ImpersonationConfig, bool) {
+	if len(r.headers.Get(transport.ImpersonateUserHeader)) > 0 {
+		return ImpersonationConfig{}, false
+	}
+	impersonate, ok := ImpersonationFrom(ctx)
+	if !ok || len(impersonate.UserName) == 0 {
+		return ImpersonationConfig{}, false
+	}
+	return impersonate, true
+}
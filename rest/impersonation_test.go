@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestRequestImpersonation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		impersonation := http.Header{}
+		for key, values := range req.Header {
+			if strings.HasPrefix(key, "Impersonate-") {
+				impersonation[key] = values
+			}
+		}
+		json.NewEncoder(w).Encode(impersonation)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Host:        server.URL,
+		Impersonate: ImpersonationConfig{UserName: "config-user", Groups: []string{"config-group"}},
+		ContentConfig: ContentConfig{
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		},
+	}
+	client, err := UnversionedRESTClientFor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := ImpersonationConfig{
+		UserName: "alice",
+		UID:      "1",
+		Groups:   []string{"a", "b"},
+		Extra:    map[string][]string{"scopes": {"view"}},
+	}
+	bob := ImpersonationConfig{UserName: "bob"}
+
+	testCases := []struct {
+		name     string
+		ctx      context.Context
+		request  func() *Request
+		expected http.Header
+	}{
+		{
+			name:    "config",
+			ctx:     context.Background(),
+			request: func() *Request { return client.Get().AbsPath("/") },
+			expected: http.Header{
+				"Impersonate-User":  {"config-user"},
+				"Impersonate-Group": {"config-group"},
+			},
+		},
+		{
+			name:    "request",
+			ctx:     context.Background(),
+			request: func() *Request { return client.Get().AbsPath("/").Impersonate(alice) },
+			expected: http.Header{
+				"Impersonate-User":         {"alice"},
+				"Impersonate-Uid":          {"1"},
+				"Impersonate-Group":        {"a", "b"},
+				"Impersonate-Extra-Scopes": {"view"},
+			},
+		},
+		{
+			name:     "context",
+			ctx:      WithImpersonation(context.Background(), bob),
+			request:  func() *Request { return client.Get().AbsPath("/") },
+			expected: http.Header{"Impersonate-User": {"bob"}},
+		},
+		{
+			name:     "request over context",
+			ctx:      WithImpersonation(context.Background(), alice),
+			request:  func() *Request { return client.Get().AbsPath("/").Impersonate(bob) },
+			expected: http.Header{"Impersonate-User": {"bob"}},
+		},
+		{
+			name: "replaced",
+			ctx:  context.Background(),
+			request: func() *Request {
+				return client.Get().AbsPath("/").Impersonate(alice).Impersonate(bob)
+			},
+			expected: http.Header{"Impersonate-User": {"bob"}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := tc.request().DoRaw(tc.ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := http.Header{}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected headers %v, got %v", tc.expected, got)
+			}
+		})
+	}
+
+	if err := client.Get().Impersonate(ImpersonationConfig{Groups: []string{"a"}}).Do(context.Background()).Error(); err == nil {
+		t.Errorf("expected impersonation without a user name to fail")
+	}
+}
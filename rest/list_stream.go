@@ -0,0 +1,363 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// StreamList executes the request, which must return a list, and decodes
+// the items of the list one at a time as the response body is received,
+// calling fn for every item. Unlike Do, the response body is never held in
+// memory as a whole, which makes StreamList suitable for very large lists.
+// The ListMeta of the list is returned once all items were decoded. If fn
+// returns an error, decoding stops and the error is returned.
+//
+// JSON and protobuf responses are supported. Items of JSON lists without
+// apiVersion and kind are decoded as the item kind of the list, derived
+// from the list kind, as long as the list carries its kind before its items,
+// which servers always do.
+func (r *Request) StreamList(ctx context.Context, fn func(item runtime.Object) error) (*metav1.ListMeta, error) {
+	var listMeta *metav1.ListMeta
+	var streamErr error
+	err := r.request(ctx, func(req *http.Request, resp *http.Response) {
+		if resp.StatusCode < http.StatusOK || resp.StatusCode > http.StatusPartialContent {
+			streamErr = r.transformResponse(resp, req).Error()
+			return
+		}
+		handleWarnings(resp.Header, r.warningHandler)
+
+		contentType := resp.Header.Get("Content-Type")
+		if len(contentType) == 0 {
+			contentType = r.c.content.ContentType
+		}
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			streamErr = errors.NewInternalError(err)
+			return
+		}
+		decoder, err := r.c.content.Negotiator.Decoder(mediaType, params)
+		if err != nil {
+			streamErr = fmt.Errorf("serializer for %s doesn't exist", contentType)
+			return
+		}
+		switch mediaType {
+		case runtime.ContentTypeJSON:
+			listMeta, streamErr = decodeJSONListStream(resp.Body, decoder, fn)
+		case runtime.ContentTypeProtobuf:
+			listMeta, streamErr = decodeProtobufListStream(resp.Body, decoder, fn)
+		default:
+			streamErr = fmt.Errorf("streaming lists is not supported for content type %s", contentType)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listMeta, streamErr
+}
+
+// listItemKind returns the kind of the items of a list of the given kind.
+func listItemKind(apiVersion, listKind string) *schema.GroupVersionKind {
+	if !strings.HasSuffix(listKind, "List") {
+		return nil
+	}
+	gvk := schema.FromAPIVersionAndKind(apiVersion, strings.TrimSuffix(listKind, "List"))
+	return &gvk
+}
+
+// decodeJSONListStream decodes a JSON list object, passing every item to fn
+// as soon as it is decoded.
+func decodeJSONListStream(body io.Reader, decoder runtime.Decoder, fn func(runtime.Object) error) (*metav1.ListMeta, error) {
+	d := json.NewDecoder(body)
+	if err := expectJSONDelim(d, '{'); err != nil {
+		return nil, err
+	}
+	listMeta := &metav1.ListMeta{}
+	var apiVersion, kind string
+	for d.More() {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+		switch key {
+		case "apiVersion":
+			err = d.Decode(&apiVersion)
+		case "kind":
+			err = d.Decode(&kind)
+		case "metadata":
+			err = d.Decode(listMeta)
+		case "items":
+			err = decodeJSONListItems(d, decoder, listItemKind(apiVersion, kind), fn)
+		default:
+			var skip json.RawMessage
+			err = d.Decode(&skip)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := expectJSONDelim(d, '}'); err != nil {
+		return nil, err
+	}
+	return listMeta, nil
+}
+
+func decodeJSONListItems(d *json.Decoder, decoder runtime.Decoder, itemKind *schema.GroupVersionKind, fn func(runtime.Object) error) error {
+	token, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		// "items": null
+		return nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected items to be an array, got %v", token)
+	}
+	for d.More() {
+		var item json.RawMessage
+		if err := d.Decode(&item); err != nil {
+			return err
+		}
+		obj, _, err := decoder.Decode(item, itemKind, nil)
+		if err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return expectJSONDelim(d, ']')
+}
+
+func expectJSONDelim(d *json.Decoder, expected json.Delim) error {
+	token, err := d.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("expected %v in list, got %v", expected, token)
+	}
+	return nil
+}
+
+// protobufPrefix is the magic number preceding protobuf encoded objects.
+var protobufPrefix = []byte{0x6b, 0x38, 0x73, 0x00}
+
+// Field numbers of runtime.Unknown, the envelope of protobuf encoded
+// objects, and of list types.
+const (
+	unknownTypeMetaField = 1
+	unknownRawField      = 2
+	listMetaField        = 1
+	listItemsField       = 2
+)
+
+// maxProtobufFieldSize limits the size of a single field, such as an item,
+// of a streamed protobuf list, so that a corrupt length does not make the
+// client allocate arbitrary amounts of memory. It is well above the size
+// limit of objects stored by the apiserver.
+const maxProtobufFieldSize = 64 * 1024 * 1024
+
+// decodeProtobufListStream decodes a protobuf encoded list object. The list
+// is held in the raw field of a runtime.Unknown envelope, which is parsed
+// field by field so that only a single item is in memory at a time. Every
+// item is wrapped into an envelope of its own and decoded by decoder.
+func decodeProtobufListStream(body io.Reader, decoder runtime.Decoder, fn func(runtime.Object) error) (*metav1.ListMeta, error) {
+	r := bufio.NewReader(body)
+	prefix := make([]byte, len(protobufPrefix))
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(prefix, protobufPrefix) {
+		return nil, fmt.Errorf("protobuf list does not start with the expected prefix")
+	}
+
+	var typeMeta runtime.TypeMeta
+	var listMeta *metav1.ListMeta
+	for {
+		field, wireType, err := readProtobufTag(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == unknownTypeMetaField && wireType == protobufBytes:
+			data, err := readProtobufBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			if err := typeMeta.Unmarshal(data); err != nil {
+				return nil, err
+			}
+		case field == unknownRawField && wireType == protobufBytes:
+			length, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			raw := io.LimitReader(r, int64(length))
+			listMeta, err = decodeProtobufListFields(bufio.NewReader(raw), decoder, typeMeta, fn)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := io.Copy(io.Discard, raw); err != nil {
+				return nil, err
+			}
+		default:
+			if err := skipProtobufField(r, wireType); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if listMeta == nil {
+		listMeta = &metav1.ListMeta{}
+	}
+	return listMeta, nil
+}
+
+func decodeProtobufListFields(r *bufio.Reader, decoder runtime.Decoder, typeMeta runtime.TypeMeta, fn func(runtime.Object) error) (*metav1.ListMeta, error) {
+	listMeta := &metav1.ListMeta{}
+	itemKind := listItemKind(typeMeta.APIVersion, typeMeta.Kind)
+	if itemKind == nil {
+		return nil, fmt.Errorf("%s is not a list kind", typeMeta.Kind)
+	}
+	itemAPIVersion, itemKindName := itemKind.ToAPIVersionAndKind()
+	for {
+		field, wireType, err := readProtobufTag(r)
+		if err == io.EOF {
+			return listMeta, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case field == listMetaField && wireType == protobufBytes:
+			data, err := readProtobufBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			if err := listMeta.Unmarshal(data); err != nil {
+				return nil, err
+			}
+		case field == listItemsField && wireType == protobufBytes:
+			data, err := readProtobufBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			envelope := runtime.Unknown{
+				TypeMeta:    runtime.TypeMeta{APIVersion: itemAPIVersion, Kind: itemKindName},
+				Raw:         data,
+				ContentType: runtime.ContentTypeProtobuf,
+			}
+			encoded, err := envelope.Marshal()
+			if err != nil {
+				return nil, err
+			}
+			obj, _, err := decoder.Decode(append(append([]byte{}, protobufPrefix...), encoded...), nil, nil)
+			if err != nil {
+				return nil, err
+			}
+			if err := fn(obj); err != nil {
+				return nil, err
+			}
+		default:
+			if err := skipProtobufField(r, wireType); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Protobuf wire types.
+const (
+	protobufVarint  = 0
+	protobufFixed64 = 1
+	protobufBytes   = 2
+	protobufFixed32 = 5
+)
+
+func readProtobufTag(r *bufio.Reader) (field uint64, wireType uint64, err error) {
+	tag, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	return tag >> 3, tag & 0x7, nil
+}
+
+func readProtobufBytes(r *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxProtobufFieldSize {
+		return nil, fmt.Errorf("protobuf field of %d bytes exceeds the maximum size of %d bytes", length, maxProtobufFieldSize)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return data, nil
+}
+
+func skipProtobufField(r *bufio.Reader, wireType uint64) error {
+	var n uint64
+	switch wireType {
+	case protobufVarint:
+		_, err := binary.ReadUvarint(r)
+		return unexpectedEOF(err)
+	case protobufFixed64:
+		n = 8
+	case protobufFixed32:
+		n = 4
+	case protobufBytes:
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		n = length
+	default:
+		return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+	}
+	_, err := io.CopyN(io.Discard, r, int64(n))
+	return unexpectedEOF(err)
+}
+
+// unexpectedEOF turns io.EOF in the middle of a field into
+// io.ErrUnexpectedEOF, so it is not mistaken for the end of the list.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
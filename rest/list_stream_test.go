@@ -0,0 +1,144 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func newListStreamTestServer(t *testing.T) *httptest.Server {
+	list := &v1.PodList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "42", Continue: "next"},
+		Items: []v1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "a"}, Spec: v1.PodSpec{NodeName: "node-a"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Spec: v1.PodSpec{NodeName: "node-b"}},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/v1/pods" {
+			w.Header().Set("Content-Type", runtime.ContentTypeJSON)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+			return
+		}
+		mediaType := runtime.ContentTypeJSON
+		if req.Header.Get("Accept") == runtime.ContentTypeProtobuf {
+			mediaType = runtime.ContentTypeProtobuf
+		}
+		info, _ := runtime.SerializerInfoForMediaType(scheme.Codecs.SupportedMediaTypes(), mediaType)
+		encoder := scheme.Codecs.EncoderForVersion(info.Serializer, v1.SchemeGroupVersion)
+		w.Header().Set("Content-Type", mediaType)
+		if err := encoder.Encode(list, w); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestStreamList(t *testing.T) {
+	server := newListStreamTestServer(t)
+	for _, contentType := range []string{runtime.ContentTypeJSON, runtime.ContentTypeProtobuf} {
+		t.Run(contentType, func(t *testing.T) {
+			config := defaultContentConfig()
+			config.ContentType = contentType
+			client := testRESTClientWithConfig(t, server, config)
+
+			var names, nodes []string
+			listMeta, err := client.Get().Resource("pods").SetHeader("Accept", contentType).StreamList(context.Background(), func(item runtime.Object) error {
+				pod, ok := item.(*v1.Pod)
+				if !ok {
+					t.Fatalf("expected a pod, got %T", item)
+				}
+				names = append(names, pod.Name)
+				nodes = append(nodes, pod.Spec.NodeName)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(names, []string{"a", "b"}) || !reflect.DeepEqual(nodes, []string{"node-a", "node-b"}) {
+				t.Errorf("unexpected items %v %v", names, nodes)
+			}
+			if listMeta.ResourceVersion != "42" || listMeta.Continue != "next" {
+				t.Errorf("unexpected list metadata %#v", listMeta)
+			}
+		})
+	}
+}
+
+func TestStreamListErrors(t *testing.T) {
+	server := newListStreamTestServer(t)
+	client := testRESTClient(t, server)
+
+	_, err := client.Get().Resource("missing").StreamList(context.Background(), func(runtime.Object) error { return nil })
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected a NotFound error, got %v", err)
+	}
+
+	stop := errors.New("stop")
+	count := 0
+	_, err = client.Get().Resource("pods").StreamList(context.Background(), func(runtime.Object) error {
+		count++
+		return stop
+	})
+	if err != stop || count != 1 {
+		t.Errorf("expected decoding to stop at the first error, got %v after %d items", err, count)
+	}
+}
+
+func TestDecodeProtobufListStreamFieldSize(t *testing.T) {
+	// A list envelope whose type meta field claims to be 1 TiB long.
+	body := append(append([]byte{}, protobufPrefix...), unknownTypeMetaField<<3|protobufBytes)
+	body = binary.AppendUvarint(body, 1<<40)
+	_, err := decodeProtobufListStream(bytes.NewReader(body), scheme.Codecs.UniversalDeserializer(), func(runtime.Object) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum size") {
+		t.Errorf("expected the field to be rejected, got %v", err)
+	}
+}
+
+func TestDecodeJSONListStream(t *testing.T) {
+	decoder := scheme.Codecs.UniversalDeserializer()
+	body := `{"metadata":{"resourceVersion":"1"},"kind":"PodList","apiVersion":"v1","extra":{"a":[1]},"items":null}`
+	listMeta, err := decodeJSONListStream(strings.NewReader(body), decoder, func(runtime.Object) error {
+		t.Fatal("unexpected item")
+		return nil
+	})
+	if err != nil || listMeta.ResourceVersion != "1" {
+		t.Errorf("unexpected result %#v %v", listMeta, err)
+	}
+
+	for _, body := range []string{`[]`, `{"items":{}}`, `{"items":[`, `{"kind":"PodList","apiVersion":"v1","items":[{"metadata":1}]}`} {
+		if _, err := decodeJSONListStream(strings.NewReader(body), decoder, func(runtime.Object) error { return nil }); err == nil {
+			t.Errorf("expected error for %s", body)
+		}
+	}
+}
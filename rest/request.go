@@ -89,6 +89,15 @@ func defaultRequestRetryFn(maxRetries int) WithRetry {
 	return &withRetry{maxRetries: maxRetries}
 }
 
+func newRequestRetryFn(policy RetryPolicy) requestRetryFunc {
+	if policy == nil {
+		return defaultRequestRetryFn
+	}
+	return func(maxRetries int) WithRetry {
+		return &withRetry{maxRetries: maxRetries, policy: policy}
+	}
+}
+
 // Request allows for building up a request to a server in a chained fashion.
 // Any errors are stored until the end of your call, so you only have to
 // check once.
@@ -122,8 +131,21 @@ type Request struct {
 	// only one of body / bodyBytes may be set. requests using body are not retriable.
 	body      io.Reader
 	bodyBytes []byte
+	// compressedBodyBytes caches the gzip compressed bodyBytes for retries.
+	compressedBodyBytes []byte
+	// disableBodyCompression is set when the server rejected the compressed
+	// body of this request.
+	disableBodyCompression bool
+	// probingCompression is set while the body is resent uncompressed after
+	// the compressed body was rejected with 400 Bad Request.
+	probingCompression bool
 
 	retryFn requestRetryFunc
+
+	tracer Tracer
+	// throttleWait is the time the request spent waiting for the client-side
+	// rate limiter, it is recorded on the span of the request.
+	throttleWait time.Duration
 }
 
 // NewRequest creates a new request helper object for accessing runtime.Objects on a server.
@@ -155,8 +177,9 @@ func NewRequest(c *RESTClient) *Request {
 		timeout:        timeout,
 		pathPrefix:     pathPrefix,
 		maxRetries:     10,
-		retryFn:        defaultRequestRetryFn,
+		retryFn:        newRequestRetryFn(c.retryPolicy),
 		warningHandler: c.warningHandler,
+		tracer:         c.tracer,
 	}
 
 	switch {
@@ -428,6 +451,15 @@ func (r *Request) MaxRetries(maxRetries int) *Request {
 	return r
 }
 
+// RetryPolicy makes the request use the given policy to decide which failed
+// attempts are retried and how long to wait in between, replacing the default
+// of only retrying responses with a "Retry-After" header. MaxRetries remains an
+// upper bound on the number of retries. A nil policy restores the default.
+func (r *Request) RetryPolicy(policy RetryPolicy) *Request {
+	r.retryFn = newRequestRetryFn(policy)
+	return r
+}
+
 // Body makes the request use obj as the body. Optional.
 // If obj is a string, try to read a file of that name.
 // If obj is a []byte, send it directly.
@@ -597,6 +629,21 @@ func (r Request) finalURLTemplate() url.URL {
 	return *u
 }
 
+// observeResponse reports the outcome of an attempt to the rate limiter,
+// if it adapts to the responses of the server.
+func (r *Request) observeResponse(ctx context.Context, resp *http.Response, err error, latency time.Duration) {
+	limiter, ok := r.rateLimiter.(flowcontrol.FeedbackRateLimiter)
+	if !ok {
+		return
+	}
+	feedback := flowcontrol.Feedback{Latency: latency, Err: err}
+	if resp != nil {
+		feedback.StatusCode = resp.StatusCode
+		feedback.Header = resp.Header
+	}
+	limiter.Observe(flowcontrol.WithRequestAttributes(ctx, r.verb, r.resource), feedback)
+}
+
 func (r *Request) tryThrottleWithInfo(ctx context.Context, retryInfo string) error {
 	if r.rateLimiter == nil {
 		return nil
@@ -604,11 +651,12 @@ func (r *Request) tryThrottleWithInfo(ctx context.Context, retryInfo string) err
 
 	now := time.Now()
 
-	err := r.rateLimiter.Wait(ctx)
+	err := r.rateLimiter.Wait(flowcontrol.WithRequestAttributes(ctx, r.verb, r.resource))
 	if err != nil {
 		err = fmt.Errorf("client rate limiter Wait returned an error: %w", err)
 	}
 	latency := time.Since(now)
+	r.recordThrottle(latency)
 
 	var message string
 	switch {
@@ -700,6 +748,18 @@ func (r *Request) Watch(ctx context.Context) (watch.Interface, error) {
 		return nil, r.err
 	}
 
+	ctx, span := r.startSpan(ctx, "WATCH")
+	w, err := r.watch(ctx, span)
+	if err != nil {
+		span.end(r, err)
+		return nil, err
+	}
+	return span.traceWatch(r, w), nil
+}
+
+// watch establishes the watch, recording the attempts on the span.
+func (r *Request) watch(ctx context.Context, span *requestSpan) (watch.Interface, error) {
+
 	client := r.c.Client
 	if client == nil {
 		client = http.DefaultClient
@@ -724,18 +784,32 @@ func (r *Request) Watch(ctx context.Context) (watch.Interface, error) {
 		if err != nil {
 			return nil, err
 		}
+		var webSocketKey string
+		if r.c.webSocketWatch {
+			if webSocketKey, err = setWebSocketUpgrade(req); err != nil {
+				return nil, err
+			}
+		}
 
+		start := time.Now()
 		resp, err := client.Do(req)
+		r.observeResponse(ctx, resp, err, time.Since(start))
 		updateURLMetrics(ctx, r, resp, err)
 		retry.After(ctx, r, resp, err)
+		span.attempt(resp)
 		if err == nil && resp.StatusCode == http.StatusOK {
+			// Servers and proxies without WebSocket support stream the watch.
 			return r.newStreamWatcher(resp)
 		}
+		if err == nil && resp.StatusCode == http.StatusSwitchingProtocols && len(webSocketKey) > 0 {
+			return r.newWebSocketWatcher(resp, webSocketKey)
+		}
 
 		done, transformErr := func() (bool, error) {
 			defer readAndCloseResponseBody(resp)
 
 			if retry.IsNextRetry(ctx, r, req, resp, err, isErrRetryableFunc) {
+				span.retry()
 				return false, nil
 			}
 
@@ -763,6 +837,14 @@ func (r *Request) Watch(ctx context.Context) (watch.Interface, error) {
 }
 
 func (r *Request) newStreamWatcher(resp *http.Response) (watch.Interface, error) {
+	return r.newWatcher(resp, func(framer runtime.Framer) io.ReadCloser {
+		return framer.NewFrameReader(resp.Body)
+	})
+}
+
+// newWatcher returns a watcher decoding the events of the frames read from
+// the reader returned by newFrameReader for the framer of the response.
+func (r *Request) newWatcher(resp *http.Response, newFrameReader func(runtime.Framer) io.ReadCloser) (watch.Interface, error) {
 	contentType := resp.Header.Get("Content-Type")
 	mediaType, params, err := mime.ParseMediaType(contentType)
 	if err != nil {
@@ -775,7 +857,7 @@ func (r *Request) newStreamWatcher(resp *http.Response) (watch.Interface, error)
 
 	handleWarnings(resp.Header, r.warningHandler)
 
-	frameReader := framer.NewFrameReader(resp.Body)
+	frameReader := newFrameReader(framer)
 	watchEventDecoder := streaming.NewDecoder(frameReader, streamingSerializer)
 
 	return watch.NewStreamWatcher(
@@ -813,6 +895,14 @@ func (r *Request) Stream(ctx context.Context) (io.ReadCloser, error) {
 		return nil, r.err
 	}
 
+	ctx, span := r.startSpan(ctx, r.verb)
+	body, err := r.stream(ctx, span)
+	span.end(r, err)
+	return body, err
+}
+
+// stream implements Stream, recording the attempts on the span.
+func (r *Request) stream(ctx context.Context, span *requestSpan) (io.ReadCloser, error) {
 	if err := r.tryThrottle(ctx); err != nil {
 		return nil, err
 	}
@@ -833,9 +923,12 @@ func (r *Request) Stream(ctx context.Context) (io.ReadCloser, error) {
 		if err != nil {
 			return nil, err
 		}
+		start := time.Now()
 		resp, err := client.Do(req)
+		r.observeResponse(ctx, resp, err, time.Since(start))
 		updateURLMetrics(ctx, r, resp, err)
 		retry.After(ctx, r, resp, err)
+		span.attempt(resp)
 		if err != nil {
 			// we only retry on an HTTP response with 'Retry-After' header
 			return nil, err
@@ -851,6 +944,7 @@ func (r *Request) Stream(ctx context.Context) (io.ReadCloser, error) {
 				defer resp.Body.Close()
 
 				if retry.IsNextRetry(ctx, r, req, resp, err, neverRetryError) {
+					span.retry()
 					return false, nil
 				}
 				result := r.transformResponse(resp, req)
@@ -895,15 +989,22 @@ func (r *Request) requestPreflightCheck() error {
 
 func (r *Request) newHTTPRequest(ctx context.Context) (*http.Request, error) {
 	var body io.Reader
+	var compressed bool
 	switch {
 	case r.body != nil && r.bodyBytes != nil:
 		return nil, fmt.Errorf("cannot set both body and bodyBytes")
 	case r.body != nil:
 		body = r.body
 	case r.bodyBytes != nil:
+		var data []byte
+		var err error
+		data, compressed, err = r.requestBodyBytes()
+		if err != nil {
+			return nil, err
+		}
 		// Create a new reader specifically for this request.
 		// Giving each request a dedicated reader allows retries to avoid races resetting the request body.
-		body = bytes.NewReader(r.bodyBytes)
+		body = bytes.NewReader(data)
 	}
 
 	url := r.URL().String()
@@ -912,7 +1013,17 @@ func (r *Request) newHTTPRequest(ctx context.Context) (*http.Request, error) {
 		return nil, err
 	}
 	req = req.WithContext(ctx)
-	req.Header = r.headers
+	req.Header = r.injectTraceHeaders(ctx, r.headers)
+	if impersonate, ok := r.contextImpersonation(ctx); ok {
+		req.Header = impersonationHeaders(req.Header, impersonate)
+	}
+	if compressed {
+		req.Header = req.Header.Clone()
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Header.Set("Content-Encoding", "gzip")
+	}
 	return req, nil
 }
 
@@ -936,6 +1047,15 @@ func (r *Request) request(ctx context.Context, fn func(*http.Request, *http.Resp
 		return err
 	}
 
+	ctx, span := r.startSpan(ctx, r.verb)
+	err := r.doRequest(ctx, span, fn)
+	span.end(r, err)
+	return err
+}
+
+// doRequest implements request once the request passed the up front validation.
+func (r *Request) doRequest(ctx context.Context, span *requestSpan, fn func(*http.Request, *http.Response)) error {
+
 	client := r.c.Client
 	if client == nil {
 		client = http.DefaultClient
@@ -978,7 +1098,9 @@ func (r *Request) request(ctx context.Context, fn func(*http.Request, *http.Resp
 		if err != nil {
 			return err
 		}
+		start := time.Now()
 		resp, err := client.Do(req)
+		r.observeResponse(ctx, resp, err, time.Since(start))
 		updateURLMetrics(ctx, r, resp, err)
 		// The value -1 or a value of 0 with a non-nil Body indicates that the length is unknown.
 		// https://pkg.go.dev/net/http#Request
@@ -986,6 +1108,7 @@ func (r *Request) request(ctx context.Context, fn func(*http.Request, *http.Resp
 			metrics.RequestSize.Observe(ctx, r.verb, r.URL().Host, float64(req.ContentLength))
 		}
 		retry.After(ctx, r, resp, err)
+		span.attempt(resp)
 
 		done := func() bool {
 			defer readAndCloseResponseBody(resp)
@@ -999,6 +1122,7 @@ func (r *Request) request(ctx context.Context, fn func(*http.Request, *http.Resp
 			}
 
 			if retry.IsNextRetry(ctx, r, req, resp, err, isErrRetryableFunc) {
+				span.retry()
 				return false
 			}
 
@@ -1018,6 +1142,13 @@ func (r *Request) request(ctx context.Context, fn func(*http.Request, *http.Resp
 //   - If the server responds with a status: *errors.StatusError or *errors.UnexpectedObjectError
 //   - http.Client.Do errors are returned directly.
 func (r *Request) Do(ctx context.Context) Result {
+	if key, ok := r.coalesceKey(ctx, "Do"); ok {
+		return r.c.reads.do(ctx, key, r.do)
+	}
+	return r.do(ctx)
+}
+
+func (r *Request) do(ctx context.Context) Result {
 	var result Result
 	err := r.request(ctx, func(req *http.Request, resp *http.Response) {
 		result = r.transformResponse(resp, req)
@@ -1033,6 +1164,15 @@ func (r *Request) Do(ctx context.Context) Result {
 
 // DoRaw executes the request but does not process the response body.
 func (r *Request) DoRaw(ctx context.Context) ([]byte, error) {
+	if key, ok := r.coalesceKey(ctx, "DoRaw"); ok {
+		result := r.c.reads.do(ctx, key, r.doRaw)
+		return result.body, result.err
+	}
+	result := r.doRaw(ctx)
+	return result.body, result.err
+}
+
+func (r *Request) doRaw(ctx context.Context) Result {
 	var result Result
 	err := r.request(ctx, func(req *http.Request, resp *http.Response) {
 		result.body, result.err = io.ReadAll(resp.Body)
@@ -1042,12 +1182,12 @@ func (r *Request) DoRaw(ctx context.Context) ([]byte, error) {
 		}
 	})
 	if err != nil {
-		return nil, err
+		return Result{err: err}
 	}
 	if result.err == nil || len(result.body) > 0 {
 		metrics.ResponseSize.Observe(ctx, r.verb, r.URL().Host, float64(len(result.body)))
 	}
-	return result.body, result.err
+	return result
 }
 
 // transformResponse converts an API response into a structured API object
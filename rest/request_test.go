@@ -3771,3 +3771,39 @@ func TestTransportConcurrency(t *testing.T) {
 		})
 	}
 }
+
+type feedbackRateLimiter struct {
+	flowcontrol.RateLimiter
+	ctx       []context.Context
+	feedbacks []flowcontrol.Feedback
+}
+
+func (l *feedbackRateLimiter) Observe(ctx context.Context, feedback flowcontrol.Feedback) {
+	l.ctx = append(l.ctx, ctx)
+	l.feedbacks = append(l.feedbacks, feedback)
+}
+
+func TestRequestObservesFeedbackRateLimiter(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(flowcontrol.FlowSchemaUIDHeader, "fs")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer testServer.Close()
+
+	limiter := &feedbackRateLimiter{RateLimiter: flowcontrol.NewFakeAlwaysRateLimiter()}
+	c := testRESTClient(t, testServer)
+	c.rateLimiter = limiter
+	c.Get().Resource("pods").MaxRetries(0).Do(context.Background())
+
+	if len(limiter.feedbacks) != 1 {
+		t.Fatalf("expected one observation, got %#v", limiter.feedbacks)
+	}
+	feedback := limiter.feedbacks[0]
+	if feedback.StatusCode != http.StatusTooManyRequests || feedback.Header.Get(flowcontrol.FlowSchemaUIDHeader) != "fs" {
+		t.Errorf("unexpected feedback %#v", feedback)
+	}
+	expected := flowcontrol.RequestAttributes{Verb: "GET", Resource: "pods"}
+	if attributes := flowcontrol.RequestAttributesFrom(limiter.ctx[0]); attributes != expected {
+		t.Errorf("expected request attributes %#v, got %#v", expected, attributes)
+	}
+}
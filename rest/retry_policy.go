@@ -0,0 +1,253 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// RetryReason classifies why a failed attempt may be retried.
+type RetryReason string
+
+const (
+	// RetryReasonConnectionRefused means the connection to the server could
+	// not be established, so the request never reached the server.
+	RetryReasonConnectionRefused RetryReason = "ConnectionRefused"
+	// RetryReasonConnectionReset means the connection was closed while the
+	// request was in flight.
+	RetryReasonConnectionReset RetryReason = "ConnectionReset"
+	// RetryReasonTimeout means the attempt timed out before a response was
+	// received.
+	RetryReasonTimeout RetryReason = "Timeout"
+	// RetryReasonTooManyRequests means the server responded with 429.
+	RetryReasonTooManyRequests RetryReason = "TooManyRequests"
+	// RetryReasonServerError means the server responded with a 5xx code.
+	RetryReasonServerError RetryReason = "ServerError"
+
+	// retryReasonUnknown is reported for retries whose reason could not be
+	// classified, e.g. because of a custom IsRetryableErrorFunc.
+	retryReasonUnknown RetryReason = "Unknown"
+	// retryReasonCompressionRejected is reported for the uncompressed retry
+	// of a request whose compressed body the server rejected.
+	retryReasonCompressionRejected RetryReason = "CompressionRejected"
+)
+
+// ClassifyRetry returns the reason the outcome of an attempt may be retried,
+// and false if the outcome is not retryable at all. Cancellation of the
+// request context is never retryable.
+func ClassifyRetry(resp *http.Response, err error) (RetryReason, bool) {
+	if err != nil {
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return "", false
+		case net.IsConnectionRefused(err):
+			return RetryReasonConnectionRefused, true
+		case net.IsConnectionReset(err), net.IsProbableEOF(err):
+			return RetryReasonConnectionReset, true
+		case net.IsTimeout(err):
+			return RetryReasonTimeout, true
+		}
+		return "", false
+	}
+	if resp == nil {
+		return "", false
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return RetryReasonTooManyRequests, true
+	case resp.StatusCode == http.StatusGatewayTimeout:
+		return RetryReasonTimeout, true
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return RetryReasonServerError, true
+	}
+	return "", false
+}
+
+// RetryAttempt describes a failed attempt of a request.
+type RetryAttempt struct {
+	// Request is the HTTP request sent to the server.
+	Request *http.Request
+	// Response is the response from the server, it is nil if Err is set.
+	Response *http.Response
+	// Err is the error returned by the attempt.
+	Err error
+	// Attempt is the number of the attempt that just failed, starting at 1.
+	Attempt int
+}
+
+// RetryDecision is the outcome of a RetryPolicy.
+type RetryDecision struct {
+	// Retry is true if the request should be retried.
+	Retry bool
+	// Delay is how long to wait before the next attempt.
+	Delay time.Duration
+	// Reason is the classification of the failed attempt. It is set even
+	// if the request is not retried.
+	Reason RetryReason
+}
+
+// RetryPolicy decides whether, and after what delay, a failed attempt of a
+// request is retried. Requests with a body that cannot be replayed, and
+// requests which already reached the limit set by Request.MaxRetries, are
+// never retried regardless of the policy.
+type RetryPolicy interface {
+	NextRetry(ctx context.Context, attempt RetryAttempt) RetryDecision
+}
+
+// RetryPolicyFunc adapts a function to the RetryPolicy interface.
+type RetryPolicyFunc func(ctx context.Context, attempt RetryAttempt) RetryDecision
+
+func (f RetryPolicyFunc) NextRetry(ctx context.Context, attempt RetryAttempt) RetryDecision {
+	return f(ctx, attempt)
+}
+
+// RetryDecisionFunc is called with a decision made by a RetryPolicy.
+type RetryDecisionFunc func(ctx context.Context, attempt RetryAttempt, decision RetryDecision)
+
+// ObserveRetryDecisions returns a RetryPolicy which makes the decisions of
+// policy and reports each of them to onDecision, for example to log or
+// count them. It works with any RetryPolicy.
+func ObserveRetryDecisions(policy RetryPolicy, onDecision RetryDecisionFunc) RetryPolicy {
+	return RetryPolicyFunc(func(ctx context.Context, attempt RetryAttempt) RetryDecision {
+		decision := policy.NextRetry(ctx, attempt)
+		onDecision(ctx, attempt, decision)
+		return decision
+	})
+}
+
+// BackoffRetryPolicy retries failed attempts with an exponential backoff.
+// Idempotent reads and mutations have separate retry budgets, and
+// mutations are only retried for reasons where the server is known not to
+// have processed the request.
+type BackoffRetryPolicy struct {
+	// MaxReadRetries is the number of retries of GET, HEAD and OPTIONS
+	// requests, including watches.
+	MaxReadRetries int
+	// MaxMutationRetries is the number of retries of all other requests.
+	MaxMutationRetries int
+	// MutationRetryReasons are the reasons a mutation is retried for. If
+	// nil, mutations are retried when the connection was refused or the
+	// server responded with 429, which both guarantee the request was not
+	// processed.
+	MutationRetryReasons []RetryReason
+	// Backoff computes the delay before retry N as Duration*Factor^(N-1),
+	// limited to Cap if set, with Jitter applied. Steps is ignored. If the
+	// server sent a Retry-After header, the longer of both is used.
+	Backoff wait.Backoff
+}
+
+var _ RetryPolicy = &BackoffRetryPolicy{}
+
+// NewDefaultRetryPolicy returns a BackoffRetryPolicy retrying reads up to
+// five times and mutations up to twice, starting with a delay of 100ms
+// doubling up to 10s, with 10% jitter.
+func NewDefaultRetryPolicy() *BackoffRetryPolicy {
+	return &BackoffRetryPolicy{
+		MaxReadRetries:     5,
+		MaxMutationRetries: 2,
+		Backoff: wait.Backoff{
+			Duration: 100 * time.Millisecond,
+			Factor:   2.0,
+			Jitter:   0.1,
+			Cap:      10 * time.Second,
+		},
+	}
+}
+
+var defaultMutationRetryReasons = []RetryReason{RetryReasonConnectionRefused, RetryReasonTooManyRequests}
+
+func (p *BackoffRetryPolicy) NextRetry(ctx context.Context, attempt RetryAttempt) RetryDecision {
+	reason, ok := ClassifyRetry(attempt.Response, attempt.Err)
+	decision := RetryDecision{Reason: reason}
+	if !ok {
+		return decision
+	}
+
+	if isIdempotentRead(attempt.Request.Method) {
+		if attempt.Attempt > p.MaxReadRetries {
+			return decision
+		}
+	} else {
+		if attempt.Attempt > p.MaxMutationRetries {
+			return decision
+		}
+		reasons := p.MutationRetryReasons
+		if reasons == nil {
+			reasons = defaultMutationRetryReasons
+		}
+		if !containsRetryReason(reasons, reason) {
+			return decision
+		}
+	}
+
+	decision.Retry = true
+	decision.Delay = p.delay(attempt.Attempt)
+	if attempt.Response != nil {
+		if seconds, ok := retryAfterSeconds(attempt.Response); ok {
+			if retryAfter := time.Duration(seconds) * time.Second; retryAfter > decision.Delay {
+				decision.Delay = retryAfter
+			}
+		}
+	}
+	return decision
+}
+
+// delay returns the jittered backoff before the given retry.
+func (p *BackoffRetryPolicy) delay(retry int) time.Duration {
+	factor := p.Backoff.Factor
+	if factor <= 0 {
+		factor = 1
+	}
+	d := float64(p.Backoff.Duration) * math.Pow(factor, float64(retry-1))
+	var delay time.Duration
+	switch {
+	case p.Backoff.Cap > 0 && d > float64(p.Backoff.Cap):
+		delay = p.Backoff.Cap
+	case d >= math.MaxInt64:
+		delay = math.MaxInt64
+	default:
+		delay = time.Duration(d)
+	}
+	if p.Backoff.Jitter > 0 {
+		delay = wait.Jitter(delay, p.Backoff.Jitter)
+	}
+	return delay
+}
+
+func isIdempotentRead(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func containsRetryReason(reasons []RetryReason, reason RetryReason) bool {
+	for _, r := range reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/metrics"
+)
+
+func TestClassifyRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		err        error
+		want       RetryReason
+		wantOK     bool
+	}{
+		{name: "ok", statusCode: http.StatusOK},
+		{name: "not found", statusCode: http.StatusNotFound},
+		{name: "too many requests", statusCode: http.StatusTooManyRequests, want: RetryReasonTooManyRequests, wantOK: true},
+		{name: "service unavailable", statusCode: http.StatusServiceUnavailable, want: RetryReasonServerError, wantOK: true},
+		{name: "gateway timeout", statusCode: http.StatusGatewayTimeout, want: RetryReasonTimeout, wantOK: true},
+		{name: "connection refused", err: &url.Error{Op: "Get", Err: syscall.ECONNREFUSED}, want: RetryReasonConnectionRefused, wantOK: true},
+		{name: "connection reset", err: &url.Error{Op: "Get", Err: syscall.ECONNRESET}, want: RetryReasonConnectionReset, wantOK: true},
+		{name: "EOF", err: &url.Error{Op: "Get", Err: io.EOF}, want: RetryReasonConnectionReset, wantOK: true},
+		{name: "timeout", err: &url.Error{Op: "Get", Err: timeoutError{}}, want: RetryReasonTimeout, wantOK: true},
+		{name: "canceled", err: &url.Error{Op: "Get", Err: context.Canceled}},
+		{name: "deadline exceeded", err: &url.Error{Op: "Get", Err: context.DeadlineExceeded}},
+		{name: "other error", err: errors.New("boom")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var resp *http.Response
+			if test.err == nil {
+				resp = &http.Response{StatusCode: test.statusCode}
+			}
+			got, ok := ClassifyRetry(resp, test.err)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("expected %q, %v, got %q, %v", test.want, test.wantOK, got, ok)
+			}
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestBackoffRetryPolicy(t *testing.T) {
+	policy := &BackoffRetryPolicy{
+		MaxReadRetries:     3,
+		MaxMutationRetries: 1,
+		Backoff:            wait.Backoff{Duration: time.Second, Factor: 2, Cap: 5 * time.Second},
+	}
+	get := &http.Request{Method: "GET"}
+	post := &http.Request{Method: "POST"}
+	unavailable := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+	throttled := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"7"}}}
+
+	tests := []struct {
+		name    string
+		attempt RetryAttempt
+		want    RetryDecision
+	}{
+		{
+			name:    "first read retry",
+			attempt: RetryAttempt{Request: get, Response: unavailable, Attempt: 1},
+			want:    RetryDecision{Retry: true, Delay: time.Second, Reason: RetryReasonServerError},
+		},
+		{
+			name:    "exponential backoff",
+			attempt: RetryAttempt{Request: get, Response: unavailable, Attempt: 3},
+			want:    RetryDecision{Retry: true, Delay: 4 * time.Second, Reason: RetryReasonServerError},
+		},
+		{
+			name:    "read budget exhausted",
+			attempt: RetryAttempt{Request: get, Response: unavailable, Attempt: 4},
+			want:    RetryDecision{Reason: RetryReasonServerError},
+		},
+		{
+			name:    "mutation on server error",
+			attempt: RetryAttempt{Request: post, Response: unavailable, Attempt: 1},
+			want:    RetryDecision{Reason: RetryReasonServerError},
+		},
+		{
+			name:    "mutation on connection refused",
+			attempt: RetryAttempt{Request: post, Err: &url.Error{Op: "Post", Err: syscall.ECONNREFUSED}, Attempt: 1},
+			want:    RetryDecision{Retry: true, Delay: time.Second, Reason: RetryReasonConnectionRefused},
+		},
+		{
+			name:    "mutation honors retry-after",
+			attempt: RetryAttempt{Request: post, Response: throttled, Attempt: 1},
+			want:    RetryDecision{Retry: true, Delay: 7 * time.Second, Reason: RetryReasonTooManyRequests},
+		},
+		{
+			name:    "mutation budget exhausted",
+			attempt: RetryAttempt{Request: post, Response: throttled, Attempt: 2},
+			want:    RetryDecision{Reason: RetryReasonTooManyRequests},
+		},
+		{
+			name:    "not retryable",
+			attempt: RetryAttempt{Request: get, Response: &http.Response{StatusCode: http.StatusConflict}, Attempt: 1},
+			want:    RetryDecision{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := policy.NextRetry(context.Background(), test.attempt); got != test.want {
+				t.Errorf("expected %#v, got %#v", test.want, got)
+			}
+		})
+	}
+
+	// The delay never exceeds the cap.
+	if got := policy.NextRetry(context.Background(), RetryAttempt{Request: get, Response: unavailable, Attempt: 3}); got.Delay > 5*time.Second {
+		t.Errorf("expected delay to be capped, got %v", got.Delay)
+	}
+	policy.MaxReadRetries = 100
+	if got := policy.NextRetry(context.Background(), RetryAttempt{Request: get, Response: unavailable, Attempt: 100}); got.Delay != 5*time.Second {
+		t.Errorf("expected delay to be capped, got %v", got.Delay)
+	}
+}
+
+type retryMetricRecorder struct {
+	lock    sync.Mutex
+	retries []string
+}
+
+func (r *retryMetricRecorder) IncrementRetry(_ context.Context, code, method, _ string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.retries = append(r.retries, method+" "+code)
+}
+
+type retryReasonMetricRecorder struct {
+	lock    sync.Mutex
+	retries []string
+}
+
+func (r *retryReasonMetricRecorder) IncrementRetry(_ context.Context, code, method, _, reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.retries = append(r.retries, method+" "+code+" "+reason)
+}
+
+func TestRequestRetryPolicy(t *testing.T) {
+	var lock sync.Mutex
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		calls[req.Method]++
+		n := calls[req.Method]
+		lock.Unlock()
+		switch {
+		case req.Method == "GET" && n <= 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case req.Method == "POST" && n == 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case req.Method == "PUT":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	recorder := &retryMetricRecorder{}
+	old := metrics.RequestRetry
+	metrics.RequestRetry = recorder
+	defer func() { metrics.RequestRetry = old }()
+	oldReason := metrics.RequestRetryReason
+	reasonRecorder := &retryReasonMetricRecorder{}
+	metrics.RequestRetryReason = reasonRecorder
+	defer func() { metrics.RequestRetryReason = oldReason }()
+
+	var decisions []string
+	backoff := NewDefaultRetryPolicy()
+	backoff.Backoff.Duration = time.Millisecond
+	policy := ObserveRetryDecisions(backoff, func(_ context.Context, attempt RetryAttempt, decision RetryDecision) {
+		decisions = append(decisions, fmt.Sprintf("%s %d %s %v", attempt.Request.Method, attempt.Attempt, decision.Reason, decision.Retry))
+	})
+	c, err := RESTClientFor(&Config{
+		Host:        srv.URL,
+		RetryPolicy: policy,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &schema.GroupVersion{},
+			NegotiatedSerializer: &serializer.CodecFactory{},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := c.Get().AbsPath("/get").DoRaw(ctx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := c.Post().AbsPath("/post").Body([]byte("{}")).DoRaw(ctx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := c.Put().AbsPath("/put").Body([]byte("{}")).DoRaw(ctx); err == nil {
+		t.Errorf("expected error")
+	}
+	// MaxRetries still bounds the policy.
+	if _, err := c.Get().AbsPath("/get").MaxRetries(0).DoRaw(ctx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"GET 1 ServerError true",
+		"GET 2 ServerError true",
+		"POST 1 TooManyRequests true",
+		"PUT 1 ServerError false",
+	}
+	if fmt.Sprint(decisions) != fmt.Sprint(want) {
+		t.Errorf("expected decisions %v, got %v", want, decisions)
+	}
+	if got, want := fmt.Sprint(recorder.retries), "[GET 503 GET 503 POST 429]"; got != want {
+		t.Errorf("expected retry metrics %v, got %v", want, got)
+	}
+	if got, want := fmt.Sprint(reasonRecorder.retries), "[GET 503 ServerError GET 503 ServerError POST 429 TooManyRequests]"; got != want {
+		t.Errorf("expected retry reason metrics %v, got %v", want, got)
+	}
+	if calls["GET"] != 4 || calls["POST"] != 2 || calls["PUT"] != 1 {
+		t.Errorf("unexpected calls %v", calls)
+	}
+
+	// A policy set on the request takes precedence.
+	never := RetryPolicyFunc(func(context.Context, RetryAttempt) RetryDecision { return RetryDecision{} })
+	lock.Lock()
+	calls["GET"] = 0
+	lock.Unlock()
+	if _, err := c.Get().AbsPath("/get").RetryPolicy(never).DoRaw(ctx); err == nil {
+		t.Errorf("expected error")
+	}
+	if calls["GET"] != 1 {
+		t.Errorf("expected a single attempt, got %d", calls["GET"])
+	}
+}
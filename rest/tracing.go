@@ -0,0 +1,222 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Attribute keys set on the spans of requests.
+const (
+	TraceAttributeVerb         = "k8s.verb"
+	TraceAttributeResource     = "k8s.resource"
+	TraceAttributeSubresource  = "k8s.subresource"
+	TraceAttributeNamespace    = "k8s.namespace"
+	TraceAttributeStatusCode   = "http.status_code"
+	TraceAttributeRetries      = "k8s.retries"
+	TraceAttributeThrottleWait = "k8s.throttle_wait"
+
+	// Attribute keys set on the events added to the span of a watch.
+	TraceAttributeEventType       = "k8s.watch.event_type"
+	TraceAttributeResourceVersion = "k8s.resource_version"
+)
+
+// TraceAttribute is a key value pair describing a span or an event.
+type TraceAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans for requests, typically by delegating to a tracing
+// library such as OpenTelemetry.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, if any, and
+	// returns a context holding the new span.
+	Start(ctx context.Context, name string, attributes ...TraceAttribute) (context.Context, Span)
+	// Inject adds the headers propagating the span in ctx to the server.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	// SetAttributes sets attributes on the span.
+	SetAttributes(attributes ...TraceAttribute)
+	// AddEvent records an event which happened during the span.
+	AddEvent(name string, attributes ...TraceAttribute)
+	// RecordError records an error which caused the operation to fail.
+	RecordError(err error)
+	// End ends the span.
+	End()
+}
+
+// requestSpan is the span of a single request and the state recorded on
+// it once the request completes. A nil *requestSpan is valid and does
+// nothing, it is used when no tracer is configured.
+type requestSpan struct {
+	span       Span
+	retries    int
+	statusCode int
+}
+
+// startSpan starts a span for the request if a tracer is configured.
+func (r *Request) startSpan(ctx context.Context, name string) (context.Context, *requestSpan) {
+	if r.tracer == nil {
+		return ctx, nil
+	}
+	if len(r.resource) > 0 {
+		name = name + " " + r.resource
+	}
+	attributes := []TraceAttribute{{Key: TraceAttributeVerb, Value: r.verb}}
+	if len(r.resource) > 0 {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeResource, Value: r.resource})
+	}
+	if len(r.subresource) > 0 {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeSubresource, Value: r.subresource})
+	}
+	if len(r.namespace) > 0 {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeNamespace, Value: r.namespace})
+	}
+	ctx, span := r.tracer.Start(ctx, name, attributes...)
+	r.throttleWait = 0
+	return ctx, &requestSpan{span: span}
+}
+
+// attempt records the outcome of an attempt of the request.
+func (s *requestSpan) attempt(resp *http.Response) {
+	if s == nil {
+		return
+	}
+	if resp != nil {
+		s.statusCode = resp.StatusCode
+	}
+}
+
+// retry records that the request is retried.
+func (s *requestSpan) retry() {
+	if s == nil {
+		return
+	}
+	s.retries++
+}
+
+// end records the final state of the request on the span and ends it.
+func (s *requestSpan) end(r *Request, err error) {
+	if s == nil {
+		return
+	}
+	s.setAttributes(r)
+	if err != nil {
+		s.span.RecordError(err)
+	}
+	s.span.End()
+}
+
+func (s *requestSpan) setAttributes(r *Request) {
+	attributes := []TraceAttribute{
+		{Key: TraceAttributeRetries, Value: s.retries},
+		{Key: TraceAttributeThrottleWait, Value: r.throttleWait},
+	}
+	if s.statusCode != 0 {
+		attributes = append(attributes, TraceAttribute{Key: TraceAttributeStatusCode, Value: s.statusCode})
+	}
+	s.span.SetAttributes(attributes...)
+}
+
+// injectTraceHeaders returns the headers to send with the request, including
+// the headers propagating the span in ctx.
+func (r *Request) injectTraceHeaders(ctx context.Context, header http.Header) http.Header {
+	if r.tracer == nil {
+		return header
+	}
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	r.tracer.Inject(ctx, header)
+	return header
+}
+
+// recordThrottle adds the time spent waiting for the client-side rate limiter.
+func (r *Request) recordThrottle(wait time.Duration) {
+	r.throttleWait += wait
+}
+
+// traceWatch keeps the span of a watch open until the watch ends, adding
+// an event to it for every event received.
+func (s *requestSpan) traceWatch(r *Request, w watch.Interface) watch.Interface {
+	if s == nil {
+		return w
+	}
+	s.setAttributes(r)
+	tw := &tracingWatcher{
+		watcher: w,
+		span:    s.span,
+		result:  make(chan watch.Event),
+		done:    make(chan struct{}),
+	}
+	go tw.receive()
+	return tw
+}
+
+type tracingWatcher struct {
+	watcher watch.Interface
+	span    Span
+	result  chan watch.Event
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (w *tracingWatcher) Stop() {
+	w.once.Do(func() { close(w.done) })
+	w.watcher.Stop()
+}
+
+func (w *tracingWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *tracingWatcher) receive() {
+	defer w.span.End()
+	defer close(w.result)
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.watcher.ResultChan():
+			if !ok {
+				return
+			}
+			attributes := []TraceAttribute{{Key: TraceAttributeEventType, Value: string(event.Type)}}
+			if accessor, err := meta.Accessor(event.Object); err == nil && len(accessor.GetResourceVersion()) > 0 {
+				attributes = append(attributes, TraceAttribute{Key: TraceAttributeResourceVersion, Value: accessor.GetResourceVersion()})
+			}
+			w.span.AddEvent("watch "+strings.ToLower(string(event.Type)), attributes...)
+			select {
+			case w.result <- event:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
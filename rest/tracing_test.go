@@ -0,0 +1,284 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+type recordingSpanKey struct{}
+
+// recordingTracer records the spans started through it.
+type recordingTracer struct {
+	lock  sync.Mutex
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attributes ...TraceAttribute) (context.Context, Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	span := &recordingSpan{name: name, attributes: map[string]interface{}{}, ended: make(chan struct{})}
+	span.SetAttributes(attributes...)
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, recordingSpanKey{}, span), span
+}
+
+func (t *recordingTracer) Inject(ctx context.Context, header http.Header) {
+	if span, ok := ctx.Value(recordingSpanKey{}).(*recordingSpan); ok {
+		header.Set("traceparent", span.name)
+	}
+}
+
+func (t *recordingTracer) getSpans() []*recordingSpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*recordingSpan(nil), t.spans...)
+}
+
+type recordingSpan struct {
+	name string
+
+	lock       sync.Mutex
+	attributes map[string]interface{}
+	events     []recordedSpanEvent
+	err        error
+	ended      chan struct{}
+}
+
+type recordedSpanEvent struct {
+	name       string
+	attributes []TraceAttribute
+}
+
+func (s *recordingSpan) SetAttributes(attributes ...TraceAttribute) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, attribute := range attributes {
+		s.attributes[attribute.Key] = attribute.Value
+	}
+}
+
+func (s *recordingSpan) AddEvent(name string, attributes ...TraceAttribute) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.events = append(s.events, recordedSpanEvent{name: name, attributes: attributes})
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err
+}
+
+func (s *recordingSpan) End() {
+	close(s.ended)
+}
+
+func (s *recordingSpan) isEnded() bool {
+	select {
+	case <-s.ended:
+		return true
+	default:
+		return false
+	}
+}
+
+// slowRateLimiter waits a fixed amount of time for every token.
+type slowRateLimiter struct {
+	flowcontrol.RateLimiter
+	wait time.Duration
+}
+
+func (l *slowRateLimiter) Wait(ctx context.Context) error {
+	time.Sleep(l.wait)
+	return nil
+}
+
+func newTracingTestClient(t *testing.T, server *httptest.Server, tracer Tracer) *RESTClient {
+	client, err := RESTClientFor(&Config{
+		Host: server.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &v1.SchemeGroupVersion,
+			NegotiatedSerializer: scheme.Codecs.WithoutConversion(),
+		},
+		RateLimiter: &slowRateLimiter{RateLimiter: flowcontrol.NewFakeAlwaysRateLimiter(), wait: 10 * time.Millisecond},
+		Tracer:      tracer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRequestTracing(t *testing.T) {
+	var lock sync.Mutex
+	var traceparents []string
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		traceparents = append(traceparents, req.Header.Get("traceparent"))
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	client := newTracingTestClient(t, server, tracer)
+	err := client.Get().Namespace("ns").Resource("pods").Name("a").SubResource("status").Do(context.Background()).Error()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	spans := tracer.getSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected one span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.name != "GET pods" {
+		t.Errorf("unexpected span name %q", span.name)
+	}
+	if !span.isEnded() {
+		t.Errorf("expected span to be ended")
+	}
+	expected := map[string]interface{}{
+		TraceAttributeVerb:        "GET",
+		TraceAttributeResource:    "pods",
+		TraceAttributeSubresource: "status",
+		TraceAttributeNamespace:   "ns",
+		TraceAttributeStatusCode:  http.StatusNotFound,
+		TraceAttributeRetries:     1,
+	}
+	for key, value := range expected {
+		if span.attributes[key] != value {
+			t.Errorf("expected attribute %s to be %v, got %v", key, value, span.attributes[key])
+		}
+	}
+	if wait, _ := span.attributes[TraceAttributeThrottleWait].(time.Duration); wait < 20*time.Millisecond {
+		t.Errorf("expected the throttle wait of both attempts to be recorded, got %v", wait)
+	}
+	if !reflect.DeepEqual(traceparents, []string{"GET pods", "GET pods"}) {
+		t.Errorf("expected trace headers on every attempt, got %v", traceparents)
+	}
+}
+
+func TestStreamTracing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Header.Get("traceparent")))
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	client := newTracingTestClient(t, server, tracer)
+	body, err := client.Get().Namespace("ns").Resource("pods").Name("a").SubResource("log").Stream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "GET pods" {
+		t.Errorf("expected trace header to be sent, got %q", data)
+	}
+	spans := tracer.getSpans()
+	if len(spans) != 1 || !spans[0].isEnded() || spans[0].attributes[TraceAttributeStatusCode] != http.StatusOK {
+		t.Errorf("expected an ended span with the status code, got %#v", spans)
+	}
+}
+
+func TestWatchTracing(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		for _, rv := range []string{"1", "2"} {
+			data, _ := json.Marshal(&v1.Pod{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+				ObjectMeta: metav1.ObjectMeta{Name: "a", ResourceVersion: rv},
+			})
+			json.NewEncoder(w).Encode(&metav1.WatchEvent{Type: "MODIFIED", Object: runtime.RawExtension{Raw: data}})
+			w.(http.Flusher).Flush()
+		}
+		<-release
+	}))
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	client := newTracingTestClient(t, server, tracer)
+	w, err := client.Get().Namespace("ns").Resource("pods").Param("watch", "true").Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		<-w.ResultChan()
+	}
+
+	span := tracer.getSpans()[0]
+	if span.name != "WATCH pods" {
+		t.Errorf("unexpected span name %q", span.name)
+	}
+	if span.isEnded() {
+		t.Errorf("expected span to stay open while the watch is running")
+	}
+	close(release)
+	w.Stop()
+	select {
+	case <-span.ended:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("expected span to end when the watch stopped")
+	}
+
+	span.lock.Lock()
+	defer span.lock.Unlock()
+	if len(span.events) != 2 {
+		t.Fatalf("expected two events, got %#v", span.events)
+	}
+	for i, rv := range []string{"1", "2"} {
+		expected := recordedSpanEvent{
+			name: "watch modified",
+			attributes: []TraceAttribute{
+				{Key: TraceAttributeEventType, Value: "MODIFIED"},
+				{Key: TraceAttributeResourceVersion, Value: rv},
+			},
+		}
+		if !reflect.DeepEqual(span.events[i], expected) {
+			t.Errorf("expected event %#v, got %#v", expected, span.events[i])
+		}
+	}
+}
@@ -68,6 +68,18 @@ func TransportFor(config *Config) (http.RoundTripper, error) {
 	return transport.New(cfg)
 }
 
+// DropCachedTransport evicts the transport shared by clients with the TLS
+// options of the provided Config from the transport cache and closes its
+// idle connections. Clients created before keep working. It returns whether
+// a transport was evicted.
+func DropCachedTransport(config *Config) (bool, error) {
+	cfg, err := config.TransportConfig()
+	if err != nil {
+		return false, err
+	}
+	return transport.DropCachedTransport(cfg)
+}
+
 // HTTPWrappersForConfig wraps a round tripper with any relevant layered behavior from the
 // config. Exposed to allow more clients that need HTTP-like behavior but then must hijack
 // the underlying connection (like WebSocket or HTTP2 clients). Pure HTTP clients should use
@@ -97,6 +109,7 @@ func (c *Config) TransportConfig() (*transport.Config, error) {
 			KeyFile:    c.KeyFile,
 			KeyData:    c.KeyData,
 			NextProtos: c.NextProtos,
+			Pins:       c.Pins,
 		},
 		Username:        c.Username,
 		Password:        c.Password,
@@ -115,13 +128,25 @@ func (c *Config) TransportConfig() (*transport.Config, error) {
 		conf.DialHolder = &transport.DialHolder{Dial: c.Dial}
 	}
 
+	if len(c.AlternateHosts) > 0 {
+		endpoints, err := hostEndpoints(c)
+		if err != nil {
+			return nil, err
+		}
+		conf.Endpoints = endpoints
+		conf.EndpointSelection = c.HostSelection
+		conf.EndpointHealthCheckInterval = c.HostHealthCheckInterval
+	}
+
 	if c.ExecProvider != nil && c.AuthProvider != nil {
 		return nil, errors.New("execProvider and authProvider cannot be used in combination")
 	}
 
 	if c.ExecProvider != nil {
 		var cluster *clientauthentication.Cluster
-		if c.ExecProvider.ProvideClusterInfo {
+		// The cluster is passed to the plugin only if ProvideClusterInfo is
+		// set, but also keys credentials cached on disk.
+		if c.ExecProvider.ProvideClusterInfo || c.ExecProvider.CacheCredentials {
 			var err error
 			cluster, err = ConfigToExecCluster(c)
 			if err != nil {
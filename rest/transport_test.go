@@ -18,12 +18,18 @@ package rest
 
 import (
 	"context"
+	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/transport"
 )
 
 // TestTransportForThreadSafe is meant to be run with the race detector
@@ -147,3 +153,49 @@ uml0obOEy+ON91k+SWTJ3ggmF/U=
 	}
 	wg.Wait()
 }
+
+func TestTransportConfigAlternateHosts(t *testing.T) {
+	config := &Config{
+		Host:                    "primary:6443",
+		AlternateHosts:          []string{"https://secondary:6443/prefix"},
+		HostSelection:           transport.EndpointSelectionRandom,
+		HostHealthCheckInterval: time.Minute,
+		TLSClientConfig:         TLSClientConfig{Insecure: true},
+	}
+	tc, err := config.TransportConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://primary:6443", "https://secondary:6443/prefix"}; !reflect.DeepEqual(tc.Endpoints, want) {
+		t.Errorf("expected endpoints %v, got %v", want, tc.Endpoints)
+	}
+	if tc.EndpointSelection != transport.EndpointSelectionRandom || tc.EndpointHealthCheckInterval != time.Minute {
+		t.Errorf("unexpected endpoint settings %q, %v", tc.EndpointSelection, tc.EndpointHealthCheckInterval)
+	}
+
+	config.AlternateHosts = []string{""}
+	if _, err := config.TransportConfig(); err == nil {
+		t.Errorf("expected error for empty alternate host")
+	}
+}
+
+func TestHTTPClientForAlternateHosts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.URL.Path))
+	}))
+	defer server.Close()
+
+	// Nothing listens on the primary host.
+	client, err := HTTPClientFor(&Config{Host: "http://127.0.0.1:1", AlternateHosts: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get("http://127.0.0.1:1/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "/api" {
+		t.Errorf("unexpected response %q", body)
+	}
+}
@@ -95,3 +95,27 @@ func defaultServerUrlFor(config *Config) (*url.URL, string, error) {
 	}
 	return DefaultServerURL(host, config.APIPath, schema.GroupVersion{}, defaultTLS)
 }
+
+// hostEndpoints returns the base URLs of config.Host and config.AlternateHosts,
+// defaulted the same way as the URL returned by defaultServerUrlFor.
+func hostEndpoints(config *Config) ([]string, error) {
+	endpoints := make([]string, 0, len(config.AlternateHosts)+1)
+	hostURL, _, err := defaultServerUrlFor(config)
+	if err != nil {
+		return nil, err
+	}
+	endpoints = append(endpoints, hostURL.String())
+	for _, host := range config.AlternateHosts {
+		if host == "" {
+			return nil, fmt.Errorf("alternate hosts must not be empty")
+		}
+		c := *config
+		c.Host = host
+		hostURL, _, err := defaultServerUrlFor(&c)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, hostURL.String())
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,277 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// webSocketGUID is appended to the key of a WebSocket handshake to compute
+// the accept value of the server, see RFC 6455 section 1.3.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes, see RFC 6455 section 5.2.
+const (
+	webSocketContinuation = 0x0
+	webSocketText         = 0x1
+	webSocketBinary       = 0x2
+	webSocketClose        = 0x8
+	webSocketPing         = 0x9
+	webSocketPong         = 0xa
+)
+
+// maxWebSocketMessage bounds the size of a single watch event.
+const maxWebSocketMessage = 64 * 1024 * 1024
+
+// setWebSocketUpgrade turns req into a WebSocket handshake and returns the
+// key of the handshake. The API server requires the origin to be set.
+func setWebSocketUpgrade(req *http.Request) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	header := req.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Connection", "Upgrade")
+	header.Set("Upgrade", "websocket")
+	header.Set("Sec-WebSocket-Version", "13")
+	header.Set("Sec-WebSocket-Key", key)
+	if len(header.Get("Origin")) == 0 {
+		header.Set("Origin", req.URL.Scheme+"://"+req.URL.Host)
+	}
+	req.Header = header
+	return key, nil
+}
+
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// newWebSocketWatcher returns a watcher reading the events of a watch
+// upgraded to a WebSocket. The API server sends every event as a message of
+// its own, encoded like the events of a streamed watch without framing.
+func (r *Request) newWebSocketWatcher(resp *http.Response, key string) (watch.Interface, error) {
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected upgrade to %q for a WebSocket watch", resp.Header.Get("Upgrade"))
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != webSocketAccept(key) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("invalid WebSocket handshake, unexpected Sec-WebSocket-Accept %q", accept)
+	}
+	conn := newWebSocketConn(resp.Body)
+	return r.newWatcher(resp, func(runtime.Framer) io.ReadCloser { return conn })
+}
+
+// webSocketConn is the client side of a WebSocket connection. It reads one
+// message at a time, following the io.Reader contract of frame readers:
+// messages which do not fit into the buffer passed to Read are returned in
+// parts, with io.ErrShortBuffer for all but the last part.
+type webSocketConn struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	// writer is the body of the upgraded response. It is nil if the body
+	// was wrapped by a round tripper hiding it, in which case no frames are
+	// sent to the server.
+	writer io.Writer
+
+	// message is the unread rest of the current message.
+	message []byte
+	pending bool
+
+	writeLock sync.Mutex
+	closeOnce sync.Once
+}
+
+func newWebSocketConn(body io.ReadCloser) *webSocketConn {
+	c := &webSocketConn{body: body, reader: bufio.NewReader(body)}
+	if writer, ok := body.(io.Writer); ok {
+		c.writer = writer
+	}
+	return c
+}
+
+func (c *webSocketConn) Read(p []byte) (int, error) {
+	if !c.pending {
+		message, err := c.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.message, c.pending = message, true
+	}
+	n := copy(p, c.message)
+	c.message = c.message[n:]
+	if len(c.message) > 0 {
+		return n, io.ErrShortBuffer
+	}
+	c.pending = false
+	return n, nil
+}
+
+// readMessage returns the payload of the next data message, answering
+// control frames on the way. A close frame ends the stream with io.EOF.
+func (c *webSocketConn) readMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case webSocketPing:
+			if err := c.writeFrame(webSocketPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case webSocketPong:
+			continue
+		case webSocketClose:
+			c.closeWithFrame(payload)
+			return nil, io.EOF
+		case webSocketText, webSocketBinary:
+			if started {
+				return nil, fmt.Errorf("unexpected WebSocket frame in the middle of a message")
+			}
+			started = true
+		case webSocketContinuation:
+			if !started {
+				return nil, fmt.Errorf("unexpected WebSocket continuation frame")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported WebSocket opcode %d", opcode)
+		}
+		if len(message)+len(payload) > maxWebSocketMessage {
+			return nil, fmt.Errorf("WebSocket message exceeds %d bytes", maxWebSocketMessage)
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *webSocketConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, unexpectedEOF(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, unexpectedEOF(err)
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxWebSocketMessage {
+		return false, 0, nil, fmt.Errorf("WebSocket frame exceeds %d bytes", maxWebSocketMessage)
+	}
+	// Servers do not mask their frames, but unmasking costs nothing.
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, unexpectedEOF(err)
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, unexpectedEOF(err)
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame writes a single frame, masked as required from clients.
+func (c *webSocketConn) writeFrame(opcode byte, payload []byte) error {
+	if c.writer == nil {
+		return nil
+	}
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, 0x80|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[len(frame)-2:], uint16(length))
+	default:
+		frame = append(frame, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(length))
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	_, err := c.writer.Write(frame)
+	return err
+}
+
+// closeWithFrame sends a close frame with the given payload, which is empty
+// or starts with a status code, and closes the connection.
+func (c *webSocketConn) closeWithFrame(payload []byte) error {
+	var err error
+	c.closeOnce.Do(func() {
+		// The close frame is a courtesy, the connection is closed anyway.
+		c.writeFrame(webSocketClose, payload)
+		err = c.body.Close()
+	})
+	return err
+}
+
+// Close ends the watch with a normal closure.
+func (c *webSocketConn) Close() error {
+	return c.closeWithFrame([]byte{0x03, 0xe8})
+}
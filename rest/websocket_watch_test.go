@@ -0,0 +1,203 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	addedPodEvent    = `{"type":"ADDED","object":{"kind":"Pod","apiVersion":"v1","metadata":{"name":"a","resourceVersion":"1"}}}`
+	modifiedPodEvent = `{"type":"MODIFIED","object":{"kind":"Pod","apiVersion":"v1","metadata":{"name":"a","resourceVersion":"2"}}}`
+)
+
+// newWebSocketWatchServer serves watches of pods over WebSocket like the API
+// server, sending every event as a text message. The connection is closed
+// after the events were sent unless hold is set, in which case it stays
+// open until the client closes it.
+func newWebSocketWatchServer(t *testing.T, hold bool) (*httptest.Server, <-chan struct{}) {
+	closed := make(chan struct{})
+	handler := websocket.Handler(func(ws *websocket.Conn) {
+		defer close(closed)
+		for _, event := range []string{addedPodEvent, modifiedPodEvent} {
+			if err := websocket.Message.Send(ws, event); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if hold {
+			// Returns once the client closes the connection.
+			var ignored string
+			websocket.Message.Receive(ws, &ignored)
+		}
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("watch") != "true" {
+			t.Errorf("unexpected request %s", req.URL)
+		}
+		if req.Header.Get("Upgrade") != "websocket" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(addedPodEvent + "\n" + modifiedPodEvent + "\n"))
+			return
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+	return server, closed
+}
+
+func expectPodEvents(t *testing.T, w watch.Interface) {
+	for _, expected := range []struct {
+		eventType       watch.EventType
+		resourceVersion string
+	}{{watch.Added, "1"}, {watch.Modified, "2"}} {
+		select {
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				t.Fatalf("watch closed early")
+			}
+			pod, isPod := event.Object.(*v1.Pod)
+			if event.Type != expected.eventType || !isPod || pod.ResourceVersion != expected.resourceVersion {
+				t.Fatalf("unexpected event %s %#v", event.Type, event.Object)
+			}
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Fatalf("timed out waiting for %s", expected.eventType)
+		}
+	}
+}
+
+func TestWebSocketWatch(t *testing.T) {
+	for _, webSocket := range []bool{true, false} {
+		server, _ := newWebSocketWatchServer(t, false)
+		c := testRESTClient(t, server)
+		c.webSocketWatch = webSocket
+
+		w, err := c.Get().Resource("pods").Param("watch", "true").Watch(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectPodEvents(t, w)
+		select {
+		case event, ok := <-w.ResultChan():
+			if ok {
+				t.Errorf("expected the watch to end with the connection, got %#v", event)
+			}
+		case <-time.After(wait.ForeverTestTimeout):
+			t.Errorf("timed out waiting for the watch to end")
+		}
+	}
+}
+
+func TestWebSocketWatchStop(t *testing.T) {
+	server, closed := newWebSocketWatchServer(t, true)
+	c := testRESTClient(t, server)
+	c.webSocketWatch = true
+
+	w, err := c.Get().Resource("pods").Param("watch", "true").Watch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPodEvents(t, w)
+	w.Stop()
+	select {
+	case <-closed:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Errorf("expected stopping the watch to close the connection")
+	}
+}
+
+func TestWebSocketWatchErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Forbidden","code":403}`))
+	}))
+	defer server.Close()
+	c := testRESTClient(t, server)
+	c.webSocketWatch = true
+	c.createBackoffMgr = func() BackoffManager { return &NoBackoff{} }
+	c.rateLimiter = flowcontrol.NewFakeAlwaysRateLimiter()
+
+	if _, err := c.Get().Resource("pods").Param("watch", "true").Watch(context.Background()); !apierrors.IsForbidden(err) {
+		t.Errorf("expected a Forbidden error, got %v", err)
+	}
+}
+
+type fakeWebSocketBody struct {
+	io.Reader
+	written bytes.Buffer
+	closed  bool
+}
+
+func (b *fakeWebSocketBody) Write(p []byte) (int, error) { return b.written.Write(p) }
+func (b *fakeWebSocketBody) Close() error                { b.closed = true; return nil }
+
+func TestWebSocketConn(t *testing.T) {
+	frames := []byte{
+		0x01, 0x03, 'a', 'b', 'c', // text frame, not final
+		0x89, 0x02, 'h', 'i', // ping between the fragments of a message
+		0x80, 0x02, 'd', 'e', // final continuation frame
+		0x82, 0x01, 'x', // binary message
+		0x88, 0x02, 0x03, 0xe8, // close
+	}
+	body := &fakeWebSocketBody{Reader: bytes.NewReader(frames)}
+	conn := newWebSocketConn(body)
+
+	buf := make([]byte, 3)
+	n, err := conn.Read(buf)
+	if n != 3 || err != io.ErrShortBuffer || string(buf[:n]) != "abc" {
+		t.Fatalf("expected the first part of the message, got %q %v", buf[:n], err)
+	}
+	n, err = conn.Read(buf)
+	if n != 2 || err != nil || string(buf[:n]) != "de" {
+		t.Fatalf("expected the rest of the message, got %q %v", buf[:n], err)
+	}
+	n, err = conn.Read(buf)
+	if n != 1 || err != nil || string(buf[:n]) != "x" {
+		t.Fatalf("expected the second message, got %q %v", buf[:n], err)
+	}
+	if _, err := conn.Read(buf); err != io.EOF {
+		t.Fatalf("expected the close frame to end the stream, got %v", err)
+	}
+	if !body.closed {
+		t.Errorf("expected the connection to be closed")
+	}
+
+	// The pong and the close frame are masked.
+	written := body.written.Bytes()
+	if len(written) != 2+4+2+2+4+2 || written[0] != 0x8a || written[1] != 0x82 || written[8] != 0x88 {
+		t.Fatalf("unexpected frames written %x", written)
+	}
+	mask := written[2:6]
+	if pong := []byte{written[6] ^ mask[0], written[7] ^ mask[1]}; string(pong) != "hi" {
+		t.Errorf("expected the ping to be answered, got %q", pong)
+	}
+}
@@ -22,8 +22,10 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
+	"k8s.io/client-go/tools/metrics"
 	"k8s.io/klog/v2"
 )
 
@@ -118,6 +120,11 @@ type withRetry struct {
 	maxRetries int
 	attempts   int
 
+	// policy, if set, decides which attempts are retried instead of
+	// the 'Retry-After' response header and the IsRetryableErrorFunc
+	// passed to IsNextRetry.
+	policy RetryPolicy
+
 	// retry after parameters that pertain to the attempt that is to
 	// be made soon, so as to enable 'Before' and 'After' to refer
 	// to the retry parameters.
@@ -160,10 +167,36 @@ func (r *withRetry) IsNextRetry(ctx context.Context, restReq *Request, httpReq *
 
 	r.attempts++
 	r.retryAfter = &RetryAfter{Attempt: r.attempts}
+	if restReq.compressionRetry(httpReq, resp, err) {
+		// The body is resent uncompressed regardless of the retry budget.
+		r.retryAfter.Reason = fmt.Sprintf("retries: %d, retry-reason: %s", r.attempts, retryReasonCompressionRejected)
+		incrementRetryMetric(ctx, httpReq, resp, err, retryReasonCompressionRejected)
+		return true
+	}
 	if r.attempts > r.maxRetries {
 		return false
 	}
 
+	if r.policy != nil {
+		if err == nil && resp.StatusCode < http.StatusBadRequest {
+			// the attempt did not fail.
+			return false
+		}
+		decision := r.policy.NextRetry(ctx, RetryAttempt{
+			Request:  httpReq,
+			Response: resp,
+			Err:      err,
+			Attempt:  r.attempts,
+		})
+		if !decision.Retry {
+			return false
+		}
+		r.retryAfter.Wait = decision.Delay
+		r.retryAfter.Reason = fmt.Sprintf("retries: %d, retry-after: %s - retry-reason: %s", r.attempts, decision.Delay, decision.Reason)
+		incrementRetryMetric(ctx, httpReq, resp, err, decision.Reason)
+		return true
+	}
+
 	// if the server returned an error, it takes precedence over the http response.
 	var errIsRetryable bool
 	if f != nil && err != nil && f.IsErrorRetryable(httpReq, err) {
@@ -188,10 +221,28 @@ func (r *withRetry) IsNextRetry(ctx context.Context, restReq *Request, httpReq *
 
 	r.retryAfter.Wait = time.Duration(seconds) * time.Second
 	r.retryAfter.Reason = getRetryReason(r.attempts, seconds, resp, err)
+	reason, _ := ClassifyRetry(resp, err)
+	incrementRetryMetric(ctx, httpReq, resp, err, reason)
 
 	return true
 }
 
+func incrementRetryMetric(ctx context.Context, req *http.Request, resp *http.Response, err error, reason RetryReason) {
+	code := "<error>"
+	if err == nil && resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	host := "none"
+	if req.URL != nil {
+		host = req.URL.Host
+	}
+	metrics.RequestRetry.IncrementRetry(ctx, code, req.Method, host)
+	if len(reason) == 0 {
+		reason = retryReasonUnknown
+	}
+	metrics.RequestRetryReason.IncrementRetry(ctx, code, req.Method, host, string(reason))
+}
+
 func (r *withRetry) Before(ctx context.Context, request *Request) error {
 	// If the request context is already canceled there
 	// is no need to retry.
@@ -44,6 +44,11 @@ func (in *TLSClientConfig) DeepCopyInto(out *TLSClientConfig) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Pins != nil {
+		in, out := &in.Pins, &out.Pins
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
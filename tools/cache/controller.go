@@ -17,6 +17,7 @@ limitations under the License.
 package cache
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -114,6 +115,20 @@ type Controller interface {
 	LastSyncResourceVersion() string
 }
 
+// ControllerWithContext is a Controller which can also be run with a
+// context. The controllers returned by New implement it, but it is not part
+// of Controller so that other implementations keep working; use a type
+// assertion to check for it.
+type ControllerWithContext interface {
+	Controller
+
+	// RunWithContext does the same as Run, but continues until ctx is
+	// done, and logs through the logger of ctx.
+	RunWithContext(ctx context.Context)
+}
+
+var _ ControllerWithContext = &controller{}
+
 // New makes a new Controller from the given Config.
 func New(c *Config) Controller {
 	ctlr := &controller{
@@ -127,9 +142,18 @@ func New(c *Config) Controller {
 // It's an error to call Run more than once.
 // Run blocks; call via go.
 func (c *controller) Run(stopCh <-chan struct{}) {
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	c.RunWithContext(ctx)
+}
+
+// RunWithContext begins processing items, and will continue until ctx is done.
+// It's an error to call RunWithContext more than once.
+// RunWithContext blocks; call via go.
+func (c *controller) RunWithContext(ctx context.Context) {
 	defer utilruntime.HandleCrash()
 	go func() {
-		<-stopCh
+		<-ctx.Done()
 		c.config.Queue.Close()
 	}()
 	r := NewReflectorWithOptions(
@@ -154,9 +178,9 @@ func (c *controller) Run(stopCh <-chan struct{}) {
 
 	var wg wait.Group
 
-	wg.StartWithChannel(stopCh, r.Run)
+	wg.StartWithContext(ctx, r.RunWithContext)
 
-	wait.Until(c.processLoop, time.Second, stopCh)
+	wait.Until(c.processLoop, time.Second, ctx.Done())
 	wg.Wait()
 }
 
@@ -220,6 +244,33 @@ type ResourceEventHandler interface {
 	OnDelete(obj interface{})
 }
 
+// ResourceEventHandlerWithContext can be implemented in addition to
+// ResourceEventHandler by handlers which want the context of the informer
+// they are added to, for example to log through its logger. Informers then
+// call these methods instead of those of ResourceEventHandler.
+type ResourceEventHandlerWithContext interface {
+	OnAddWithContext(ctx context.Context, obj interface{}, isInInitialList bool)
+	OnUpdateWithContext(ctx context.Context, oldObj, newObj interface{})
+	OnDeleteWithContext(ctx context.Context, obj interface{})
+}
+
+// contextlessHandler calls a ResourceEventHandler without the context.
+type contextlessHandler struct {
+	handler ResourceEventHandler
+}
+
+func (h contextlessHandler) OnAddWithContext(_ context.Context, obj interface{}, isInInitialList bool) {
+	h.handler.OnAdd(obj, isInInitialList)
+}
+
+func (h contextlessHandler) OnUpdateWithContext(_ context.Context, oldObj, newObj interface{}) {
+	h.handler.OnUpdate(oldObj, newObj)
+}
+
+func (h contextlessHandler) OnDeleteWithContext(_ context.Context, obj interface{}) {
+	h.handler.OnDelete(obj)
+}
+
 // ResourceEventHandlerFuncs is an adaptor to let you easily specify as many or
 // as few of the notification functions as you want while still implementing
 // ResourceEventHandler.  This adapter does not remove the prohibition against
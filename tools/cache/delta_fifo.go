@@ -51,6 +51,10 @@ type DeltaFIFOOptions struct {
 	// When true, `Replaced` events will be sent for items passed to a Replace() call.
 	// When false, `Sync` events will be sent instead.
 	EmitDeltaTypeReplaced bool
+
+	// Logger is used for log output of the queue.
+	// Optional, the default is klog.Background().
+	Logger *klog.Logger
 }
 
 // DeltaFIFO is like FIFO, but differs in two ways.  One is that the
@@ -114,6 +118,12 @@ type DeltaFIFO struct {
 	// initialPopulationCount is the number of items inserted by the first call of Replace()
 	initialPopulationCount int
 
+	// replacingKeys are the keys queued by replacements started with
+	// StartReplace which are not done yet. A replacement is abandoned
+	// when listing fails half way, the next replacement to finish
+	// deletes the keys it did not list.
+	replacingKeys sets.String
+
 	// keyFunc is used to make the key used for queued item
 	// insertion and retrieval, and should be deterministic.
 	keyFunc KeyFunc
@@ -129,6 +139,9 @@ type DeltaFIFO struct {
 	// emitDeltaTypeReplaced is whether to emit the Replaced or Sync
 	// DeltaType when Replace() is called (to preserve backwards compat).
 	emitDeltaTypeReplaced bool
+
+	// logger is used for log output.
+	logger klog.Logger
 }
 
 // DeltaType is the type of a change (addition, deletion, etc)
@@ -227,6 +240,10 @@ func NewDeltaFIFOWithOptions(opts DeltaFIFOOptions) *DeltaFIFO {
 		knownObjects: opts.KnownObjects,
 
 		emitDeltaTypeReplaced: opts.EmitDeltaTypeReplaced,
+		logger:                klog.Background(),
+	}
+	if opts.Logger != nil {
+		f.logger = *opts.Logger
 	}
 	f.cond.L = &f.lock
 	return f
@@ -430,10 +447,10 @@ func (f *DeltaFIFO) queueActionLocked(actionType DeltaType, obj interface{}) err
 		// when given a non-empty list (as it is here).
 		// If somehow it happens anyway, deal with it but complain.
 		if oldDeltas == nil {
-			klog.Errorf("Impossible dedupDeltas for id=%q: oldDeltas=%#+v, obj=%#+v; ignoring", id, oldDeltas, obj)
+			f.logger.Error(nil, "Impossible dedupDeltas, ignoring", "id", id, "oldDeltas", oldDeltas, "obj", obj)
 			return nil
 		}
-		klog.Errorf("Impossible dedupDeltas for id=%q: oldDeltas=%#+v, obj=%#+v; breaking invariant by storing empty Deltas", id, oldDeltas, obj)
+		f.logger.Error(nil, "Impossible dedupDeltas, breaking invariant by storing empty Deltas", "id", id, "oldDeltas", oldDeltas, "obj", obj)
 		f.items[id] = newDeltas
 		return fmt.Errorf("Impossible dedupDeltas for id=%q: oldDeltas=%#+v, obj=%#+v; broke DeltaFIFO invariant by storing empty Deltas", id, oldDeltas, obj)
 	}
@@ -540,7 +557,7 @@ func (f *DeltaFIFO) Pop(process PopProcessFunc) (interface{}, error) {
 		item, ok := f.items[id]
 		if !ok {
 			// This should never happen
-			klog.Errorf("Inconceivable! %q was in f.queue but not f.items; ignoring.", id)
+			f.logger.Error(nil, "Inconceivable! Item was in f.queue but not f.items; ignoring", "id", id)
 			continue
 		}
 		delete(f.items, id)
@@ -582,12 +599,6 @@ func (f *DeltaFIFO) Replace(list []interface{}, _ string) error {
 	defer f.lock.Unlock()
 	keys := make(sets.String, len(list))
 
-	// keep backwards compat for old clients
-	action := Sync
-	if f.emitDeltaTypeReplaced {
-		action = Replaced
-	}
-
 	// Add Sync/Replaced action for each new item.
 	for _, item := range list {
 		key, err := f.KeyOf(item)
@@ -595,14 +606,42 @@ func (f *DeltaFIFO) Replace(list []interface{}, _ string) error {
 			return KeyError{item, err}
 		}
 		keys.Insert(key)
-		if err := f.queueActionLocked(action, item); err != nil {
+		if err := f.queueActionLocked(f.replaceAction(), item); err != nil {
 			return fmt.Errorf("couldn't enqueue object: %v", err)
 		}
 	}
 
+	queuedDeletions, err := f.queueReplaceDeletionsLocked(keys)
+	if err != nil {
+		return err
+	}
+
+	if !f.populated {
+		f.populated = true
+		// While there shouldn't be any queued deletions in the initial
+		// population of the queue, it's better to be on the safe side.
+		f.initialPopulationCount = keys.Len() + queuedDeletions
+	}
+
+	return nil
+}
+
+// replaceAction returns the type of the deltas queued for the items of a
+// new list.
+func (f *DeltaFIFO) replaceAction() DeltaType {
+	// keep backwards compat for old clients
+	if f.emitDeltaTypeReplaced {
+		return Replaced
+	}
+	return Sync
+}
+
+// queueReplaceDeletionsLocked queues deletions for the items which are not
+// in the new list with the given keys and returns how many it queued.
+func (f *DeltaFIFO) queueReplaceDeletionsLocked(keys sets.String) (int, error) {
+	queuedDeletions := 0
 	if f.knownObjects == nil {
 		// Do deletion detection against our own list.
-		queuedDeletions := 0
 		for k, oldItem := range f.items {
 			if keys.Has(k) {
 				continue
@@ -616,47 +655,107 @@ func (f *DeltaFIFO) Replace(list []interface{}, _ string) error {
 			}
 			queuedDeletions++
 			if err := f.queueActionLocked(Deleted, DeletedFinalStateUnknown{k, deletedObj}); err != nil {
-				return err
+				return queuedDeletions, err
 			}
 		}
+	} else {
+		// Detect deletions not already in the queue.
+		knownKeys := f.knownObjects.ListKeys()
+		for _, k := range knownKeys {
+			if keys.Has(k) {
+				continue
+			}
 
-		if !f.populated {
-			f.populated = true
-			// While there shouldn't be any queued deletions in the initial
-			// population of the queue, it's better to be on the safe side.
-			f.initialPopulationCount = keys.Len() + queuedDeletions
+			deletedObj, exists, err := f.knownObjects.GetByKey(k)
+			if err != nil {
+				deletedObj = nil
+				f.logger.Error(err, "Unexpected error during lookup, placing DeleteFinalStateUnknown marker without object", "key", k)
+			} else if !exists {
+				deletedObj = nil
+				f.logger.Info("Key does not exist in known objects store, placing DeleteFinalStateUnknown marker without object", "key", k)
+			}
+			queuedDeletions++
+			if err := f.queueActionLocked(Deleted, DeletedFinalStateUnknown{k, deletedObj}); err != nil {
+				return queuedDeletions, err
+			}
 		}
 
-		return nil
+		// Items of abandoned replacements which are still queued are
+		// not known yet, the ones which were popped are deleted above.
+		known := sets.NewString(knownKeys...)
+		for k := range f.replacingKeys {
+			oldItem, queued := f.items[k]
+			if !queued || keys.Has(k) || known.Has(k) {
+				continue
+			}
+			var deletedObj interface{}
+			if n := oldItem.Newest(); n != nil {
+				deletedObj = n.Object
+			}
+			queuedDeletions++
+			if err := f.queueActionLocked(Deleted, DeletedFinalStateUnknown{k, deletedObj}); err != nil {
+				return queuedDeletions, err
+			}
+		}
 	}
+	f.replacingKeys = nil
 
-	// Detect deletions not already in the queue.
-	knownKeys := f.knownObjects.ListKeys()
-	queuedDeletions := 0
-	for _, k := range knownKeys {
-		if keys.Has(k) {
-			continue
-		}
+	return queuedDeletions, nil
+}
 
-		deletedObj, exists, err := f.knownObjects.GetByKey(k)
-		if err != nil {
-			deletedObj = nil
-			klog.Errorf("Unexpected error %v during lookup of key %v, placing DeleteFinalStateUnknown marker without object", err, k)
-		} else if !exists {
-			deletedObj = nil
-			klog.Infof("Key %v does not exist in known objects store, placing DeleteFinalStateUnknown marker without object", k)
-		}
-		queuedDeletions++
-		if err := f.queueActionLocked(Deleted, DeletedFinalStateUnknown{k, deletedObj}); err != nil {
-			return err
-		}
+// StartReplace starts replacing the contents of the queue item by item.
+// The added items are queued right away, like in Replace, but the queue
+// only counts as populated once the replacement is done.
+func (f *DeltaFIFO) StartReplace() Replacement {
+	return &deltaFIFOReplacement{fifo: f, keys: sets.NewString()}
+}
+
+var _ StreamReplacer = &DeltaFIFO{}
+
+type deltaFIFOReplacement struct {
+	fifo *DeltaFIFO
+	keys sets.String
+}
+
+func (r *deltaFIFOReplacement) Add(obj interface{}) error {
+	f := r.fifo
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	key, err := f.KeyOf(obj)
+	if err != nil {
+		return KeyError{obj, err}
+	}
+	if _, queued := f.items[key]; !f.populated && !queued {
+		// Only items which are not queued yet, e.g. by an abandoned
+		// replacement, add to the initial population. Items popped
+		// before the replacement is done are subtracted again by Pop.
+		f.initialPopulationCount++
 	}
+	r.keys.Insert(key)
+	if f.replacingKeys == nil {
+		f.replacingKeys = sets.NewString()
+	}
+	f.replacingKeys.Insert(key)
+	if err := f.queueActionLocked(f.replaceAction(), obj); err != nil {
+		return fmt.Errorf("couldn't enqueue object: %v", err)
+	}
+	return nil
+}
 
+func (r *deltaFIFOReplacement) Done(_ string) error {
+	f := r.fifo
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	queued := len(f.queue)
+	if _, err := f.queueReplaceDeletionsLocked(r.keys); err != nil {
+		return err
+	}
 	if !f.populated {
 		f.populated = true
-		f.initialPopulationCount = keys.Len() + queuedDeletions
+		// Deletions of items which are queued already don't add to the
+		// initial population.
+		f.initialPopulationCount += len(f.queue) - queued
 	}
-
 	return nil
 }
 
@@ -683,10 +782,10 @@ func (f *DeltaFIFO) Resync() error {
 func (f *DeltaFIFO) syncKeyLocked(key string) error {
 	obj, exists, err := f.knownObjects.GetByKey(key)
 	if err != nil {
-		klog.Errorf("Unexpected error %v during lookup of key %v, unable to queue object for sync", err, key)
+		f.logger.Error(err, "Unexpected error during lookup, unable to queue object for sync", "key", key)
 		return nil
 	} else if !exists {
-		klog.Infof("Key %v does not exist in known objects store, unable to queue object for sync", key)
+		f.logger.Info("Key does not exist in known objects store, unable to queue object for sync", "key", key)
 		return nil
 	}
 
@@ -406,6 +406,99 @@ func TestDeltaFIFO_ReplaceMakesDeletions(t *testing.T) {
 
 // TestDeltaFIFO_ReplaceMakesDeletionsReplaced is the same as the above test, but
 // ensures that a Replaced DeltaType is emitted.
+func TestDeltaFIFO_StartReplace(t *testing.T) {
+	f := NewDeltaFIFOWithOptions(DeltaFIFOOptions{
+		KeyFunction: testFifoObjectKeyFunc,
+		KnownObjects: literalListerGetter(func() []testFifoObject {
+			return []testFifoObject{mkFifoObj("foo", 5), mkFifoObj("bar", 6)}
+		}),
+		EmitDeltaTypeReplaced: true,
+	})
+
+	replacement := f.StartReplace()
+	if err := replacement.Add(mkFifoObj("foo", 7)); err != nil {
+		t.Fatal(err)
+	}
+	// Items are queued before the replacement is done.
+	if e, a := (Deltas{{Replaced, mkFifoObj("foo", 7)}}), Pop(f).(Deltas); !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %#v, got %#v", e, a)
+	}
+	if f.HasSynced() {
+		t.Errorf("Expected HasSynced to be false before the replacement is done")
+	}
+	if err := replacement.Add(mkFifoObj("baz", 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := replacement.Done("0"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedList := []Deltas{
+		{{Replaced, mkFifoObj("baz", 8)}},
+		// "bar" was not added, so it should get a tombstone.
+		{{Deleted, DeletedFinalStateUnknown{Key: "bar", Obj: mkFifoObj("bar", 6)}}},
+	}
+	for _, expected := range expectedList {
+		if f.HasSynced() {
+			t.Errorf("Expected HasSynced to be false before the list is popped")
+		}
+		cur := Pop(f).(Deltas)
+		if e, a := expected, cur; !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected %#v, got %#v", e, a)
+		}
+	}
+	if !f.HasSynced() {
+		t.Errorf("Expected HasSynced to be true")
+	}
+}
+
+func TestDeltaFIFO_StartReplaceAbandoned(t *testing.T) {
+	f := NewDeltaFIFOWithOptions(DeltaFIFOOptions{
+		KeyFunction: testFifoObjectKeyFunc,
+		KnownObjects: literalListerGetter(func() []testFifoObject {
+			return []testFifoObject{mkFifoObj("old", 5)}
+		}),
+		EmitDeltaTypeReplaced: true,
+	})
+
+	// The first list fails half way.
+	abandoned := f.StartReplace()
+	for _, obj := range []testFifoObject{mkFifoObj("a", 6), mkFifoObj("b", 6)} {
+		if err := abandoned.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	replacement := f.StartReplace()
+	for _, obj := range []testFifoObject{mkFifoObj("a", 7), mkFifoObj("c", 7)} {
+		if err := replacement.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := replacement.Done("0"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedList := []Deltas{
+		{{Replaced, mkFifoObj("a", 6)}, {Replaced, mkFifoObj("a", 7)}},
+		// "b" was only added by the abandoned replacement.
+		{{Replaced, mkFifoObj("b", 6)}, {Deleted, DeletedFinalStateUnknown{Key: "b", Obj: mkFifoObj("b", 6)}}},
+		{{Replaced, mkFifoObj("c", 7)}},
+		{{Deleted, DeletedFinalStateUnknown{Key: "old", Obj: mkFifoObj("old", 5)}}},
+	}
+	for _, expected := range expectedList {
+		if f.HasSynced() {
+			t.Errorf("Expected HasSynced to be false before the list is popped")
+		}
+		cur := Pop(f).(Deltas)
+		if e, a := expected, cur; !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected %#v, got %#v", e, a)
+		}
+	}
+	if !f.HasSynced() {
+		t.Errorf("Expected HasSynced to be true")
+	}
+}
+
 func TestDeltaFIFO_ReplaceMakesDeletionsReplaced(t *testing.T) {
 	f := NewDeltaFIFOWithOptions(DeltaFIFOOptions{
 		KeyFunction: testFifoObjectKeyFunc,
@@ -0,0 +1,423 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// ignoredMetadataFields lists the metadata fields that change on every write
+// and are therefore never reported by FieldChangeHandler.
+var ignoredMetadataFields = []string{"resourceVersion", "managedFields"}
+
+// FieldChangeHandlerFuncs are the notification functions invoked by a
+// FieldChangeHandler. Any of them may be nil. Like the handlers, they
+// MUST NOT modify the objects they are given.
+type FieldChangeHandlerFuncs struct {
+	AddFunc func(obj interface{}, isInInitialList bool)
+	// UpdateFunc is called with the sorted list of field paths that differ
+	// between oldObj and newObj, see DiffFieldPaths for the format.
+	UpdateFunc func(oldObj, newObj interface{}, changedPaths []string)
+	DeleteFunc func(obj interface{})
+}
+
+// FieldChangeHandler is a ResourceEventHandler that computes which fields
+// changed on every update and only forwards updates that are of interest.
+// Updates which only touch metadata.resourceVersion or metadata.managedFields,
+// including the no-op updates delivered on resync, are always dropped. When
+// subscription paths are given, an update is only forwarded if the value
+// selected by at least one of them differs between the old and new object.
+// Adds and deletes are forwarded unconditionally.
+type FieldChangeHandler struct {
+	funcs    FieldChangeHandlerFuncs
+	patterns []FieldPathPattern
+}
+
+var _ ResourceEventHandler = &FieldChangeHandler{}
+
+// NewFieldChangeHandler returns a FieldChangeHandler which notifies funcs of
+// updates that change a field selected by one of paths, or of any field when
+// no paths are given. See ParseFieldPathPattern for the path syntax.
+func NewFieldChangeHandler(funcs FieldChangeHandlerFuncs, paths ...string) (*FieldChangeHandler, error) {
+	h := &FieldChangeHandler{funcs: funcs}
+	for _, path := range paths {
+		pattern, err := ParseFieldPathPattern(path)
+		if err != nil {
+			return nil, err
+		}
+		h.patterns = append(h.patterns, pattern)
+	}
+	return h, nil
+}
+
+// OnAdd calls AddFunc if it's not nil.
+func (h *FieldChangeHandler) OnAdd(obj interface{}, isInInitialList bool) {
+	if h.funcs.AddFunc != nil {
+		h.funcs.AddFunc(obj, isInInitialList)
+	}
+}
+
+// OnUpdate calls UpdateFunc if a subscribed field changed.
+func (h *FieldChangeHandler) OnUpdate(oldObj, newObj interface{}) {
+	if h.funcs.UpdateFunc == nil {
+		return
+	}
+	oldContent, err := fieldChangeContent(oldObj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		h.funcs.UpdateFunc(oldObj, newObj, nil)
+		return
+	}
+	newContent, err := fieldChangeContent(newObj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		h.funcs.UpdateFunc(oldObj, newObj, nil)
+		return
+	}
+	changed := diffFieldPaths(oldContent, newContent)
+	if len(changed) == 0 {
+		return
+	}
+	if len(h.patterns) > 0 {
+		matched := false
+		for _, pattern := range h.patterns {
+			if pattern.changed(oldContent, newContent) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return
+		}
+	}
+	h.funcs.UpdateFunc(oldObj, newObj, changed)
+}
+
+// OnDelete calls DeleteFunc if it's not nil.
+func (h *FieldChangeHandler) OnDelete(obj interface{}) {
+	if h.funcs.DeleteFunc != nil {
+		h.funcs.DeleteFunc(obj)
+	}
+}
+
+// DiffFieldPaths returns the sorted paths of the fields that differ between
+// oldObj and newObj, ignoring metadata.resourceVersion and
+// metadata.managedFields. Paths are dot separated field names; list elements
+// are addressed by index, e.g. "spec.containers[0].image", and map keys which
+// contain '.' or '[' are enclosed in brackets, e.g.
+// "metadata.labels[app.kubernetes.io/name]". A field which only exists on one
+// side is reported as a single path without descending into it.
+func DiffFieldPaths(oldObj, newObj interface{}) ([]string, error) {
+	oldContent, err := fieldChangeContent(oldObj)
+	if err != nil {
+		return nil, err
+	}
+	newContent, err := fieldChangeContent(newObj)
+	if err != nil {
+		return nil, err
+	}
+	return diffFieldPaths(oldContent, newContent), nil
+}
+
+// fieldChangeContent returns the unstructured content of obj with the
+// ignored fields removed. The object itself is not modified.
+func fieldChangeContent(obj interface{}) (map[string]interface{}, error) {
+	var content map[string]interface{}
+	switch t := obj.(type) {
+	case runtime.Unstructured:
+		content = t.UnstructuredContent()
+	case nil:
+		return nil, fmt.Errorf("cannot compute field changes of a nil object")
+	default:
+		var err error
+		content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compute field changes of %T: %v", obj, err)
+		}
+	}
+	return withoutIgnoredFields(content), nil
+}
+
+// withoutIgnoredFields returns a shallow copy of content that omits the
+// ignored fields, copying only the maps on the way to them.
+func withoutIgnoredFields(content map[string]interface{}) map[string]interface{} {
+	metadata, ok := content["metadata"].(map[string]interface{})
+	if !ok {
+		return content
+	}
+	strippedMetadata := make(map[string]interface{}, len(metadata))
+	for k, v := range metadata {
+		strippedMetadata[k] = v
+	}
+	for _, field := range ignoredMetadataFields {
+		delete(strippedMetadata, field)
+	}
+	stripped := make(map[string]interface{}, len(content))
+	for k, v := range content {
+		stripped[k] = v
+	}
+	stripped["metadata"] = strippedMetadata
+	return stripped
+}
+
+func diffFieldPaths(oldContent, newContent map[string]interface{}) []string {
+	var changed []string
+	diffValues("", oldContent, newContent, &changed)
+	sort.Strings(changed)
+	return changed
+}
+
+func diffValues(path string, oldValue, newValue interface{}, changed *[]string) {
+	switch o := oldValue.(type) {
+	case map[string]interface{}:
+		n, ok := newValue.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k, ov := range o {
+			nv, found := n[k]
+			if !found {
+				*changed = append(*changed, fieldPathChild(path, k))
+				continue
+			}
+			diffValues(fieldPathChild(path, k), ov, nv, changed)
+		}
+		for k := range n {
+			if _, found := o[k]; !found {
+				*changed = append(*changed, fieldPathChild(path, k))
+			}
+		}
+		return
+	case []interface{}:
+		n, ok := newValue.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			elemPath := path + "[" + strconv.Itoa(i) + "]"
+			if i >= len(o) || i >= len(n) {
+				*changed = append(*changed, elemPath)
+				continue
+			}
+			diffValues(elemPath, o[i], n[i], changed)
+		}
+		return
+	}
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changed = append(*changed, path)
+	}
+}
+
+func fieldPathChild(path, key string) string {
+	if strings.ContainsAny(key, ".[]") {
+		return path + "[" + key + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// FieldPathPattern selects zero or more fields of an object. It is created
+// by ParseFieldPathPattern.
+type FieldPathPattern struct {
+	path     string
+	segments []fieldPathSegment
+}
+
+type fieldPathSegmentKind int
+
+const (
+	// fieldSegment selects a map entry by key.
+	fieldSegment fieldPathSegmentKind = iota
+	// wildcardSegment selects every map entry or list element.
+	wildcardSegment
+	// indexSegment selects a list element by index.
+	indexSegment
+	// matchSegment selects the list elements which are maps having a
+	// given string value for a given key.
+	matchSegment
+)
+
+type fieldPathSegment struct {
+	kind  fieldPathSegmentKind
+	key   string
+	value string
+	index int
+}
+
+// String returns the pattern as it was parsed.
+func (p FieldPathPattern) String() string {
+	return p.path
+}
+
+// ParseFieldPathPattern parses a field path pattern. A pattern is a dot
+// separated list of field names, each optionally followed by one or more
+// bracketed selectors:
+//
+//	spec.replicas                      a single field
+//	spec.*                             every field of spec
+//	metadata.labels[app.kubernetes.io/name]  a map key containing dots
+//	spec.containers[0].image           a list element by index
+//	spec.containers[*].image           every list element
+//	status.conditions[type=Ready]      the list elements whose "type" is "Ready"
+//
+// A pattern is considered changed when the set of values it selects differs
+// between the old and the new object, so a pattern naming a map or list
+// matches changes anywhere beneath it.
+func ParseFieldPathPattern(path string) (FieldPathPattern, error) {
+	p := FieldPathPattern{path: path}
+	rest := path
+	for {
+		end := strings.IndexAny(rest, ".[]")
+		if end < 0 {
+			end = len(rest)
+		}
+		switch name := rest[:end]; name {
+		case "":
+			return FieldPathPattern{}, fmt.Errorf("invalid field path %q: empty field name", path)
+		case "*":
+			p.segments = append(p.segments, fieldPathSegment{kind: wildcardSegment})
+		default:
+			p.segments = append(p.segments, fieldPathSegment{kind: fieldSegment, key: name})
+		}
+		rest = rest[end:]
+		for strings.HasPrefix(rest, "[") {
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return FieldPathPattern{}, fmt.Errorf("invalid field path %q: unterminated '['", path)
+			}
+			segment, err := parseFieldPathSelector(rest[1:end])
+			if err != nil {
+				return FieldPathPattern{}, fmt.Errorf("invalid field path %q: %v", path, err)
+			}
+			p.segments = append(p.segments, segment)
+			rest = rest[end+1:]
+		}
+		if rest == "" {
+			break
+		}
+		if rest[0] != '.' {
+			return FieldPathPattern{}, fmt.Errorf("invalid field path %q: unexpected %q", path, rest[0])
+		}
+		rest = rest[1:]
+	}
+	return p, nil
+}
+
+func parseFieldPathSelector(selector string) (fieldPathSegment, error) {
+	if selector == "" {
+		return fieldPathSegment{}, fmt.Errorf("empty selector")
+	}
+	if selector == "*" {
+		return fieldPathSegment{kind: wildcardSegment}, nil
+	}
+	if i := strings.IndexByte(selector, '='); i >= 0 {
+		if i == 0 {
+			return fieldPathSegment{}, fmt.Errorf("empty key in selector %q", selector)
+		}
+		return fieldPathSegment{kind: matchSegment, key: selector[:i], value: selector[i+1:]}, nil
+	}
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 0 {
+			return fieldPathSegment{}, fmt.Errorf("negative index in selector %q", selector)
+		}
+		return fieldPathSegment{kind: indexSegment, index: index}, nil
+	}
+	return fieldPathSegment{kind: fieldSegment, key: selector}, nil
+}
+
+// changed reports whether the values selected by p differ between the two
+// objects.
+func (p FieldPathPattern) changed(oldContent, newContent map[string]interface{}) bool {
+	oldValues := map[string]interface{}{}
+	newValues := map[string]interface{}{}
+	p.selectValues("", oldContent, 0, oldValues)
+	p.selectValues("", newContent, 0, newValues)
+	if len(oldValues) != len(newValues) {
+		return true
+	}
+	for path, oldValue := range oldValues {
+		newValue, ok := newValues[path]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectValues collects the values selected by the segments of p starting at
+// i, keyed by their concrete path within the object.
+func (p FieldPathPattern) selectValues(path string, value interface{}, i int, into map[string]interface{}) {
+	if i == len(p.segments) {
+		into[path] = value
+		return
+	}
+	segment := p.segments[i]
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch segment.kind {
+		case fieldSegment:
+			if child, ok := v[segment.key]; ok {
+				p.selectValues(fieldPathChild(path, segment.key), child, i+1, into)
+			}
+		case indexSegment:
+			// A bracketed numeric map key, e.g. data[0].
+			key := strconv.Itoa(segment.index)
+			if child, ok := v[key]; ok {
+				p.selectValues(fieldPathChild(path, key), child, i+1, into)
+			}
+		case wildcardSegment:
+			for k, child := range v {
+				p.selectValues(fieldPathChild(path, k), child, i+1, into)
+			}
+		}
+	case []interface{}:
+		for index, child := range v {
+			switch segment.kind {
+			case wildcardSegment:
+			case indexSegment:
+				if index != segment.index {
+					continue
+				}
+			case matchSegment:
+				elem, ok := child.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if key, found := elem[segment.key]; !found || fmt.Sprint(key) != segment.value {
+					continue
+				}
+				// Elements selected by key are identified by that key
+				// rather than by their position, so reordering the list
+				// does not count as a change.
+				p.selectValues(path+"["+segment.key+"="+segment.value+"]", child, i+1, into)
+				continue
+			default:
+				continue
+			}
+			p.selectValues(path+"["+strconv.Itoa(index)+"]", child, i+1, into)
+		}
+	}
+}
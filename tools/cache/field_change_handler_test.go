@@ -0,0 +1,269 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func fieldChangeTestPod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "pod",
+			Namespace:       "ns",
+			ResourceVersion: "1",
+			Labels:          map[string]string{"app.kubernetes.io/name": "web"},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "c", Image: "image:1"}},
+		},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{
+				{Type: v1.PodScheduled, Status: v1.ConditionTrue},
+				{Type: v1.PodReady, Status: v1.ConditionFalse},
+			},
+		},
+	}
+}
+
+func TestDiffFieldPaths(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*v1.Pod)
+		want   []string
+	}{
+		{
+			name:   "no change",
+			mutate: func(*v1.Pod) {},
+		},
+		{
+			name: "ignored fields only",
+			mutate: func(pod *v1.Pod) {
+				pod.ResourceVersion = "2"
+				pod.ManagedFields = []metav1.ManagedFieldsEntry{{Manager: "test"}}
+			},
+		},
+		{
+			name:   "container image",
+			mutate: func(pod *v1.Pod) { pod.Spec.Containers[0].Image = "image:2" },
+			want:   []string{"spec.containers[0].image"},
+		},
+		{
+			name:   "label key with dots",
+			mutate: func(pod *v1.Pod) { pod.Labels["app.kubernetes.io/name"] = "db" },
+			want:   []string{"metadata.labels[app.kubernetes.io/name]"},
+		},
+		{
+			name: "added and removed fields",
+			mutate: func(pod *v1.Pod) {
+				pod.Labels = nil
+				pod.Spec.NodeName = "node"
+				pod.Status.Conditions = pod.Status.Conditions[:1]
+			},
+			want: []string{"metadata.labels", "spec.nodeName", "status.conditions[1]"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oldPod := fieldChangeTestPod()
+			newPod := fieldChangeTestPod()
+			test.mutate(newPod)
+			got, err := DiffFieldPaths(oldPod, newPod)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseFieldPathPattern(t *testing.T) {
+	valid := []string{
+		"spec",
+		"spec.*",
+		"metadata.labels",
+		"metadata.labels[app.kubernetes.io/name]",
+		"spec.containers[0].image",
+		"spec.containers[*].image",
+		"status.conditions[type=Ready].status",
+	}
+	for _, path := range valid {
+		p, err := ParseFieldPathPattern(path)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", path, err)
+			continue
+		}
+		if p.String() != path {
+			t.Errorf("%q: unexpected String() %q", path, p.String())
+		}
+	}
+	invalid := []string{
+		"",
+		".spec",
+		"spec.",
+		"spec..replicas",
+		"spec[",
+		"spec[]",
+		"spec[=x]",
+		"spec[-1]",
+		"spec]",
+		"spec[0]image",
+	}
+	for _, path := range invalid {
+		if _, err := ParseFieldPathPattern(path); err == nil {
+			t.Errorf("%q: expected error", path)
+		}
+	}
+}
+
+func TestFieldChangeHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		paths      []string
+		mutate     func(*v1.Pod)
+		wantCalled bool
+	}{
+		{
+			name:   "resync is dropped",
+			mutate: func(*v1.Pod) {},
+		},
+		{
+			name:   "resourceVersion bump is dropped",
+			mutate: func(pod *v1.Pod) { pod.ResourceVersion = "2" },
+		},
+		{
+			name:       "any change without subscriptions",
+			mutate:     func(pod *v1.Pod) { pod.Spec.NodeName = "node" },
+			wantCalled: true,
+		},
+		{
+			name:       "spec wildcard",
+			paths:      []string{"spec.*"},
+			mutate:     func(pod *v1.Pod) { pod.Spec.Containers[0].Image = "image:2" },
+			wantCalled: true,
+		},
+		{
+			name:   "spec wildcard ignores status",
+			paths:  []string{"spec.*"},
+			mutate: func(pod *v1.Pod) { pod.Status.Phase = v1.PodRunning },
+		},
+		{
+			name:       "labels",
+			paths:      []string{"metadata.labels"},
+			mutate:     func(pod *v1.Pod) { pod.Labels["tier"] = "frontend" },
+			wantCalled: true,
+		},
+		{
+			name:  "labels ignore annotations",
+			paths: []string{"metadata.labels"},
+			mutate: func(pod *v1.Pod) {
+				pod.ResourceVersion = "2"
+				pod.Annotations = map[string]string{"a": "b"}
+			},
+		},
+		{
+			name:       "ready condition",
+			paths:      []string{"status.conditions[type=Ready]"},
+			mutate:     func(pod *v1.Pod) { pod.Status.Conditions[1].Status = v1.ConditionTrue },
+			wantCalled: true,
+		},
+		{
+			name:   "other condition",
+			paths:  []string{"status.conditions[type=Ready]"},
+			mutate: func(pod *v1.Pod) { pod.Status.Conditions[0].Status = v1.ConditionFalse },
+		},
+		{
+			name:  "reordered conditions",
+			paths: []string{"status.conditions[type=Ready]"},
+			mutate: func(pod *v1.Pod) {
+				c := pod.Status.Conditions
+				c[0], c[1] = c[1], c[0]
+			},
+		},
+		{
+			name:       "ready condition removed",
+			paths:      []string{"status.conditions[type=Ready]"},
+			mutate:     func(pod *v1.Pod) { pod.Status.Conditions = pod.Status.Conditions[:1] },
+			wantCalled: true,
+		},
+		{
+			name:       "one of several subscriptions",
+			paths:      []string{"metadata.labels", "spec.containers[*].image"},
+			mutate:     func(pod *v1.Pod) { pod.Spec.Containers[0].Image = "image:2" },
+			wantCalled: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			called := false
+			var changedPaths []string
+			h, err := NewFieldChangeHandler(FieldChangeHandlerFuncs{
+				UpdateFunc: func(oldObj, newObj interface{}, changed []string) {
+					called = true
+					changedPaths = changed
+				},
+			}, test.paths...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			oldPod := fieldChangeTestPod()
+			newPod := fieldChangeTestPod()
+			test.mutate(newPod)
+			h.OnUpdate(oldPod, newPod)
+			if called != test.wantCalled {
+				t.Fatalf("expected called=%v, got %v", test.wantCalled, called)
+			}
+			if called && len(changedPaths) == 0 {
+				t.Errorf("expected changed paths to be reported")
+			}
+		})
+	}
+}
+
+func TestFieldChangeHandlerUnstructured(t *testing.T) {
+	var changedPaths []string
+	h, err := NewFieldChangeHandler(FieldChangeHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}, changed []string) {
+			changedPaths = changed
+		},
+	}, "spec.replicas")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	oldObj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "foo", "resourceVersion": "1"},
+		"spec":     map[string]interface{}{"replicas": int64(1)},
+	}}
+	newObj := oldObj.DeepCopy()
+	newObj.Object["spec"].(map[string]interface{})["replicas"] = int64(2)
+	newObj.SetResourceVersion("2")
+
+	h.OnUpdate(oldObj, newObj)
+	if want := []string{"spec.replicas"}; !reflect.DeepEqual(changedPaths, want) {
+		t.Errorf("expected %v, got %v", want, changedPaths)
+	}
+	if oldObj.GetResourceVersion() != "1" || newObj.GetResourceVersion() != "2" {
+		t.Errorf("handler modified the objects")
+	}
+}
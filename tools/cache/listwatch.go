@@ -24,6 +24,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/pager"
 )
 
 // Lister is any object that knows how to perform an initial list.
@@ -45,6 +46,15 @@ type ListerWatcher interface {
 	Watcher
 }
 
+// ListStreamer is implemented by ListerWatchers which can list items one at a
+// time. The Reflector prefers ListStream over List, so that whole lists are
+// never materialized.
+type ListStreamer interface {
+	// ListStream calls fn for every item of the list for the given options
+	// and returns the ListMeta of the list.
+	ListStream(ctx context.Context, options metav1.ListOptions, fn func(item runtime.Object) error) (*metav1.ListMeta, error)
+}
+
 // ListFunc knows how to list resources
 type ListFunc func(options metav1.ListOptions) (runtime.Object, error)
 
@@ -99,6 +109,41 @@ func NewFilteredListWatchFromClient(c Getter, resource string, namespace string,
 	return &ListWatch{ListFunc: listFunc, WatchFunc: watchFunc}
 }
 
+// StreamingListWatch is a ListWatch which can also list items one at a time.
+// It satisfies the ListerWatcher and ListStreamer interfaces.
+type StreamingListWatch struct {
+	ListWatch
+	ListStreamFunc pager.ListStreamFunc
+}
+
+// NewStreamingListWatchFromClient creates a new StreamingListWatch from the
+// specified client, resource, namespace, and option modifier, like
+// NewFilteredListWatchFromClient. Lists are decoded item by item with
+// rest.Request.StreamList, which requires JSON or protobuf responses.
+func NewStreamingListWatchFromClient(c Getter, resource string, namespace string, optionsModifier func(options *metav1.ListOptions)) *StreamingListWatch {
+	listStreamFunc := func(ctx context.Context, options metav1.ListOptions, fn func(item runtime.Object) error) (*metav1.ListMeta, error) {
+		optionsModifier(&options)
+		return c.Get().
+			Namespace(namespace).
+			Resource(resource).
+			VersionedParams(&options, metav1.ParameterCodec).
+			StreamList(ctx, fn)
+	}
+	return &StreamingListWatch{
+		ListWatch:      *NewFilteredListWatchFromClient(c, resource, namespace, optionsModifier),
+		ListStreamFunc: listStreamFunc,
+	}
+}
+
+// ListStream lists a set of apiserver resources and calls fn for every item
+// as soon as it is decoded. The Reflector passes the items on to its store,
+// item by item if the store is a StreamReplacer. If options.Limit is set,
+// only one chunk is listed and the Reflector requests the next ones with the
+// returned continue token, like it does for paginated calls of List.
+func (lw *StreamingListWatch) ListStream(ctx context.Context, options metav1.ListOptions, fn func(item runtime.Object) error) (*metav1.ListMeta, error) {
+	return lw.ListStreamFunc(ctx, options, fn)
+}
+
 // List a set of apiserver resources
 func (lw *ListWatch) List(options metav1.ListOptions) (runtime.Object, error) {
 	// ListWatch is used in Reflector, which already supports pagination.
@@ -0,0 +1,479 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// OwnerGraphNode identifies an object in an OwnerGraph.
+type OwnerGraphNode struct {
+	UID        types.UID
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+	// Observed is true if the object was delivered by one of the informers
+	// of the graph. Nodes which are only known from the owner references of
+	// other objects are not observed; their Namespace is the namespace of
+	// the first dependent seen referencing them.
+	Observed bool
+}
+
+// OwnerGraphEventType is the type of an OwnerGraphEvent.
+type OwnerGraphEventType string
+
+const (
+	// DependentAdded is emitted when an object gains an owner reference to
+	// the owner, including when the object itself is added.
+	DependentAdded OwnerGraphEventType = "DependentAdded"
+	// DependentUpdated is emitted when an object which keeps its owner
+	// reference to the owner is updated.
+	DependentUpdated OwnerGraphEventType = "DependentUpdated"
+	// DependentRemoved is emitted when an object loses its owner reference
+	// to the owner, including when the object itself is deleted.
+	DependentRemoved OwnerGraphEventType = "DependentRemoved"
+)
+
+// OwnerGraphEvent notifies an OwnerGraphEventHandlerFunc of a change to the
+// dependents of Owner.
+type OwnerGraphEvent struct {
+	Type      OwnerGraphEventType
+	Owner     OwnerGraphNode
+	Dependent OwnerGraphNode
+	// Object is the latest state of the dependent as delivered by its
+	// informer, which may be a DeletedFinalStateUnknown for removals.
+	Object interface{}
+}
+
+// OwnerGraphEventHandlerFunc is called for every OwnerGraphEvent. Like
+// ResourceEventHandler functions, it MUST NOT modify the objects it
+// receives.
+type OwnerGraphEventHandlerFunc func(event OwnerGraphEvent)
+
+// DanglingOwnerReference is an owner reference to an object which does not
+// exist, as seen by an OwnerGraph.
+type DanglingOwnerReference struct {
+	Dependent      OwnerGraphNode
+	OwnerReference metav1.OwnerReference
+}
+
+// OwnerGraph maintains the owner/dependent relationships between the objects
+// of several informers, keyed by UID. Objects are connected by their
+// metadata.ownerReferences regardless of which informer delivered them, so
+// chains such as Deployment->ReplicaSet->Pod or chains of custom resources
+// can be followed in both directions once the informers of all involved
+// types have been added with AddInformer.
+//
+// OwnerGraph is safe for concurrent use.
+type OwnerGraph struct {
+	lock  sync.RWMutex
+	nodes map[types.UID]*ownerGraphEntry
+	// informers holds the HasSynced of the handler registration for each
+	// group kind with an informer, for detecting dangling references.
+	informers map[schema.GroupKind]func() bool
+	handlers  []OwnerGraphEventHandlerFunc
+}
+
+type ownerGraphEntry struct {
+	node       OwnerGraphNode
+	owners     []metav1.OwnerReference
+	dependents map[types.UID]struct{}
+}
+
+// NewOwnerGraph returns an empty OwnerGraph.
+func NewOwnerGraph() *OwnerGraph {
+	return &OwnerGraph{
+		nodes:     map[types.UID]*ownerGraphEntry{},
+		informers: map[schema.GroupKind]func() bool{},
+	}
+}
+
+// AddInformer adds the objects of informer, which must hold objects of kind
+// gvk, to the graph. Informers usually do not populate the TypeMeta of typed
+// objects, which is why the kind has to be supplied.
+func (g *OwnerGraph) AddInformer(gvk schema.GroupVersionKind, informer SharedInformer) (ResourceEventHandlerRegistration, error) {
+	handler := &ownerGraphInformerHandler{graph: g, gvk: gvk}
+	registration, err := informer.AddEventHandler(handler)
+	if err != nil {
+		return nil, err
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.informers[gvk.GroupKind()] = registration.HasSynced
+	return registration, nil
+}
+
+// AddEventHandler adds a function which is called synchronously, in the
+// goroutine delivering the informer notification, for every change to the
+// dependents of an object.
+func (g *OwnerGraph) AddEventHandler(handler OwnerGraphEventHandlerFunc) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.handlers = append(g.handlers, handler)
+}
+
+// Get returns the node with the given UID.
+func (g *OwnerGraph) Get(uid types.UID) (OwnerGraphNode, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	entry, ok := g.nodes[uid]
+	if !ok {
+		return OwnerGraphNode{}, false
+	}
+	return entry.node, true
+}
+
+// Owners returns the direct owners of the object with the given UID.
+func (g *OwnerGraph) Owners(uid types.UID) []OwnerGraphNode {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	entry, ok := g.nodes[uid]
+	if !ok {
+		return nil
+	}
+	var owners []OwnerGraphNode
+	for _, ref := range entry.owners {
+		if owner, ok := g.nodes[ref.UID]; ok {
+			owners = append(owners, owner.node)
+		}
+	}
+	return owners
+}
+
+// Dependents returns the direct dependents of the object with the given UID,
+// sorted by UID.
+func (g *OwnerGraph) Dependents(uid types.UID) []OwnerGraphNode {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	entry, ok := g.nodes[uid]
+	if !ok {
+		return nil
+	}
+	return g.sortedNodesLocked(entry.dependents)
+}
+
+// Descendants returns all transitive dependents of the object with the given
+// UID, sorted by UID.
+func (g *OwnerGraph) Descendants(uid types.UID) []OwnerGraphNode {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	visited := map[types.UID]struct{}{}
+	g.walkLocked(uid, visited, func(entry *ownerGraphEntry) []types.UID {
+		var next []types.UID
+		for dependent := range entry.dependents {
+			next = append(next, dependent)
+		}
+		return next
+	})
+	return g.sortedNodesLocked(visited)
+}
+
+// Ancestors returns all transitive owners of the object with the given UID,
+// sorted by UID.
+func (g *OwnerGraph) Ancestors(uid types.UID) []OwnerGraphNode {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	visited := map[types.UID]struct{}{}
+	g.walkLocked(uid, visited, func(entry *ownerGraphEntry) []types.UID {
+		var next []types.UID
+		for _, ref := range entry.owners {
+			next = append(next, ref.UID)
+		}
+		return next
+	})
+	return g.sortedNodesLocked(visited)
+}
+
+// ControllerChain returns the chain of controlling owners of the object with
+// the given UID, starting with its controller and ending with the first
+// object which has no controller, e.g. the ReplicaSet and then the
+// Deployment of a Pod. The chain stops early at an owner which has not been
+// observed, as its own owners are unknown.
+func (g *OwnerGraph) ControllerChain(uid types.UID) []OwnerGraphNode {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	var chain []OwnerGraphNode
+	visited := map[types.UID]struct{}{uid: {}}
+	for {
+		entry, ok := g.nodes[uid]
+		if !ok {
+			return chain
+		}
+		ref := controllerRef(entry.owners)
+		if ref == nil {
+			return chain
+		}
+		if _, seen := visited[ref.UID]; seen {
+			// Owner references form a cycle.
+			return chain
+		}
+		visited[ref.UID] = struct{}{}
+		owner, ok := g.nodes[ref.UID]
+		if !ok {
+			return chain
+		}
+		chain = append(chain, owner.node)
+		if !owner.node.Observed {
+			return chain
+		}
+		uid = ref.UID
+	}
+}
+
+// DanglingOwnerReferences returns the owner references, of all observed
+// objects, to owners which do not exist. A reference is only reported once
+// the informer for the kind of the owner has delivered its initial list, so
+// references to kinds without an informer are never reported. Results are
+// sorted by dependent UID.
+func (g *OwnerGraph) DanglingOwnerReferences() []DanglingOwnerReference {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	var dangling []DanglingOwnerReference
+	for _, entry := range g.nodes {
+		if !entry.node.Observed {
+			continue
+		}
+		for _, ref := range entry.owners {
+			gv, err := schema.ParseGroupVersion(ref.APIVersion)
+			if err != nil {
+				continue
+			}
+			hasSynced, ok := g.informers[gv.WithKind(ref.Kind).GroupKind()]
+			if !ok || !hasSynced() {
+				continue
+			}
+			if owner, ok := g.nodes[ref.UID]; ok && owner.node.Observed {
+				continue
+			}
+			dangling = append(dangling, DanglingOwnerReference{Dependent: entry.node, OwnerReference: ref})
+		}
+	}
+	sort.Slice(dangling, func(i, j int) bool {
+		if dangling[i].Dependent.UID != dangling[j].Dependent.UID {
+			return dangling[i].Dependent.UID < dangling[j].Dependent.UID
+		}
+		return dangling[i].OwnerReference.UID < dangling[j].OwnerReference.UID
+	})
+	return dangling
+}
+
+func (g *OwnerGraph) walkLocked(uid types.UID, visited map[types.UID]struct{}, next func(*ownerGraphEntry) []types.UID) {
+	queue := []types.UID{uid}
+	for len(queue) > 0 {
+		entry, ok := g.nodes[queue[0]]
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+		for _, n := range next(entry) {
+			if _, seen := visited[n]; seen || n == uid {
+				continue
+			}
+			visited[n] = struct{}{}
+			queue = append(queue, n)
+		}
+	}
+}
+
+func (g *OwnerGraph) sortedNodesLocked(uids map[types.UID]struct{}) []OwnerGraphNode {
+	nodes := make([]OwnerGraphNode, 0, len(uids))
+	for uid := range uids {
+		if entry, ok := g.nodes[uid]; ok {
+			nodes = append(nodes, entry.node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].UID < nodes[j].UID })
+	return nodes
+}
+
+// upsert records the current state of an observed object.
+func (g *OwnerGraph) upsert(gvk schema.GroupVersionKind, obj interface{}) {
+	metadata, err := meta.Accessor(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	apiVersion, kind := gvk.ToAPIVersionAndKind()
+	node := OwnerGraphNode{
+		UID:        metadata.GetUID(),
+		APIVersion: apiVersion,
+		Kind:       kind,
+		Namespace:  metadata.GetNamespace(),
+		Name:       metadata.GetName(),
+		Observed:   true,
+	}
+	owners := metadata.GetOwnerReferences()
+
+	g.lock.Lock()
+	entry, ok := g.nodes[node.UID]
+	if !ok {
+		entry = &ownerGraphEntry{dependents: map[types.UID]struct{}{}}
+		g.nodes[node.UID] = entry
+	}
+	oldOwners := entry.owners
+	entry.node = node
+	entry.owners = owners
+
+	var events []OwnerGraphEvent
+	for _, ref := range oldOwners {
+		if !hasOwnerUID(owners, ref.UID) {
+			if owner := g.removeDependentLocked(ref.UID, node.UID); owner != nil {
+				events = append(events, OwnerGraphEvent{Type: DependentRemoved, Owner: *owner, Dependent: node, Object: obj})
+			}
+		}
+	}
+	for _, ref := range owners {
+		eventType := DependentUpdated
+		if !hasOwnerUID(oldOwners, ref.UID) {
+			eventType = DependentAdded
+		}
+		owner := g.addDependentLocked(ref, node)
+		events = append(events, OwnerGraphEvent{Type: eventType, Owner: owner, Dependent: node, Object: obj})
+	}
+	handlers := g.handlers
+	g.lock.Unlock()
+
+	g.notify(handlers, events)
+}
+
+// remove records the deletion of an observed object.
+func (g *OwnerGraph) remove(obj interface{}) {
+	final := obj
+	if d, ok := obj.(DeletedFinalStateUnknown); ok {
+		final = d.Obj
+	}
+	metadata, err := meta.Accessor(final)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	uid := metadata.GetUID()
+
+	g.lock.Lock()
+	entry, ok := g.nodes[uid]
+	if !ok {
+		g.lock.Unlock()
+		return
+	}
+	var events []OwnerGraphEvent
+	for _, ref := range entry.owners {
+		if owner := g.removeDependentLocked(ref.UID, uid); owner != nil {
+			events = append(events, OwnerGraphEvent{Type: DependentRemoved, Owner: *owner, Dependent: entry.node, Object: obj})
+		}
+	}
+	entry.owners = nil
+	if len(entry.dependents) == 0 {
+		delete(g.nodes, uid)
+	} else {
+		// Keep the node so that its remaining dependents can still be
+		// found, and reported as dangling.
+		entry.node.Observed = false
+	}
+	handlers := g.handlers
+	g.lock.Unlock()
+
+	g.notify(handlers, events)
+}
+
+// addDependentLocked adds an edge from the owner referenced by ref to
+// dependent, creating an unobserved node for the owner if necessary.
+func (g *OwnerGraph) addDependentLocked(ref metav1.OwnerReference, dependent OwnerGraphNode) OwnerGraphNode {
+	owner, ok := g.nodes[ref.UID]
+	if !ok {
+		owner = &ownerGraphEntry{
+			node: OwnerGraphNode{
+				UID:        ref.UID,
+				APIVersion: ref.APIVersion,
+				Kind:       ref.Kind,
+				Namespace:  dependent.Namespace,
+				Name:       ref.Name,
+			},
+			dependents: map[types.UID]struct{}{},
+		}
+		g.nodes[ref.UID] = owner
+	}
+	owner.dependents[dependent.UID] = struct{}{}
+	return owner.node
+}
+
+// removeDependentLocked removes the edge from ownerUID to dependentUID and
+// returns the owner, dropping it if it is unobserved and has no dependents
+// left.
+func (g *OwnerGraph) removeDependentLocked(ownerUID, dependentUID types.UID) *OwnerGraphNode {
+	owner, ok := g.nodes[ownerUID]
+	if !ok {
+		return nil
+	}
+	delete(owner.dependents, dependentUID)
+	if !owner.node.Observed && len(owner.dependents) == 0 {
+		delete(g.nodes, ownerUID)
+	}
+	return &owner.node
+}
+
+func (g *OwnerGraph) notify(handlers []OwnerGraphEventHandlerFunc, events []OwnerGraphEvent) {
+	for _, event := range events {
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
+
+func hasOwnerUID(refs []metav1.OwnerReference, uid types.UID) bool {
+	for _, ref := range refs {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+func controllerRef(refs []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range refs {
+		if refs[i].Controller != nil && *refs[i].Controller {
+			return &refs[i]
+		}
+	}
+	return nil
+}
+
+// ownerGraphInformerHandler feeds the notifications of one informer into an
+// OwnerGraph.
+type ownerGraphInformerHandler struct {
+	graph *OwnerGraph
+	gvk   schema.GroupVersionKind
+}
+
+func (h *ownerGraphInformerHandler) OnAdd(obj interface{}, isInInitialList bool) {
+	h.graph.upsert(h.gvk, obj)
+}
+
+func (h *ownerGraphInformerHandler) OnUpdate(oldObj, newObj interface{}) {
+	h.graph.upsert(h.gvk, newObj)
+}
+
+func (h *ownerGraphInformerHandler) OnDelete(obj interface{}) {
+	h.graph.remove(obj)
+}
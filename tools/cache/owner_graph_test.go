@@ -0,0 +1,221 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	fcache "k8s.io/client-go/tools/cache/testing"
+)
+
+var (
+	ownerGraphDeploymentGVK = appsv1.SchemeGroupVersion.WithKind("Deployment")
+	ownerGraphReplicaSetGVK = appsv1.SchemeGroupVersion.WithKind("ReplicaSet")
+	ownerGraphPodGVK        = v1.SchemeGroupVersion.WithKind("Pod")
+)
+
+func ownerGraphRef(kind, name string, uid types.UID, controller bool) metav1.OwnerReference {
+	apiVersion := "apps/v1"
+	if kind == "Pod" {
+		apiVersion = "v1"
+	}
+	return metav1.OwnerReference{APIVersion: apiVersion, Kind: kind, Name: name, UID: uid, Controller: &controller}
+}
+
+func ownerGraphMeta(name string, uid types.UID, owners ...metav1.OwnerReference) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Namespace: "ns", Name: name, UID: uid, OwnerReferences: owners}
+}
+
+func ownerGraphUIDs(nodes []OwnerGraphNode) []types.UID {
+	uids := []types.UID{}
+	for _, node := range nodes {
+		uids = append(uids, node.UID)
+	}
+	return uids
+}
+
+func TestOwnerGraph(t *testing.T) {
+	g := NewOwnerGraph()
+	var events []OwnerGraphEvent
+	g.AddEventHandler(func(event OwnerGraphEvent) {
+		events = append(events, event)
+	})
+	deployments := &ownerGraphInformerHandler{graph: g, gvk: ownerGraphDeploymentGVK}
+	replicaSets := &ownerGraphInformerHandler{graph: g, gvk: ownerGraphReplicaSetGVK}
+	pods := &ownerGraphInformerHandler{graph: g, gvk: ownerGraphPodGVK}
+
+	deployment := &appsv1.Deployment{ObjectMeta: ownerGraphMeta("d", "d-uid")}
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: ownerGraphMeta("rs", "rs-uid", ownerGraphRef("Deployment", "d", "d-uid", true))}
+	pod1 := &v1.Pod{ObjectMeta: ownerGraphMeta("p1", "p1-uid", ownerGraphRef("ReplicaSet", "rs", "rs-uid", true))}
+	pod2 := &v1.Pod{ObjectMeta: ownerGraphMeta("p2", "p2-uid", ownerGraphRef("ReplicaSet", "rs", "rs-uid", true))}
+
+	// Dependents may be observed before their owners.
+	pods.OnAdd(pod1, true)
+	pods.OnAdd(pod2, true)
+	if node, ok := g.Get("rs-uid"); !ok || node.Observed || node.Kind != "ReplicaSet" {
+		t.Fatalf("expected unobserved ReplicaSet node, got %#v, %v", node, ok)
+	}
+	replicaSets.OnAdd(replicaSet, true)
+	deployments.OnAdd(deployment, true)
+
+	if got, want := ownerGraphUIDs(g.Descendants("d-uid")), []types.UID{"p1-uid", "p2-uid", "rs-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected descendants %v, got %v", want, got)
+	}
+	if got, want := ownerGraphUIDs(g.Ancestors("p1-uid")), []types.UID{"d-uid", "rs-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected ancestors %v, got %v", want, got)
+	}
+	chain := g.ControllerChain("p1-uid")
+	if got, want := ownerGraphUIDs(chain), []types.UID{"rs-uid", "d-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected controller chain %v, got %v", want, got)
+	}
+	if chain[1].Kind != "Deployment" || chain[1].APIVersion != "apps/v1" || !chain[1].Observed {
+		t.Errorf("unexpected deployment node %#v", chain[1])
+	}
+	if got, want := ownerGraphUIDs(g.Dependents("rs-uid")), []types.UID{"p1-uid", "p2-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected dependents %v, got %v", want, got)
+	}
+
+	// Orphaning a pod moves it out of the graph of the ReplicaSet.
+	events = nil
+	orphan := pod2.DeepCopy()
+	orphan.OwnerReferences = nil
+	pods.OnUpdate(pod2, orphan)
+	if len(events) != 1 || events[0].Type != DependentRemoved || events[0].Owner.UID != "rs-uid" || events[0].Dependent.UID != "p2-uid" {
+		t.Errorf("unexpected events %#v", events)
+	}
+	if got, want := ownerGraphUIDs(g.Dependents("rs-uid")), []types.UID{"p1-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected dependents %v, got %v", want, got)
+	}
+
+	// Updates which keep the owner are reported as updates.
+	events = nil
+	updated := pod1.DeepCopy()
+	updated.Labels = map[string]string{"a": "b"}
+	pods.OnUpdate(pod1, updated)
+	if len(events) != 1 || events[0].Type != DependentUpdated || events[0].Object != updated {
+		t.Errorf("unexpected events %#v", events)
+	}
+
+	// Deleting the ReplicaSet keeps the pod reachable from the Deployment's
+	// point of view only through the now unobserved ReplicaSet node.
+	events = nil
+	replicaSets.OnDelete(DeletedFinalStateUnknown{Key: "ns/rs", Obj: replicaSet})
+	if len(events) != 1 || events[0].Type != DependentRemoved || events[0].Owner.UID != "d-uid" {
+		t.Errorf("unexpected events %#v", events)
+	}
+	if node, ok := g.Get("rs-uid"); !ok || node.Observed {
+		t.Errorf("expected unobserved ReplicaSet node, got %#v, %v", node, ok)
+	}
+	if got, want := ownerGraphUIDs(g.ControllerChain("p1-uid")), []types.UID{"rs-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected controller chain %v, got %v", want, got)
+	}
+
+	// Dangling references are only reported for kinds with a synced informer.
+	if dangling := g.DanglingOwnerReferences(); len(dangling) != 0 {
+		t.Errorf("unexpected dangling references %#v", dangling)
+	}
+	g.informers[ownerGraphReplicaSetGVK.GroupKind()] = func() bool { return true }
+	dangling := g.DanglingOwnerReferences()
+	if len(dangling) != 1 || dangling[0].Dependent.UID != "p1-uid" || dangling[0].OwnerReference.UID != "rs-uid" {
+		t.Errorf("unexpected dangling references %#v", dangling)
+	}
+
+	// The unobserved node goes away with its last dependent.
+	pods.OnDelete(updated)
+	if _, ok := g.Get("rs-uid"); ok {
+		t.Errorf("expected ReplicaSet node to be removed")
+	}
+	if _, ok := g.Get("p1-uid"); ok {
+		t.Errorf("expected pod node to be removed")
+	}
+}
+
+func TestOwnerGraphControllerChainCycle(t *testing.T) {
+	g := NewOwnerGraph()
+	pods := &ownerGraphInformerHandler{graph: g, gvk: ownerGraphPodGVK}
+	pods.OnAdd(&v1.Pod{ObjectMeta: ownerGraphMeta("a", "a-uid", ownerGraphRef("Pod", "b", "b-uid", true))}, false)
+	pods.OnAdd(&v1.Pod{ObjectMeta: ownerGraphMeta("b", "b-uid", ownerGraphRef("Pod", "a", "a-uid", true))}, false)
+	if got, want := ownerGraphUIDs(g.ControllerChain("a-uid")), []types.UID{"b-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected controller chain %v, got %v", want, got)
+	}
+	if got, want := ownerGraphUIDs(g.Descendants("a-uid")), []types.UID{"b-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected descendants %v, got %v", want, got)
+	}
+}
+
+func TestOwnerGraphInformers(t *testing.T) {
+	rsSource := fcache.NewFakeControllerSource()
+	podSource := fcache.NewFakeControllerSource()
+	rsSource.Add(&appsv1.ReplicaSet{ObjectMeta: ownerGraphMeta("rs", "rs-uid")})
+	podSource.Add(&v1.Pod{ObjectMeta: ownerGraphMeta("p1", "p1-uid", ownerGraphRef("ReplicaSet", "rs", "rs-uid", true))})
+	podSource.Add(&v1.Pod{ObjectMeta: ownerGraphMeta("p2", "p2-uid", ownerGraphRef("ReplicaSet", "gone", "gone-uid", true))})
+
+	g := NewOwnerGraph()
+	var lock sync.Mutex
+	added := map[types.UID]types.UID{}
+	g.AddEventHandler(func(event OwnerGraphEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		if event.Type == DependentAdded {
+			added[event.Dependent.UID] = event.Owner.UID
+		}
+	})
+	rsInformer := NewSharedInformer(rsSource, &appsv1.ReplicaSet{}, 0)
+	podInformer := NewSharedInformer(podSource, &v1.Pod{}, 0)
+	rsRegistration, err := g.AddInformer(ownerGraphReplicaSetGVK, rsInformer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	podRegistration, err := g.AddInformer(ownerGraphPodGVK, podInformer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go rsInformer.Run(stop)
+	go podInformer.Run(stop)
+	if !WaitForCacheSync(stop, rsRegistration.HasSynced, podRegistration.HasSynced) {
+		t.Fatal("informers did not sync")
+	}
+
+	if got, want := ownerGraphUIDs(g.Dependents("rs-uid")), []types.UID{"p1-uid"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected dependents %v, got %v", want, got)
+	}
+	dangling := g.DanglingOwnerReferences()
+	if len(dangling) != 1 || dangling[0].Dependent.UID != "p2-uid" || dangling[0].OwnerReference.UID != "gone-uid" {
+		t.Errorf("unexpected dangling references %#v", dangling)
+	}
+
+	podSource.Add(&v1.Pod{ObjectMeta: ownerGraphMeta("p3", "p3-uid", ownerGraphRef("ReplicaSet", "rs", "rs-uid", true))})
+	err = wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return added["p3-uid"] == "rs-uid", nil
+	})
+	if err != nil {
+		t.Errorf("expected DependentAdded event for new pod: %v", err)
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package cache
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -43,7 +44,7 @@ func BenchmarkListener(b *testing.B) {
 	var wg wait.Group
 	defer wg.Wait()       // Wait for .run and .pop to stop
 	defer close(pl.addCh) // Tell .run and .pop to stop
-	wg.Start(pl.run)
+	wg.StartWithContext(context.Background(), pl.run)
 	wg.Start(pl.pop)
 
 	b.ReportAllocs()
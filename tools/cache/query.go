@@ -0,0 +1,572 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// LabelIndexName returns the name under which QueryIndexer looks for an index
+// of the values of the label key. LabelIndexFunc builds such an index.
+func LabelIndexName(key string) string {
+	return "label:" + key
+}
+
+// FieldIndexName returns the name under which QueryIndexer looks for an index
+// of the values of the dot separated field path, e.g. "spec.nodeName".
+// FieldIndexFunc builds such an index.
+func FieldIndexName(path string) string {
+	return "field:" + path
+}
+
+// LabelIndexFunc returns an IndexFunc which indexes objects by the value of
+// the label key. Objects without the label are not indexed.
+func LabelIndexFunc(key string) IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		metadata, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := metadata.GetLabels()[key]; ok {
+			return []string{value}, nil
+		}
+		return nil, nil
+	}
+}
+
+// FieldIndexFunc returns an IndexFunc which indexes objects by the value of
+// the dot separated field path, using the same field values as the field
+// selectors of QueryIndexer.
+func FieldIndexFunc(path string) IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		content, err := queryContent(obj)
+		if err != nil {
+			return nil, err
+		}
+		return []string{queryFieldValue(content, path)}, nil
+	}
+}
+
+// Query selects, sorts and paginates objects held by an Indexer.
+// All predicates must match for an object to be selected.
+type Query struct {
+	// Namespace restricts the query to a single namespace.
+	Namespace string
+	// LabelSelector restricts the query by labels. Nil matches everything.
+	LabelSelector labels.Selector
+	// FieldSelector restricts the query by the values of dot separated field
+	// paths such as "spec.nodeName" or "status.phase". Nil matches everything.
+	FieldSelector fields.Selector
+	// JSONPath restricts the query by the results of util/jsonpath
+	// expressions.
+	JSONPath []JSONPathPredicate
+	// SortBy orders the results. Objects which compare equal on every key
+	// are ordered by their namespace/name key, which is also the order used
+	// when SortBy is empty.
+	SortBy []SortKey
+	// Limit is the maximum number of objects to return. Zero means no limit.
+	Limit int
+	// Continue is the continue token returned by a previous page of the same
+	// query.
+	Continue string
+}
+
+// JSONPathPredicate matches objects by the results of a util/jsonpath
+// expression, e.g. "{.status.conditions[?(@.type==\"Ready\")].status}".
+// Results are compared by their string formatting.
+type JSONPathPredicate struct {
+	Path string
+	// Operator is one of selection.Equals, selection.DoubleEquals,
+	// selection.NotEquals, selection.In, selection.NotIn, selection.Exists
+	// or selection.DoesNotExist. Equals and In match if any result is in
+	// Values; NotEquals and NotIn match if none is.
+	Operator selection.Operator
+	Values   []string
+}
+
+// SortKey orders objects by the first result of a util/jsonpath expression,
+// e.g. "{.metadata.creationTimestamp}". Numbers are compared numerically and
+// everything else by its string formatting; objects without a result sort
+// first.
+type SortKey struct {
+	Path       string
+	Descending bool
+}
+
+// QueryResult is one page of results of a Query.
+type QueryResult struct {
+	Items []interface{}
+	// Continue is set if more results are available. Pass it as
+	// Query.Continue to retrieve the next page.
+	Continue string
+	// RemainingItemCount is the number of matching objects after this page.
+	RemainingItemCount int
+}
+
+// QueryIndexer runs query against indexer. When the namespace, an equality
+// label requirement or an equality field requirement of the query matches an
+// index of indexer - NamespaceIndex, LabelIndexName or FieldIndexName
+// respectively - the candidates are retrieved from the smallest such index
+// instead of the whole store.
+//
+// Continue tokens identify the position of the last returned object in the
+// sort order, so objects added or removed between pages do not cause other
+// objects to be skipped or repeated.
+func QueryIndexer(indexer Indexer, query Query) (*QueryResult, error) {
+	q, err := compileQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	var after *queryPosition
+	if query.Continue != "" {
+		if after, err = q.decodeContinue(query.Continue); err != nil {
+			return nil, err
+		}
+	}
+
+	candidates, err := q.candidates(indexer)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*queryItem
+	for _, obj := range candidates {
+		item, ok, err := q.match(obj)
+		if err != nil {
+			return nil, err
+		}
+		if ok && (after == nil || q.less(after, &item.queryPosition)) {
+			matches = append(matches, item)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return q.less(&matches[i].queryPosition, &matches[j].queryPosition)
+	})
+
+	result := &QueryResult{}
+	page := matches
+	if query.Limit > 0 && len(matches) > query.Limit {
+		page = matches[:query.Limit]
+		result.RemainingItemCount = len(matches) - query.Limit
+		if result.Continue, err = q.encodeContinue(&page[len(page)-1].queryPosition); err != nil {
+			return nil, err
+		}
+	}
+	result.Items = make([]interface{}, 0, len(page))
+	for _, item := range page {
+		result.Items = append(result.Items, item.obj)
+	}
+	return result, nil
+}
+
+type compiledQuery struct {
+	Query
+	jsonPaths    []*jsonpath.JSONPath
+	sortPaths    []*jsonpath.JSONPath
+	needsContent bool
+}
+
+// queryPosition identifies an object in the sort order of a query.
+type queryPosition struct {
+	SortValues []interface{} `json:"v,omitempty"`
+	Key        string        `json:"k"`
+}
+
+type queryItem struct {
+	queryPosition
+	obj interface{}
+}
+
+// queryContinueToken is the decoded form of a continue token. Sort records
+// the sort keys of the query so tokens cannot be reused with another order.
+type queryContinueToken struct {
+	Sort  string        `json:"s,omitempty"`
+	After queryPosition `json:"a"`
+}
+
+func compileQuery(query Query) (*compiledQuery, error) {
+	q := &compiledQuery{Query: query}
+	if q.LabelSelector == nil {
+		q.LabelSelector = labels.Everything()
+	}
+	if q.FieldSelector == nil {
+		q.FieldSelector = fields.Everything()
+	}
+	for _, p := range q.JSONPath {
+		switch p.Operator {
+		case selection.Equals, selection.DoubleEquals, selection.NotEquals, selection.In, selection.NotIn:
+		case selection.Exists, selection.DoesNotExist:
+		default:
+			return nil, fmt.Errorf("unsupported operator %q for JSONPath predicate %q", p.Operator, p.Path)
+		}
+		j, err := parseQueryJSONPath(p.Path)
+		if err != nil {
+			return nil, err
+		}
+		q.jsonPaths = append(q.jsonPaths, j)
+	}
+	for _, key := range q.SortBy {
+		j, err := parseQueryJSONPath(key.Path)
+		if err != nil {
+			return nil, err
+		}
+		q.sortPaths = append(q.sortPaths, j)
+	}
+	q.needsContent = !q.FieldSelector.Empty() || len(q.jsonPaths) > 0 || len(q.sortPaths) > 0
+	return q, nil
+}
+
+func parseQueryJSONPath(path string) (*jsonpath.JSONPath, error) {
+	j := jsonpath.New(path).AllowMissingKeys(true)
+	if err := j.Parse(path); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %v", path, err)
+	}
+	return j, nil
+}
+
+// candidates returns the objects which may match the query, using the most
+// selective applicable index.
+func (q *compiledQuery) candidates(indexer Indexer) ([]interface{}, error) {
+	indexers := indexer.GetIndexers()
+	var best []interface{}
+	found := false
+	consider := func(indexName string, values ...string) error {
+		if _, ok := indexers[indexName]; !ok {
+			return nil
+		}
+		var objs []interface{}
+		if len(values) == 1 {
+			var err error
+			if objs, err = indexer.ByIndex(indexName, values[0]); err != nil {
+				return err
+			}
+		} else {
+			// An object can be indexed under several of the values,
+			// so deduplicate by key.
+			seen := sets.NewString()
+			for _, value := range values {
+				keys, err := indexer.IndexKeys(indexName, value)
+				if err != nil {
+					return err
+				}
+				for _, key := range keys {
+					if seen.Has(key) {
+						continue
+					}
+					seen.Insert(key)
+					if obj, exists, err := indexer.GetByKey(key); err != nil {
+						return err
+					} else if exists {
+						objs = append(objs, obj)
+					}
+				}
+			}
+		}
+		if !found || len(objs) < len(best) {
+			best, found = objs, true
+		}
+		return nil
+	}
+
+	if q.Namespace != metav1.NamespaceAll {
+		if err := consider(NamespaceIndex, q.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	if requirements, selectable := q.LabelSelector.Requirements(); selectable {
+		for _, r := range requirements {
+			switch r.Operator() {
+			case selection.Equals, selection.DoubleEquals, selection.In:
+				if err := consider(LabelIndexName(r.Key()), r.Values().List()...); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, r := range q.FieldSelector.Requirements() {
+		switch r.Operator {
+		case selection.Equals, selection.DoubleEquals:
+			indexName := FieldIndexName(r.Field)
+			if r.Field == "metadata.namespace" {
+				indexName = NamespaceIndex
+			}
+			if err := consider(indexName, r.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if found {
+		return best, nil
+	}
+	return indexer.List(), nil
+}
+
+// match evaluates every predicate of the query against obj and returns its
+// position in the sort order if it matches.
+func (q *compiledQuery) match(obj interface{}) (*queryItem, bool, error) {
+	metadata, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	if q.Namespace != metav1.NamespaceAll && metadata.GetNamespace() != q.Namespace {
+		return nil, false, nil
+	}
+	if !q.LabelSelector.Matches(labels.Set(metadata.GetLabels())) {
+		return nil, false, nil
+	}
+	key, err := MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	item := &queryItem{queryPosition: queryPosition{Key: key}, obj: obj}
+	if !q.needsContent {
+		return item, true, nil
+	}
+
+	content, err := queryContent(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	if !q.FieldSelector.Empty() {
+		fieldSet := fields.Set{}
+		for _, r := range q.FieldSelector.Requirements() {
+			fieldSet[r.Field] = queryFieldValue(content, r.Field)
+		}
+		if !q.FieldSelector.Matches(fieldSet) {
+			return nil, false, nil
+		}
+	}
+	for i, p := range q.JSONPath {
+		results, err := queryJSONPathResults(q.jsonPaths[i], content)
+		if err != nil {
+			return nil, false, err
+		}
+		if !jsonPathPredicateMatches(p, results) {
+			return nil, false, nil
+		}
+	}
+	for _, j := range q.sortPaths {
+		results, err := queryJSONPathResults(j, content)
+		if err != nil {
+			return nil, false, err
+		}
+		var value interface{}
+		if len(results) > 0 {
+			value = results[0]
+		}
+		item.SortValues = append(item.SortValues, value)
+	}
+	return item, true, nil
+}
+
+func jsonPathPredicateMatches(p JSONPathPredicate, results []interface{}) bool {
+	switch p.Operator {
+	case selection.Exists:
+		return len(results) > 0
+	case selection.DoesNotExist:
+		return len(results) == 0
+	}
+	values := sets.NewString(p.Values...)
+	found := false
+	for _, result := range results {
+		if values.Has(fmt.Sprint(result)) {
+			found = true
+			break
+		}
+	}
+	switch p.Operator {
+	case selection.NotEquals, selection.NotIn:
+		return !found
+	default:
+		return found
+	}
+}
+
+// less orders positions by their sort values and then by their keys.
+func (q *compiledQuery) less(a, b *queryPosition) bool {
+	for i, key := range q.SortBy {
+		var av, bv interface{}
+		if i < len(a.SortValues) {
+			av = a.SortValues[i]
+		}
+		if i < len(b.SortValues) {
+			bv = b.SortValues[i]
+		}
+		c := compareQueryValues(av, bv)
+		if c == 0 {
+			continue
+		}
+		if key.Descending {
+			return c > 0
+		}
+		return c < 0
+	}
+	return a.Key < b.Key
+}
+
+// compareQueryValues compares two sort values. Values are normalized by
+// normalizeQueryValue, so numbers are float64 and everything else is nil or a
+// string.
+func compareQueryValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	af, aNumber := a.(float64)
+	bf, bNumber := b.(float64)
+	switch {
+	case aNumber && bNumber:
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+		return 0
+	case aNumber:
+		return -1
+	case bNumber:
+		return 1
+	}
+	return strings.Compare(a.(string), b.(string))
+}
+
+func (q *compiledQuery) sortSpec() string {
+	var parts []string
+	for _, key := range q.SortBy {
+		part := key.Path
+		if key.Descending {
+			part += " desc"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (q *compiledQuery) encodeContinue(after *queryPosition) (string, error) {
+	data, err := json.Marshal(queryContinueToken{Sort: q.sortSpec(), After: *after})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (q *compiledQuery) decodeContinue(token string) (*queryPosition, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid continue token: %v", err)
+	}
+	var decoded queryContinueToken
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid continue token: %v", err)
+	}
+	if decoded.Sort != q.sortSpec() {
+		return nil, fmt.Errorf("continue token was issued for a different sort order")
+	}
+	for i, v := range decoded.After.SortValues {
+		decoded.After.SortValues[i] = normalizeQueryValue(v)
+	}
+	return &decoded.After, nil
+}
+
+// queryContent returns the unstructured content of obj.
+func queryContent(obj interface{}) (map[string]interface{}, error) {
+	if u, ok := obj.(runtime.Unstructured); ok {
+		return u.UnstructuredContent(), nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query %T: %v", obj, err)
+	}
+	return content, nil
+}
+
+// queryFieldValue returns the string value of the dot separated field path,
+// or the empty string if it does not exist.
+func queryFieldValue(content map[string]interface{}, path string) string {
+	var value interface{} = content
+	for _, field := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		if value, ok = m[field]; !ok {
+			return ""
+		}
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func queryJSONPathResults(j *jsonpath.JSONPath, content map[string]interface{}) ([]interface{}, error) {
+	results, err := j.FindResults(content)
+	if err != nil {
+		return nil, err
+	}
+	var values []interface{}
+	for _, set := range results {
+		for _, result := range set {
+			if !result.IsValid() || !result.CanInterface() {
+				continue
+			}
+			if value := normalizeQueryValue(result.Interface()); value != nil {
+				values = append(values, value)
+			}
+		}
+	}
+	return values, nil
+}
+
+// normalizeQueryValue converts numbers to float64 and everything else except
+// nil to its string formatting, so that values survive the round trip
+// through continue tokens.
+func normalizeQueryValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// listCountingIndexer records full scans of the underlying Indexer.
+type listCountingIndexer struct {
+	Indexer
+	lists int
+}
+
+func (i *listCountingIndexer) List() []interface{} {
+	i.lists++
+	return i.Indexer.List()
+}
+
+func newQueryTestIndexer(t *testing.T) *listCountingIndexer {
+	indexer := NewIndexer(MetaNamespaceKeyFunc, Indexers{
+		NamespaceIndex:                  MetaNamespaceIndexFunc,
+		LabelIndexName("app"):           LabelIndexFunc("app"),
+		FieldIndexName("spec.nodeName"): FieldIndexFunc("spec.nodeName"),
+	})
+	pods := []struct {
+		namespace, name, app, node string
+		phase                      v1.PodPhase
+		restarts                   int32
+	}{
+		{"ns1", "a", "web", "node1", v1.PodRunning, 3},
+		{"ns1", "b", "web", "node2", v1.PodPending, 0},
+		{"ns1", "c", "db", "node1", v1.PodRunning, 10},
+		{"ns2", "d", "web", "node1", v1.PodFailed, 1},
+		{"ns2", "e", "db", "node2", v1.PodRunning, 2},
+	}
+	for _, p := range pods {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: p.namespace, Name: p.name, Labels: map[string]string{"app": p.app}},
+			Spec:       v1.PodSpec{NodeName: p.node},
+			Status: v1.PodStatus{
+				Phase:             p.phase,
+				ContainerStatuses: []v1.ContainerStatus{{Name: "c", RestartCount: p.restarts}},
+			},
+		}
+		if err := indexer.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &listCountingIndexer{Indexer: indexer}
+}
+
+func queryResultNames(result *QueryResult) []string {
+	names := []string{}
+	for _, item := range result.Items {
+		names = append(names, item.(*v1.Pod).Name)
+	}
+	return names
+}
+
+func TestQueryIndexer(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    Query
+		want     []string
+		wantScan bool
+	}{
+		{
+			name:     "everything",
+			want:     []string{"a", "b", "c", "d", "e"},
+			wantScan: true,
+		},
+		{
+			name:  "namespace",
+			query: Query{Namespace: "ns2"},
+			want:  []string{"d", "e"},
+		},
+		{
+			name:  "label selector",
+			query: Query{LabelSelector: labels.SelectorFromSet(labels.Set{"app": "db"})},
+			want:  []string{"c", "e"},
+		},
+		{
+			name:     "unindexed label selector",
+			query:    Query{LabelSelector: labels.SelectorFromSet(labels.Set{"tier": "x"})},
+			want:     []string{},
+			wantScan: true,
+		},
+		{
+			name: "label set selector",
+			query: Query{LabelSelector: func() labels.Selector {
+				s, _ := labels.Parse("app in (web,db)")
+				return s
+			}(), Namespace: "ns1"},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:  "indexed field selector",
+			query: Query{FieldSelector: fields.OneTermEqualSelector("spec.nodeName", "node2")},
+			want:  []string{"b", "e"},
+		},
+		{
+			name:     "unindexed field selector",
+			query:    Query{FieldSelector: fields.OneTermNotEqualSelector("status.phase", "Running")},
+			want:     []string{"b", "d"},
+			wantScan: true,
+		},
+		{
+			name: "JSONPath predicate",
+			query: Query{
+				Namespace: "ns1",
+				JSONPath: []JSONPathPredicate{{
+					Path:     "{.status.containerStatuses[?(@.name==\"c\")].restartCount}",
+					Operator: selection.In,
+					Values:   []string{"0", "10"},
+				}},
+			},
+			want: []string{"b", "c"},
+		},
+		{
+			name: "JSONPath does not exist",
+			query: Query{
+				JSONPath: []JSONPathPredicate{{Path: "{.spec.hostname}", Operator: selection.DoesNotExist}},
+			},
+			want:     []string{"a", "b", "c", "d", "e"},
+			wantScan: true,
+		},
+		{
+			name: "numeric sort",
+			query: Query{
+				SortBy: []SortKey{{Path: "{.status.containerStatuses[0].restartCount}", Descending: true}},
+			},
+			want:     []string{"c", "a", "e", "d", "b"},
+			wantScan: true,
+		},
+		{
+			name: "multiple sort keys",
+			query: Query{
+				SortBy: []SortKey{{Path: "{.spec.nodeName}"}, {Path: "{.status.phase}", Descending: true}},
+			},
+			want:     []string{"a", "c", "d", "e", "b"},
+			wantScan: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			indexer := newQueryTestIndexer(t)
+			result, err := QueryIndexer(indexer, test.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := queryResultNames(result); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+			if scanned := indexer.lists > 0; scanned != test.wantScan {
+				t.Errorf("expected full scan %v, got %v", test.wantScan, scanned)
+			}
+		})
+	}
+}
+
+func TestQueryIndexerPagination(t *testing.T) {
+	indexer := newQueryTestIndexer(t)
+	query := Query{
+		SortBy: []SortKey{{Path: "{.status.containerStatuses[0].restartCount}"}},
+		Limit:  2,
+	}
+
+	result, err := QueryIndexer(indexer, query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := queryResultNames(result), []string{"b", "d"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if result.Continue == "" || result.RemainingItemCount != 3 {
+		t.Fatalf("unexpected continue %q and remaining count %d", result.Continue, result.RemainingItemCount)
+	}
+	firstContinue := result.Continue
+
+	// An object deleted between pages must not shift the next page.
+	if err := indexer.Delete(result.Items[0]); err != nil {
+		t.Fatal(err)
+	}
+	query.Continue = result.Continue
+	result, err = QueryIndexer(indexer, query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := queryResultNames(result), []string{"e", "a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	query.Continue = result.Continue
+	result, err = QueryIndexer(indexer, query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := queryResultNames(result), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if result.Continue != "" || result.RemainingItemCount != 0 {
+		t.Errorf("unexpected continue %q and remaining count %d on last page", result.Continue, result.RemainingItemCount)
+	}
+
+	// Tokens cannot be used with a different sort order.
+	query.SortBy[0].Descending = true
+	query.Continue = firstContinue
+	if _, err := QueryIndexer(indexer, query); err == nil {
+		t.Errorf("expected error for continue token of a different sort order")
+	}
+}
+
+func TestQueryIndexerInvalid(t *testing.T) {
+	indexer := newQueryTestIndexer(t)
+	for _, query := range []Query{
+		{JSONPath: []JSONPathPredicate{{Path: "{.status", Operator: selection.Exists}}},
+		{JSONPath: []JSONPathPredicate{{Path: "{.status}", Operator: selection.GreaterThan}}},
+		{SortBy: []SortKey{{Path: "{.metadata"}}},
+		{Continue: "not a token"},
+	} {
+		if _, err := QueryIndexer(indexer, query); err == nil {
+			t.Errorf("expected error for query %#v", query)
+		}
+	}
+}
@@ -100,6 +100,7 @@ type Reflector struct {
 	// scalability problems.
 	WatchListPageSize int64
 	// Called whenever the ListAndWatch drops the connection with an error.
+	// DefaultWatchErrorHandlerWithContext is used if it is nil.
 	watchErrorHandler WatchErrorHandler
 }
 
@@ -124,18 +125,28 @@ type ResourceVersionUpdater interface {
 // should be offloaded.
 type WatchErrorHandler func(r *Reflector, err error)
 
-// DefaultWatchErrorHandler is the default implementation of WatchErrorHandler
+// DefaultWatchErrorHandler is the default implementation of WatchErrorHandler.
+// It logs through the global klog logger, see
+// DefaultWatchErrorHandlerWithContext for the contextual variant.
 func DefaultWatchErrorHandler(r *Reflector, err error) {
+	DefaultWatchErrorHandlerWithContext(context.Background(), r, err)
+}
+
+// DefaultWatchErrorHandlerWithContext is the implementation of
+// WatchErrorHandler used by Reflector.RunWithContext when no handler was set.
+// It logs through the logger of ctx.
+func DefaultWatchErrorHandlerWithContext(ctx context.Context, r *Reflector, err error) {
+	logger := klog.FromContext(ctx)
 	switch {
 	case isExpiredError(err):
 		// Don't set LastSyncResourceVersionUnavailable - LIST call with ResourceVersion=RV already
 		// has a semantic that it returns data at least as fresh as provided RV.
 		// So first try to LIST with setting RV to resource version of last observed object.
-		klog.V(4).Infof("%s: watch of %v closed with: %v", r.name, r.typeDescription, err)
+		logger.V(4).Info("Watch closed", "reflector", r.name, "type", r.typeDescription, "err", err)
 	case err == io.EOF:
 		// watch closed normally
 	case err == io.ErrUnexpectedEOF:
-		klog.V(1).Infof("%s: Watch for %v closed with unexpected EOF: %v", r.name, r.typeDescription, err)
+		logger.V(1).Info("Watch closed with unexpected EOF", "reflector", r.name, "type", r.typeDescription, "err", err)
 	default:
 		utilruntime.HandleError(fmt.Errorf("%s: Failed to watch %v: %v", r.name, r.typeDescription, err))
 	}
@@ -209,7 +220,6 @@ func NewReflectorWithOptions(lw ListerWatcher, expectedType interface{}, store S
 		backoffManager:         wait.NewExponentialBackoffManager(800*time.Millisecond, 30*time.Second, 2*time.Minute, 2.0, 1.0, realClock),
 		initConnBackoffManager: wait.NewExponentialBackoffManager(800*time.Millisecond, 30*time.Second, 2*time.Minute, 2.0, 1.0, realClock),
 		clock:                  realClock,
-		watchErrorHandler:      WatchErrorHandler(DefaultWatchErrorHandler),
 		expectedType:           reflect.TypeOf(expectedType),
 	}
 
@@ -269,14 +279,32 @@ var internalPackages = []string{"client-go/tools/cache/"}
 // Run repeatedly uses the reflector's ListAndWatch to fetch all the
 // objects and subsequent deltas.
 // Run will exit when stopCh is closed.
+//
+// Contextual logging: RunWithContext should be used instead of Run in code
+// which supports contextual logging.
 func (r *Reflector) Run(stopCh <-chan struct{}) {
-	klog.V(3).Infof("Starting reflector %s (%s) from %s", r.typeDescription, r.resyncPeriod, r.name)
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	r.RunWithContext(ctx)
+}
+
+// RunWithContext repeatedly uses the reflector's ListAndWatchWithContext to
+// fetch all the objects and subsequent deltas. The reflector logs through the
+// logger of ctx.
+// RunWithContext will exit when ctx is done.
+func (r *Reflector) RunWithContext(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	logger.V(3).Info("Starting reflector", "type", r.typeDescription, "resyncPeriod", r.resyncPeriod, "reflector", r.name)
 	wait.BackoffUntil(func() {
-		if err := r.ListAndWatch(stopCh); err != nil {
-			r.watchErrorHandler(r, err)
+		if err := r.ListAndWatchWithContext(ctx); err != nil {
+			if r.watchErrorHandler != nil {
+				r.watchErrorHandler(r, err)
+			} else {
+				DefaultWatchErrorHandlerWithContext(ctx, r, err)
+			}
 		}
-	}, r.backoffManager, true, stopCh)
-	klog.V(3).Infof("Stopping reflector %s (%s) from %s", r.typeDescription, r.resyncPeriod, r.name)
+	}, r.backoffManager, true, ctx.Done())
+	logger.V(3).Info("Stopping reflector", "type", r.typeDescription, "resyncPeriod", r.resyncPeriod, "reflector", r.name)
 }
 
 var (
@@ -305,10 +333,23 @@ func (r *Reflector) resyncChan() (<-chan time.Time, func() bool) {
 // ListAndWatch first lists all items and get the resource version at the moment of call,
 // and then use the resource version to watch.
 // It returns error if ListAndWatch didn't even try to initialize watch.
+//
+// Contextual logging: ListAndWatchWithContext should be used instead of
+// ListAndWatch in code which supports contextual logging.
 func (r *Reflector) ListAndWatch(stopCh <-chan struct{}) error {
-	klog.V(3).Infof("Listing and watching %v from %s", r.typeDescription, r.name)
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	return r.ListAndWatchWithContext(ctx)
+}
+
+// ListAndWatchWithContext is like ListAndWatch, but stops when ctx is done
+// and logs through the logger of ctx. The list requests are cancelled through
+// ctx as well.
+func (r *Reflector) ListAndWatchWithContext(ctx context.Context) error {
+	logger := klog.FromContext(ctx)
+	logger.V(3).Info("Listing and watching", "type", r.typeDescription, "reflector", r.name)
 
-	err := r.list(stopCh)
+	err := r.list(ctx)
 	if err != nil {
 		return err
 	}
@@ -324,13 +365,13 @@ func (r *Reflector) ListAndWatch(stopCh <-chan struct{}) error {
 		for {
 			select {
 			case <-resyncCh:
-			case <-stopCh:
+			case <-ctx.Done():
 				return
 			case <-cancelCh:
 				return
 			}
 			if r.ShouldResync == nil || r.ShouldResync() {
-				klog.V(4).Infof("%s: forcing resync", r.name)
+				logger.V(4).Info("Forcing resync", "reflector", r.name)
 				if err := r.store.Resync(); err != nil {
 					resyncerrc <- err
 					return
@@ -343,9 +384,9 @@ func (r *Reflector) ListAndWatch(stopCh <-chan struct{}) error {
 
 	retry := NewRetryWithDeadline(r.MaxInternalErrorRetryDuration, time.Minute, apierrors.IsInternalError, r.clock)
 	for {
-		// give the stopCh a chance to stop the loop, even in case of continue statements further down on errors
+		// give the ctx a chance to stop the loop, even in case of continue statements further down on errors
 		select {
-		case <-stopCh:
+		case <-ctx.Done():
 			return nil
 		default:
 		}
@@ -378,7 +419,7 @@ func (r *Reflector) ListAndWatch(stopCh <-chan struct{}) error {
 			return err
 		}
 
-		err = watchHandler(start, w, r.store, r.expectedType, r.expectedGVK, r.name, r.typeDescription, r.setLastSyncResourceVersion, r.clock, resyncerrc, stopCh)
+		err = watchHandler(ctx, start, w, r.store, r.expectedType, r.expectedGVK, r.name, r.typeDescription, r.setLastSyncResourceVersion, r.clock, resyncerrc)
 		retry.After(err)
 		if err != nil {
 			if err != errorStopRequested {
@@ -387,16 +428,16 @@ func (r *Reflector) ListAndWatch(stopCh <-chan struct{}) error {
 					// Don't set LastSyncResourceVersionUnavailable - LIST call with ResourceVersion=RV already
 					// has a semantic that it returns data at least as fresh as provided RV.
 					// So first try to LIST with setting RV to resource version of last observed object.
-					klog.V(4).Infof("%s: watch of %v closed with: %v", r.name, r.typeDescription, err)
+					logger.V(4).Info("Watch closed", "reflector", r.name, "type", r.typeDescription, "err", err)
 				case apierrors.IsTooManyRequests(err):
-					klog.V(2).Infof("%s: watch of %v returned 429 - backing off", r.name, r.typeDescription)
+					logger.V(2).Info("Watch returned 429 - backing off", "reflector", r.name, "type", r.typeDescription)
 					<-r.initConnBackoffManager.Backoff().C()
 					continue
 				case apierrors.IsInternalError(err) && retry.ShouldRetry():
-					klog.V(2).Infof("%s: retrying watch of %v internal error: %v", r.name, r.typeDescription, err)
+					logger.V(2).Info("Retrying watch after internal error", "reflector", r.name, "type", r.typeDescription, "err", err)
 					continue
 				default:
-					klog.Warningf("%s: watch of %v ended with: %v", r.name, r.typeDescription, err)
+					logger.Info("Warning: watch ended with error", "reflector", r.name, "type", r.typeDescription, "err", err)
 				}
 			}
 			return nil
@@ -406,13 +447,19 @@ func (r *Reflector) ListAndWatch(stopCh <-chan struct{}) error {
 
 // list simply lists all items and records a resource version obtained from the server at the moment of the call.
 // the resource version can be used for further progress notification (aka. watch).
-func (r *Reflector) list(stopCh <-chan struct{}) error {
+func (r *Reflector) list(ctx context.Context) error {
 	var resourceVersion string
 	options := metav1.ListOptions{ResourceVersion: r.relistResourceVersion()}
 
 	initTrace := trace.New("Reflector ListAndWatch", trace.Field{Key: "name", Value: r.name})
 	defer initTrace.LogIfLong(10 * time.Second)
 	var list runtime.Object
+	// listMeta is set instead of list if the lister watcher streams lists.
+	// The streamed items are added to replacement if the store supports it
+	// and collected in items otherwise.
+	var items []runtime.Object
+	var listMeta *metav1.ListMeta
+	var replacement Replacement
 	var paginatedResult bool
 	var err error
 	listCh := make(chan struct{}, 1)
@@ -451,7 +498,36 @@ func (r *Reflector) list(stopCh <-chan struct{}) error {
 			pager.PageSize = 0
 		}
 
-		list, paginatedResult, err = pager.List(context.Background(), options)
+		streamer, streaming := r.listerWatcher.(ListStreamer)
+		if streaming {
+			pager.StreamFn = streamer.ListStream
+		}
+		doList := func(options metav1.ListOptions) (paginated bool, err error) {
+			if !streaming {
+				list, paginated, err = pager.List(ctx, options)
+				return paginated, err
+			}
+			items, replacement = nil, nil
+			add := func(item runtime.Object) error {
+				items = append(items, item)
+				return nil
+			}
+			if replacer, ok := r.store.(StreamReplacer); ok {
+				replacement = replacer.StartReplace()
+				add = func(item runtime.Object) error {
+					// Stop feeding the store once the reflector gave up
+					// waiting for the list.
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+					return replacement.Add(item)
+				}
+			}
+			listMeta, paginated, err = pager.StreamList(ctx, options, add)
+			return paginated, err
+		}
+
+		paginatedResult, err = doList(options)
 		if isExpiredError(err) || isTooLargeResourceVersionError(err) {
 			r.setIsLastSyncResourceVersionUnavailable(true)
 			// Retry immediately if the resource version used to list is unavailable.
@@ -460,12 +536,12 @@ func (r *Reflector) list(stopCh <-chan struct{}) error {
 			// resource version it is listing at is expired or the cache may not yet be synced to the provided
 			// resource version. So we need to fallback to resourceVersion="" in all to recover and ensure
 			// the reflector makes forward progress.
-			list, paginatedResult, err = pager.List(context.Background(), metav1.ListOptions{ResourceVersion: r.relistResourceVersion()})
+			paginatedResult, err = doList(metav1.ListOptions{ResourceVersion: r.relistResourceVersion()})
 		}
 		close(listCh)
 	}()
 	select {
-	case <-stopCh:
+	case <-ctx.Done():
 		return nil
 	case r := <-panicCh:
 		panic(r)
@@ -473,7 +549,7 @@ func (r *Reflector) list(stopCh <-chan struct{}) error {
 	}
 	initTrace.Step("Objects listed", trace.Field{Key: "error", Value: err})
 	if err != nil {
-		klog.Warningf("%s: failed to list %v: %v", r.name, r.typeDescription, err)
+		klog.FromContext(ctx).Error(err, "Failed to list", "reflector", r.name, "type", r.typeDescription)
 		return fmt.Errorf("failed to list %v: %w", r.typeDescription, err)
 	}
 
@@ -492,18 +568,28 @@ func (r *Reflector) list(stopCh <-chan struct{}) error {
 	}
 
 	r.setIsLastSyncResourceVersionUnavailable(false) // list was successful
-	listMetaInterface, err := meta.ListAccessor(list)
-	if err != nil {
-		return fmt.Errorf("unable to understand list result %#v: %v", list, err)
+	if listMeta != nil {
+		resourceVersion = listMeta.ResourceVersion
+		initTrace.Step("Resource version extracted")
+	} else {
+		listMetaInterface, err := meta.ListAccessor(list)
+		if err != nil {
+			return fmt.Errorf("unable to understand list result %#v: %v", list, err)
+		}
+		resourceVersion = listMetaInterface.GetResourceVersion()
+		initTrace.Step("Resource version extracted")
+		items, err = meta.ExtractList(list)
+		if err != nil {
+			return fmt.Errorf("unable to understand list result %#v (%v)", list, err)
+		}
+		initTrace.Step("Objects extracted")
 	}
-	resourceVersion = listMetaInterface.GetResourceVersion()
-	initTrace.Step("Resource version extracted")
-	items, err := meta.ExtractList(list)
-	if err != nil {
-		return fmt.Errorf("unable to understand list result %#v (%v)", list, err)
+	if replacement != nil {
+		err = replacement.Done(resourceVersion)
+	} else {
+		err = r.syncWith(items, resourceVersion)
 	}
-	initTrace.Step("Objects extracted")
-	if err := r.syncWith(items, resourceVersion); err != nil {
+	if err != nil {
 		return fmt.Errorf("unable to sync list result: %v", err)
 	}
 	initTrace.Step("SyncWith done")
@@ -522,7 +608,8 @@ func (r *Reflector) syncWith(items []runtime.Object, resourceVersion string) err
 }
 
 // watchHandler watches w and sets setLastSyncResourceVersion
-func watchHandler(start time.Time,
+func watchHandler(ctx context.Context,
+	start time.Time,
 	w watch.Interface,
 	store Store,
 	expectedType reflect.Type,
@@ -532,7 +619,6 @@ func watchHandler(start time.Time,
 	setLastSyncResourceVersion func(string),
 	clock clock.Clock,
 	errc chan error,
-	stopCh <-chan struct{},
 ) error {
 	eventCount := 0
 
@@ -543,7 +629,7 @@ func watchHandler(start time.Time,
 loop:
 	for {
 		select {
-		case <-stopCh:
+		case <-ctx.Done():
 			return errorStopRequested
 		case err := <-errc:
 			return err
@@ -608,7 +694,7 @@ loop:
 	if watchDuration < 1*time.Second && eventCount == 0 {
 		return fmt.Errorf("very short watch: %s: Unexpected watch close - watch lasted less than a second and no items received", name)
 	}
-	klog.V(4).Infof("%s: Watch close - %v total %v items received", name, expectedTypeName, eventCount)
+	klog.FromContext(ctx).V(4).Info("Watch close", "reflector", name, "type", expectedTypeName, "totalItems", eventCount)
 	return nil
 }
 
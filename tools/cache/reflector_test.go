@@ -17,6 +17,7 @@ limitations under the License.
 package cache
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -32,6 +33,7 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/utils/clock"
@@ -138,7 +140,7 @@ func TestReflectorWatchHandlerError(t *testing.T) {
 	go func() {
 		fw.Stop()
 	}()
-	err := watchHandler(time.Now(), fw, s, g.expectedType, g.expectedGVK, g.name, g.typeDescription, g.setLastSyncResourceVersion, g.clock, nevererrc, wait.NeverStop)
+	err := watchHandler(context.Background(), time.Now(), fw, s, g.expectedType, g.expectedGVK, g.name, g.typeDescription, g.setLastSyncResourceVersion, g.clock, nevererrc)
 	if err == nil {
 		t.Errorf("unexpected non-error")
 	}
@@ -157,7 +159,7 @@ func TestReflectorWatchHandler(t *testing.T) {
 		fw.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "baz", ResourceVersion: "32"}})
 		fw.Stop()
 	}()
-	err := watchHandler(time.Now(), fw, s, g.expectedType, g.expectedGVK, g.name, g.typeDescription, g.setLastSyncResourceVersion, g.clock, nevererrc, wait.NeverStop)
+	err := watchHandler(context.Background(), time.Now(), fw, s, g.expectedType, g.expectedGVK, g.name, g.typeDescription, g.setLastSyncResourceVersion, g.clock, nevererrc)
 	if err != nil {
 		t.Errorf("unexpected error %v", err)
 	}
@@ -203,9 +205,9 @@ func TestReflectorStopWatch(t *testing.T) {
 	s := NewStore(MetaNamespaceKeyFunc)
 	g := NewReflector(&testLW{}, &v1.Pod{}, s, 0)
 	fw := watch.NewFake()
-	stopWatch := make(chan struct{}, 1)
-	stopWatch <- struct{}{}
-	err := watchHandler(time.Now(), fw, s, g.expectedType, g.expectedGVK, g.name, g.typeDescription, g.setLastSyncResourceVersion, g.clock, nevererrc, stopWatch)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := watchHandler(ctx, time.Now(), fw, s, g.expectedType, g.expectedGVK, g.name, g.typeDescription, g.setLastSyncResourceVersion, g.clock, nevererrc)
 	if err != errorStopRequested {
 		t.Errorf("expected stop error, got %q", err)
 	}
@@ -639,6 +641,136 @@ func TestReflectorWatchListPageSize(t *testing.T) {
 	}
 }
 
+type testStreamingLW struct {
+	testLW
+	ListStreamFunc func(ctx context.Context, options metav1.ListOptions, fn func(runtime.Object) error) (*metav1.ListMeta, error)
+}
+
+func (t *testStreamingLW) ListStream(ctx context.Context, options metav1.ListOptions, fn func(runtime.Object) error) (*metav1.ListMeta, error) {
+	return t.ListStreamFunc(ctx, options, fn)
+}
+
+func TestReflectorListStream(t *testing.T) {
+	stopCh := make(chan struct{})
+	s := NewStore(MetaNamespaceKeyFunc)
+	s.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "stale", ResourceVersion: "5"}})
+
+	lw := &testStreamingLW{
+		testLW: testLW{
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				// Stop once the reflector begins watching since we're only interested in the list.
+				close(stopCh)
+				return watch.NewFake(), nil
+			},
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				t.Fatalf("Expected the list to be streamed")
+				return nil, nil
+			},
+		},
+		ListStreamFunc: func(ctx context.Context, options metav1.ListOptions, fn func(runtime.Object) error) (*metav1.ListMeta, error) {
+			if options.Limit != 4 {
+				t.Fatalf("Expected list Limit of 4 but got %d", options.Limit)
+			}
+			start, end, next := 0, 4, "C1"
+			if options.Continue == "C1" {
+				start, end, next = 4, 6, ""
+				// The store is fed while the list is streamed.
+				if _, exists, _ := s.GetByKey("pod-0"); !exists {
+					t.Errorf("Expected pod-0 to be stored before the list is complete")
+				}
+			}
+			for i := start; i < end; i++ {
+				if err := fn(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), ResourceVersion: "10"}}); err != nil {
+					return nil, err
+				}
+			}
+			return &metav1.ListMeta{ResourceVersion: "10", Continue: next}, nil
+		},
+	}
+	r := NewReflector(lw, &v1.Pod{}, s, 0)
+	r.WatchListPageSize = 4
+	r.ListAndWatch(stopCh)
+
+	if results := s.List(); len(results) != 6 {
+		t.Errorf("Expected 6 results, got %d", len(results))
+	}
+	if _, exists, _ := s.GetByKey("stale"); exists {
+		t.Errorf("Expected the stale pod to be deleted")
+	}
+	if rv := r.LastSyncResourceVersion(); rv != "10" {
+		t.Errorf("Expected resource version 10, got %q", rv)
+	}
+}
+
+func TestReflectorListStreamRetry(t *testing.T) {
+	stopCh := make(chan struct{})
+	indexer := NewIndexer(DeletionHandlingMetaNamespaceKeyFunc, Indexers{})
+	f := NewDeltaFIFOWithOptions(DeltaFIFOOptions{
+		KeyFunction:           MetaNamespaceKeyFunc,
+		KnownObjects:          indexer,
+		EmitDeltaTypeReplaced: true,
+	})
+	pod := func(name string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, ResourceVersion: "10"}}
+	}
+
+	lists := 0
+	lw := &testStreamingLW{
+		testLW: testLW{
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				// Stop once the reflector begins watching since we're only interested in the list.
+				close(stopCh)
+				return watch.NewFake(), nil
+			},
+		},
+		ListStreamFunc: func(ctx context.Context, options metav1.ListOptions, fn func(runtime.Object) error) (*metav1.ListMeta, error) {
+			lists++
+			if lists == 1 {
+				// The first list fails half way and is retried.
+				for _, name := range []string{"pod-a", "pod-b"} {
+					if err := fn(pod(name)); err != nil {
+						return nil, err
+					}
+				}
+				return nil, apierrors.NewResourceExpired("The resourceVersion for the provided list is too old.")
+			}
+			for _, name := range []string{"pod-a", "pod-c"} {
+				if err := fn(pod(name)); err != nil {
+					return nil, err
+				}
+			}
+			return &metav1.ListMeta{ResourceVersion: "10"}, nil
+		},
+	}
+	r := NewReflector(lw, &v1.Pod{}, f, 0)
+	r.ListAndWatch(stopCh)
+	if lists != 2 {
+		t.Fatalf("Expected the list to be retried, got %d lists", lists)
+	}
+
+	for queued := len(f.ListKeys()); queued > 0; queued-- {
+		_, err := f.Pop(func(obj interface{}, _ bool) error {
+			for _, d := range obj.(Deltas) {
+				if d.Type == Deleted {
+					indexer.Delete(d.Object)
+				} else {
+					indexer.Update(d.Object)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !f.HasSynced() {
+		t.Errorf("Expected the queue to be synced once the list is popped")
+	}
+	if keys := sets.NewString(indexer.ListKeys()...); !keys.Equal(sets.NewString("pod-a", "pod-c")) {
+		t.Errorf("Expected only the pods of the retried list, got %v", keys.List())
+	}
+}
+
 func TestReflectorNotPaginatingNotConsistentReads(t *testing.T) {
 	stopCh := make(chan struct{})
 	s := NewStore(MetaNamespaceKeyFunc)
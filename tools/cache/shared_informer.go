@@ -17,6 +17,7 @@ limitations under the License.
 package cache
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -229,6 +230,18 @@ type ResourceEventHandlerRegistration interface {
 	HasSynced() bool
 }
 
+// SharedInformerWithContext is a SharedInformer which can also be run with a
+// context. It is implemented by the informers of this package, but is not
+// part of SharedInformer so that other implementations keep working; use a
+// type assertion to check for it.
+type SharedInformerWithContext interface {
+	SharedInformer
+	// RunWithContext starts and runs the shared informer, returning after
+	// it stops. The informer will be stopped when ctx is done, and logs
+	// through the logger of ctx.
+	RunWithContext(ctx context.Context)
+}
+
 // SharedIndexInformer provides add and get Indexers ability based on SharedInformer.
 type SharedIndexInformer interface {
 	SharedInformer
@@ -279,6 +292,7 @@ func NewSharedIndexInformerWithOptions(lw ListerWatcher, exampleObject runtime.O
 		defaultEventHandlerResyncPeriod: options.ResyncPeriod,
 		clock:                           realClock,
 		cacheMutationDetector:           NewCacheMutationDetector(fmt.Sprintf("%T", exampleObject)),
+		logger:                          klog.Background(),
 	}
 }
 
@@ -310,38 +324,63 @@ const (
 // WaitForNamedCacheSync is a wrapper around WaitForCacheSync that generates log messages
 // indicating that the caller identified by name is waiting for syncs, followed by
 // either a successful or failed sync.
+//
+// Contextual logging: WaitForNamedCacheSyncWithContext should be used instead of
+// WaitForNamedCacheSync in code which supports contextual logging.
 func WaitForNamedCacheSync(controllerName string, stopCh <-chan struct{}, cacheSyncs ...InformerSynced) bool {
-	klog.Infof("Waiting for caches to sync for %s", controllerName)
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	return WaitForNamedCacheSyncWithContext(ctx, controllerName, cacheSyncs...)
+}
+
+// WaitForNamedCacheSyncWithContext is a wrapper around WaitForCacheSyncWithContext
+// that generates log messages through the logger of ctx indicating that the caller
+// identified by name is waiting for syncs, followed by either a successful or failed sync.
+func WaitForNamedCacheSyncWithContext(ctx context.Context, controllerName string, cacheSyncs ...InformerSynced) bool {
+	logger := klog.FromContext(ctx)
+	logger.Info("Waiting for caches to sync", "controller", controllerName)
 
-	if !WaitForCacheSync(stopCh, cacheSyncs...) {
+	if !WaitForCacheSyncWithContext(ctx, cacheSyncs...) {
 		utilruntime.HandleError(fmt.Errorf("unable to sync caches for %s", controllerName))
 		return false
 	}
 
-	klog.Infof("Caches are synced for %s", controllerName)
+	logger.Info("Caches are synced", "controller", controllerName)
 	return true
 }
 
 // WaitForCacheSync waits for caches to populate.  It returns true if it was successful, false
 // if the controller should shutdown
 // callers should prefer WaitForNamedCacheSync()
+//
+// Contextual logging: WaitForCacheSyncWithContext should be used instead of
+// WaitForCacheSync in code which supports contextual logging.
 func WaitForCacheSync(stopCh <-chan struct{}, cacheSyncs ...InformerSynced) bool {
-	err := wait.PollImmediateUntil(syncedPollPeriod,
-		func() (bool, error) {
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	return WaitForCacheSyncWithContext(ctx, cacheSyncs...)
+}
+
+// WaitForCacheSyncWithContext waits for caches to populate.  It returns true if it was
+// successful, false if ctx is done before the caches have synced.
+// callers should prefer WaitForNamedCacheSyncWithContext()
+func WaitForCacheSyncWithContext(ctx context.Context, cacheSyncs ...InformerSynced) bool {
+	logger := klog.FromContext(ctx)
+	err := wait.PollImmediateUntilWithContext(ctx, syncedPollPeriod,
+		func(context.Context) (bool, error) {
 			for _, syncFunc := range cacheSyncs {
 				if !syncFunc() {
 					return false, nil
 				}
 			}
 			return true, nil
-		},
-		stopCh)
+		})
 	if err != nil {
-		klog.V(2).Infof("stop requested")
+		logger.V(2).Info("Stop requested")
 		return false
 	}
 
-	klog.V(4).Infof("caches populated")
+	logger.V(4).Info("Caches populated")
 	return true
 }
 
@@ -395,8 +434,14 @@ type sharedIndexInformer struct {
 	watchErrorHandler WatchErrorHandler
 
 	transform TransformFunc
+
+	// logger is the logger of the context the informer runs with, or the
+	// global logger before it runs. Guarded by startedLock.
+	logger klog.Logger
 }
 
+var _ SharedInformerWithContext = &sharedIndexInformer{}
+
 // dummyController hides the fact that a SharedInformer is different from a dedicated one
 // where a caller can `Run`.  The run method is disconnected in this case, because higher
 // level logic will decide when to start the SharedInformer and related controller.
@@ -456,15 +501,23 @@ func (s *sharedIndexInformer) SetTransform(handler TransformFunc) error {
 }
 
 func (s *sharedIndexInformer) Run(stopCh <-chan struct{}) {
+	ctx, cancel := wait.ContextForChannel(stopCh)
+	defer cancel()
+	s.RunWithContext(ctx)
+}
+
+func (s *sharedIndexInformer) RunWithContext(ctx context.Context) {
 	defer utilruntime.HandleCrash()
 
+	logger := klog.FromContext(ctx)
 	if s.HasStarted() {
-		klog.Warningf("The sharedIndexInformer has started, run more than once is not allowed")
+		logger.Info("Warning: the sharedIndexInformer has started, run more than once is not allowed")
 		return
 	}
 	fifo := NewDeltaFIFOWithOptions(DeltaFIFOOptions{
 		KnownObjects:          s.indexer,
 		EmitDeltaTypeReplaced: true,
+		Logger:                &logger,
 	})
 
 	cfg := &Config{
@@ -487,22 +540,26 @@ func (s *sharedIndexInformer) Run(stopCh <-chan struct{}) {
 		s.controller = New(cfg)
 		s.controller.(*controller).clock = s.clock
 		s.started = true
+		s.logger = logger
 	}()
 
 	// Separate stop channel because Processor should be stopped strictly after controller
 	processorStopCh := make(chan struct{})
+	processorCtx, cancel := wait.ContextForChannel(processorStopCh)
+	defer cancel()
+	processorCtx = klog.NewContext(processorCtx, logger)
 	var wg wait.Group
 	defer wg.Wait()              // Wait for Processor to stop
 	defer close(processorStopCh) // Tell Processor to stop
 	wg.StartWithChannel(processorStopCh, s.cacheMutationDetector.Run)
-	wg.StartWithChannel(processorStopCh, s.processor.run)
+	wg.StartWithContext(processorCtx, s.processor.run)
 
 	defer func() {
 		s.startedLock.Lock()
 		defer s.startedLock.Unlock()
 		s.stopped = true // Don't want any new listeners
 	}()
-	s.controller.Run(stopCh)
+	s.controller.(*controller).RunWithContext(ctx)
 }
 
 func (s *sharedIndexInformer) HasStarted() bool {
@@ -558,16 +615,16 @@ func (s *sharedIndexInformer) AddEventHandler(handler ResourceEventHandler) (Res
 	return s.AddEventHandlerWithResyncPeriod(handler, s.defaultEventHandlerResyncPeriod)
 }
 
-func determineResyncPeriod(desired, check time.Duration) time.Duration {
+func determineResyncPeriod(logger klog.Logger, desired, check time.Duration) time.Duration {
 	if desired == 0 {
 		return desired
 	}
 	if check == 0 {
-		klog.Warningf("The specified resyncPeriod %v is invalid because this shared informer doesn't support resyncing", desired)
+		logger.Info("Warning: the specified resyncPeriod is invalid because this shared informer doesn't support resyncing", "desired", desired)
 		return 0
 	}
 	if desired < check {
-		klog.Warningf("The specified resyncPeriod %v is being increased to the minimum resyncCheckPeriod %v", desired, check)
+		logger.Info("Warning: the specified resyncPeriod is being increased to the minimum resyncCheckPeriod", "desired", desired, "resyncCheckPeriod", check)
 		return check
 	}
 	return desired
@@ -585,25 +642,25 @@ func (s *sharedIndexInformer) AddEventHandlerWithResyncPeriod(handler ResourceEv
 
 	if resyncPeriod > 0 {
 		if resyncPeriod < minimumResyncPeriod {
-			klog.Warningf("resyncPeriod %v is too small. Changing it to the minimum allowed value of %v", resyncPeriod, minimumResyncPeriod)
+			s.logger.Info("Warning: resyncPeriod is too small. Changing it to the minimum allowed value", "resyncPeriod", resyncPeriod, "minimumResyncPeriod", minimumResyncPeriod)
 			resyncPeriod = minimumResyncPeriod
 		}
 
 		if resyncPeriod < s.resyncCheckPeriod {
 			if s.started {
-				klog.Warningf("resyncPeriod %v is smaller than resyncCheckPeriod %v and the informer has already started. Changing it to %v", resyncPeriod, s.resyncCheckPeriod, s.resyncCheckPeriod)
+				s.logger.Info("Warning: resyncPeriod is smaller than resyncCheckPeriod and the informer has already started. Changing it to the resyncCheckPeriod", "resyncPeriod", resyncPeriod, "resyncCheckPeriod", s.resyncCheckPeriod)
 				resyncPeriod = s.resyncCheckPeriod
 			} else {
 				// if the event handler's resyncPeriod is smaller than the current resyncCheckPeriod, update
 				// resyncCheckPeriod to match resyncPeriod and adjust the resync periods of all the listeners
 				// accordingly
 				s.resyncCheckPeriod = resyncPeriod
-				s.processor.resyncCheckPeriodChanged(resyncPeriod)
+				s.processor.resyncCheckPeriodChanged(s.logger, resyncPeriod)
 			}
 		}
 	}
 
-	listener := newProcessListener(handler, resyncPeriod, determineResyncPeriod(resyncPeriod, s.resyncCheckPeriod), s.clock.Now(), initialBufferSize, s.HasSynced)
+	listener := newProcessListener(handler, resyncPeriod, determineResyncPeriod(s.logger, resyncPeriod, s.resyncCheckPeriod), s.clock.Now(), initialBufferSize, s.HasSynced)
 
 	if !s.started {
 		return s.processor.addListener(listener), nil
@@ -712,6 +769,8 @@ type sharedProcessor struct {
 	listeners map[*processorListener]bool
 	clock     clock.Clock
 	wg        wait.Group
+	// ctx is the context the listeners run with while the processor runs.
+	ctx context.Context
 }
 
 func (p *sharedProcessor) getListener(registration ResourceEventHandlerRegistration) *processorListener {
@@ -742,7 +801,8 @@ func (p *sharedProcessor) addListener(listener *processorListener) ResourceEvent
 	p.listeners[listener] = true
 
 	if p.listenersStarted {
-		p.wg.Start(listener.run)
+		ctx := p.ctx
+		p.wg.Start(func() { listener.run(ctx) })
 		p.wg.Start(listener.pop)
 	}
 
@@ -791,17 +851,19 @@ func (p *sharedProcessor) distribute(obj interface{}, sync bool) {
 	}
 }
 
-func (p *sharedProcessor) run(stopCh <-chan struct{}) {
+func (p *sharedProcessor) run(ctx context.Context) {
 	func() {
-		p.listenersLock.RLock()
-		defer p.listenersLock.RUnlock()
+		p.listenersLock.Lock()
+		defer p.listenersLock.Unlock()
+		p.ctx = ctx
 		for listener := range p.listeners {
-			p.wg.Start(listener.run)
+			listener := listener
+			p.wg.Start(func() { listener.run(ctx) })
 			p.wg.Start(listener.pop)
 		}
 		p.listenersStarted = true
 	}()
-	<-stopCh
+	<-ctx.Done()
 
 	p.listenersLock.Lock()
 	defer p.listenersLock.Unlock()
@@ -841,12 +903,12 @@ func (p *sharedProcessor) shouldResync() bool {
 	return resyncNeeded
 }
 
-func (p *sharedProcessor) resyncCheckPeriodChanged(resyncCheckPeriod time.Duration) {
+func (p *sharedProcessor) resyncCheckPeriodChanged(logger klog.Logger, resyncCheckPeriod time.Duration) {
 	p.listenersLock.RLock()
 	defer p.listenersLock.RUnlock()
 
 	for listener := range p.listeners {
-		resyncPeriod := determineResyncPeriod(
+		resyncPeriod := determineResyncPeriod(logger,
 			listener.requestedResyncPeriod, resyncCheckPeriod)
 		listener.setResyncPeriod(resyncPeriod)
 	}
@@ -960,7 +1022,15 @@ func (p *processorListener) pop() {
 	}
 }
 
-func (p *processorListener) run() {
+// run delivers the notifications to the handler. Handlers implementing
+// ResourceEventHandlerWithContext get ctx, whose logger is the logger of
+// the informer.
+func (p *processorListener) run(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+	handler, ok := p.handler.(ResourceEventHandlerWithContext)
+	if !ok {
+		handler = contextlessHandler{p.handler}
+	}
 	// this call blocks until the channel is closed.  When a panic happens during the notification
 	// we will catch it, **the offending item will be skipped!**, and after a short delay (one second)
 	// the next notification will be attempted.  This is usually better than the alternative of never
@@ -970,16 +1040,16 @@ func (p *processorListener) run() {
 		for next := range p.nextCh {
 			switch notification := next.(type) {
 			case updateNotification:
-				p.handler.OnUpdate(notification.oldObj, notification.newObj)
+				handler.OnUpdateWithContext(ctx, notification.oldObj, notification.newObj)
 			case addNotification:
-				p.handler.OnAdd(notification.newObj, notification.isInInitialList)
+				handler.OnAddWithContext(ctx, notification.newObj, notification.isInInitialList)
 				if notification.isInInitialList {
 					p.syncTracker.Finished()
 				}
 			case deleteNotification:
-				p.handler.OnDelete(notification.oldObj)
+				handler.OnDeleteWithContext(ctx, notification.oldObj)
 			default:
-				utilruntime.HandleError(fmt.Errorf("unrecognized notification: %T", next))
+				logger.Error(nil, "Unrecognized notification", "type", fmt.Sprintf("%T", next))
 			}
 		}
 		// the only way to get here is if the p.nextCh is empty and closed
@@ -32,6 +32,8 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	fcache "k8s.io/client-go/tools/cache/testing"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
 	testingclock "k8s.io/utils/clock/testing"
 )
 
@@ -288,6 +290,67 @@ func TestSharedInformerInitializationRace(t *testing.T) {
 	close(stop)
 }
 
+func TestSharedInformerRunWithContext(t *testing.T) {
+	source := fcache.NewFakeControllerSource()
+	source.Add(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod1"}})
+	informer := NewSharedInformer(source, &v1.Pod{}, 0).(SharedInformerWithContext)
+
+	logger, ctx := ktesting.NewTestContext(t)
+	handled := make(chan struct{})
+	if _, err := informer.AddEventHandler(&contextHandler{onAdd: func(ctx context.Context, obj interface{}) {
+		klog.FromContext(ctx).Info("Handled", "pod", obj.(*v1.Pod).Name)
+		close(handled)
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		informer.RunWithContext(ctx)
+	}()
+	if !WaitForNamedCacheSyncWithContext(ctx, t.Name(), informer.HasSynced) {
+		t.Fatal("cache did not sync")
+	}
+	if keys := informer.GetStore().ListKeys(); len(keys) != 1 || keys[0] != "pod1" {
+		t.Errorf("unexpected store contents %v", keys)
+	}
+	select {
+	case <-handled:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("handler was not notified")
+	}
+	if logs := logger.GetSink().(ktesting.Underlier).GetBuffer().String(); !strings.Contains(logs, `Handled pod="pod1"`) {
+		t.Errorf("expected the handler to log through the logger of the context, got %q", logs)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("informer did not stop after the context was cancelled")
+	}
+	if WaitForCacheSyncWithContext(ctx, func() bool { return false }) {
+		t.Errorf("expected WaitForCacheSyncWithContext to fail for a done context")
+	}
+}
+
+// contextHandler is a ResourceEventHandler which also implements
+// ResourceEventHandlerWithContext.
+type contextHandler struct {
+	ResourceEventHandlerFuncs
+	onAdd func(ctx context.Context, obj interface{})
+}
+
+func (h *contextHandler) OnAddWithContext(ctx context.Context, obj interface{}, isInInitialList bool) {
+	h.onAdd(ctx, obj)
+}
+
+func (h *contextHandler) OnUpdateWithContext(ctx context.Context, oldObj, newObj interface{}) {}
+
+func (h *contextHandler) OnDeleteWithContext(ctx context.Context, obj interface{}) {}
+
 // TestSharedInformerWatchDisruption simulates a watch that was closed
 // with updates to the store during that time. We ensure that handlers with
 // resync and no resync see the expected state.
@@ -21,6 +21,7 @@ import (
 	"strings"
 
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 // Store is a generic object storage and processing interface.  A
@@ -70,6 +71,28 @@ type Store interface {
 	Resync() error
 }
 
+// StreamReplacer is implemented by stores which can replace their contents
+// with a list whose items are added one at a time, so that the whole list
+// does not need to be held in memory. The Reflector uses it for streamed
+// lists.
+type StreamReplacer interface {
+	// StartReplace starts replacing the contents of the store.
+	StartReplace() Replacement
+}
+
+// Replacement replaces the contents of a store with the items added to it.
+// Added items are visible in the store right away, items which are not part
+// of the new list are only deleted by Done. If a Replacement is abandoned,
+// the items added so far stay in the store until the next replacement is
+// done.
+type Replacement interface {
+	// Add adds the next item of the new list.
+	Add(obj interface{}) error
+	// Done deletes the items which were not added and finishes the
+	// replacement.
+	Done(resourceVersion string) error
+}
+
 // KeyFunc knows how to make a key from an object. Implementations should be deterministic.
 type KeyFunc func(obj interface{}) (string, error)
 
@@ -145,6 +168,7 @@ type cache struct {
 }
 
 var _ Store = &cache{}
+var _ StreamReplacer = &cache{}
 
 // Add inserts an item into the cache.
 func (c *cache) Add(obj interface{}) error {
@@ -254,6 +278,35 @@ func (c *cache) Replace(list []interface{}, resourceVersion string) error {
 	return nil
 }
 
+// StartReplace starts replacing the contents of 'c' item by item.
+func (c *cache) StartReplace() Replacement {
+	return &cacheReplacement{cache: c, keys: sets.NewString()}
+}
+
+type cacheReplacement struct {
+	cache *cache
+	keys  sets.String
+}
+
+func (r *cacheReplacement) Add(obj interface{}) error {
+	key, err := r.cache.keyFunc(obj)
+	if err != nil {
+		return KeyError{obj, err}
+	}
+	r.keys.Insert(key)
+	r.cache.cacheStorage.Update(key, obj)
+	return nil
+}
+
+func (r *cacheReplacement) Done(resourceVersion string) error {
+	for _, key := range r.cache.cacheStorage.ListKeys() {
+		if !r.keys.Has(key) {
+			r.cache.cacheStorage.Delete(key)
+		}
+	}
+	return nil
+}
+
 // Resync is meaningless for one of these
 func (c *cache) Resync() error {
 	return nil
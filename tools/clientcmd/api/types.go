@@ -93,6 +93,11 @@ type Cluster struct {
 	// attach, port forward).
 	// +optional
 	ProxyURL string `json:"proxy-url,omitempty"`
+	// TLSPins are pins of the certificate or the public key of the server, at least one of which must match.
+	// Public key pins have the format "sha256/<base64 SHA-256 hash of the SubjectPublicKeyInfo>", certificate
+	// pins the format "cert-sha256/<base64 SHA-256 hash of the certificate>". List backup pins ahead of a rotation.
+	// +optional
+	TLSPins []string `json:"tls-pins,omitempty"`
 	// DisableCompression allows client to opt-out of response compression for all requests to the server. This is useful
 	// to speed up requests (specifically lists) when client-server network bandwidth is ample, by saving time on
 	// compression (server-side) and decompression (client-side): https://github.com/kubernetes/kubernetes/issues/112296.
@@ -266,6 +271,15 @@ type ExecConfig struct {
 	// +optional
 	InteractiveMode ExecInteractiveMode
 
+	// CacheCredentials determines whether the credentials returned by this plugin are
+	// cached on disk, so that other processes using the same plugin and cluster don't
+	// have to run it again. Of the environment the plugin inherits, only variables known
+	// to select credentials, like AWS_PROFILE or CLOUDSDK_CONFIG, keep processes from
+	// sharing credentials; others which do should be set in Env. Only credentials with an
+	// expiration timestamp are cached, until they expire or are rejected by the server.
+	// +optional
+	CacheCredentials bool
+
 	// StdinUnavailable indicates whether the exec authenticator can pass standard
 	// input through to this exec plugin. For example, a higher level entity might be using
 	// standard input for something else and therefore it would not be safe for the exec
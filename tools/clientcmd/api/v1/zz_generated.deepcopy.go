@@ -119,6 +119,11 @@ func (in *Cluster) DeepCopyInto(out *Cluster) {
 		*out = make([]byte, len(*in))
 		copy(*out, *in)
 	}
+	if in.TLSPins != nil {
+		in, out := &in.TLSPins, &out.TLSPins
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Extensions != nil {
 		in, out := &in.Extensions, &out.Extensions
 		*out = make([]NamedExtension, len(*in))
@@ -281,6 +281,21 @@ func TestValidateMissingCAFileClusterInfo(t *testing.T) {
 	test.testConfig(t)
 }
 
+func TestValidateInvalidTLSPinsClusterInfo(t *testing.T) {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["bad pins"] = &clientcmdapi.Cluster{
+		Server:  "anything",
+		TLSPins: []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", "md5/abc"},
+	}
+	test := configValidationTest{
+		config:                 config,
+		expectedErrorSubstring: []string{"invalid 'tls-pins'", `invalid pin "md5/abc"`},
+	}
+
+	test.testCluster("bad pins", t)
+	test.testConfig(t)
+}
+
 func TestValidateCleanClusterInfo(t *testing.T) {
 	config := clientcmdapi.NewConfig()
 	config.Clusters["clean"] = &clientcmdapi.Cluster{
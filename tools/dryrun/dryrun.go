@@ -0,0 +1,409 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dryrun provides clients which run in plan mode: every mutating
+// request is sent as a server-side dry run, so the server validates and
+// admits it without persisting it, and the changes the server would have
+// made are recorded for a report. Reads pass through unchanged. Requests
+// to connect subresources, such as pods/exec, and upgrade requests cannot be
+// dry run, they are recorded and refused without reaching the server.
+package dryrun
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/go-cmp/cmp"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+// Change is a change the server would have made to the cluster.
+type Change struct {
+	// Verb is one of create, update, patch, delete, deletecollection and
+	// connect.
+	Verb        string
+	Resource    schema.GroupVersionResource
+	Subresource string
+	Namespace   string
+	Name        string
+
+	// Before is the object before the change. It is nil for creates,
+	// collection deletes and objects which could not be read.
+	Before *unstructured.Unstructured
+	// After is the object as the server would have stored it. It is nil
+	// if the object would have been deleted.
+	After *unstructured.Unstructured
+
+	// StatusCode is the status code of the dry run response.
+	StatusCode int
+	// Error is the message of the server if it rejected the change.
+	Error string
+}
+
+// Diff returns a human readable diff of the object before and after the
+// change. Managed fields are left out.
+func (c *Change) Diff() string {
+	return cmp.Diff(diffContent(c.Before), diffContent(c.After))
+}
+
+func (c *Change) String() string {
+	name := c.Name
+	switch {
+	case len(c.Namespace) > 0 && len(name) > 0:
+		name = c.Namespace + "/" + name
+	case len(c.Namespace) > 0:
+		name = c.Namespace
+	}
+	resource := c.Resource.Resource
+	if len(c.Resource.Group) > 0 {
+		resource += "." + c.Resource.Group
+	}
+	if len(c.Subresource) > 0 {
+		resource += "/" + c.Subresource
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", c.Verb, resource, name))
+}
+
+func diffContent(obj *unstructured.Unstructured) map[string]interface{} {
+	if obj == nil {
+		return nil
+	}
+	content := obj.DeepCopy().Object
+	unstructured.RemoveNestedField(content, "metadata", "managedFields")
+	return content
+}
+
+// Recorder records the changes of dry run requests. It is safe for
+// concurrent use.
+type Recorder struct {
+	lock    sync.Mutex
+	changes []Change
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Changes returns the recorded changes in the order they were made.
+func (r *Recorder) Changes() []Change {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Change(nil), r.changes...)
+}
+
+// Reset discards the recorded changes.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.changes = nil
+}
+
+func (r *Recorder) record(change Change) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.changes = append(r.changes, change)
+}
+
+// WriteReport writes every recorded change with its diff to w.
+func (r *Recorder) WriteReport(w io.Writer) error {
+	for _, change := range r.Changes() {
+		var report string
+		if len(change.Error) > 0 {
+			report = fmt.Sprintf("%s: rejected with %d: %s\n", change.String(), change.StatusCode, change.Error)
+		} else {
+			report = fmt.Sprintf("%s:\n%s\n", change.String(), change.Diff())
+		}
+		if _, err := io.WriteString(w, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigFor returns a copy of config whose clients send every mutating
+// request as a dry run and record it in recorder.
+func ConfigFor(config *rest.Config, recorder *Recorder) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.Wrap(Wrapper(recorder))
+	return config
+}
+
+// NewClientset returns a clientset for config in plan mode.
+func NewClientset(config *rest.Config, recorder *Recorder) (kubernetes.Interface, error) {
+	return kubernetes.NewForConfig(ConfigFor(config, recorder))
+}
+
+// NewDynamicClient returns a dynamic client for config in plan mode.
+func NewDynamicClient(config *rest.Config, recorder *Recorder) (dynamic.Interface, error) {
+	return dynamic.NewForConfig(ConfigFor(config, recorder))
+}
+
+// Wrapper returns a transport wrapper which sends every mutating request as
+// a dry run and records it in recorder.
+func Wrapper(recorder *Recorder) transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return NewRoundTripper(rt, recorder)
+	}
+}
+
+// NewRoundTripper returns a round tripper which sends every mutating
+// request to rt as a dry run and records it in recorder. Before a named
+// object is updated, patched or deleted, it is read to record the change.
+// Mutating requests ask for JSON responses, which every client can decode.
+func NewRoundTripper(rt http.RoundTripper, recorder *Recorder) http.RoundTripper {
+	return &dryRunRoundTripper{rt: rt, recorder: recorder}
+}
+
+type dryRunRoundTripper struct {
+	rt       http.RoundTripper
+	recorder *Recorder
+}
+
+var _ utilnet.RoundTripperWrapper = &dryRunRoundTripper{}
+
+func (rt *dryRunRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	change, ok := parseChange(req)
+	if !ok {
+		return rt.rt.RoundTrip(req)
+	}
+	if change.Verb == "connect" || httpstream.IsUpgradeRequest(req) {
+		// The server ignores dryRun for these requests, so they would
+		// really be executed.
+		return rt.refuse(req, change), nil
+	}
+	if len(change.Name) > 0 && req.Method != http.MethodPost {
+		change.Before = rt.get(req)
+	}
+
+	dryRun := req.Clone(req.Context())
+	query := dryRun.URL.Query()
+	query.Set("dryRun", metav1.DryRunAll)
+	dryRun.URL.RawQuery = query.Encode()
+	dryRun.Header.Set("Accept", "application/json")
+
+	resp, err := rt.rt.RoundTrip(dryRun)
+	if err != nil {
+		return nil, err
+	}
+	change.StatusCode = resp.StatusCode
+	if !isJSON(resp) {
+		// The response cannot describe the change, leave it to the caller.
+		rt.recorder.record(change)
+		return resp, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	obj := &unstructured.Unstructured{}
+	decodeErr := obj.UnmarshalJSON(data)
+	switch {
+	case resp.StatusCode < http.StatusOK || resp.StatusCode > http.StatusPartialContent:
+		change.Error = http.StatusText(resp.StatusCode)
+		var status metav1.Status
+		if err := json.Unmarshal(data, &status); err == nil && len(status.Message) > 0 {
+			change.Error = status.Message
+		}
+	case decodeErr != nil || obj.GetKind() == "Status":
+		// Responses which are not objects, such as the status of a delete.
+	case strings.HasPrefix(change.Verb, "delete") && obj.GetDeletionTimestamp() == nil:
+		// Deleted immediately, the response is the deleted object.
+	default:
+		change.After = obj
+		if len(change.Name) == 0 {
+			change.Name = obj.GetName()
+		}
+	}
+	rt.recorder.record(change)
+	return resp, nil
+}
+
+// refuse records a request which cannot be dry run and returns the error
+// response of a server which does not allow it.
+func (rt *dryRunRoundTripper) refuse(req *http.Request, change Change) *http.Response {
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Status"},
+		Status:   metav1.StatusFailure,
+		Message:  fmt.Sprintf("%s cannot be dry run", change.String()),
+		Reason:   metav1.StatusReasonMethodNotAllowed,
+		Code:     http.StatusMethodNotAllowed,
+	}
+	change.StatusCode = http.StatusMethodNotAllowed
+	change.Error = status.Message
+	rt.recorder.record(change)
+
+	data, _ := json.Marshal(status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed)),
+		StatusCode:    http.StatusMethodNotAllowed,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+}
+
+// isJSON returns whether resp has a JSON body which may be buffered.
+func isJSON(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// get reads the object a request refers to, it returns nil if the object
+// cannot be read.
+func (rt *dryRunRoundTripper) get(req *http.Request) *unstructured.Unstructured {
+	u := *req.URL
+	u.RawQuery = ""
+	get, err := http.NewRequestWithContext(req.Context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil
+	}
+	get.Header = req.Header.Clone()
+	get.Header.Del("Content-Type")
+	get.Header.Del("Content-Encoding")
+	get.Header.Set("Accept", "application/json")
+	resp, err := rt.rt.RoundTrip(get)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil
+	}
+	return obj
+}
+
+func (rt *dryRunRoundTripper) CancelRequest(req *http.Request) {
+	tryCancelRequest(rt.WrappedRoundTripper(), req)
+}
+
+func (rt *dryRunRoundTripper) WrappedRoundTripper() http.RoundTripper { return rt.rt }
+
+func tryCancelRequest(rt http.RoundTripper, req *http.Request) {
+	type canceler interface {
+		CancelRequest(*http.Request)
+	}
+	if cr, ok := rt.(canceler); ok {
+		cr.CancelRequest(req)
+	}
+}
+
+// parseChange returns the change a mutating API request or a request to a
+// connect subresource makes, it returns false for other requests.
+func parseChange(req *http.Request) (Change, bool) {
+	var change Change
+	switch req.Method {
+	case http.MethodPost:
+		change.Verb = "create"
+	case http.MethodPut:
+		change.Verb = "update"
+	case http.MethodPatch:
+		change.Verb = "patch"
+	case http.MethodDelete:
+		change.Verb = "delete"
+	}
+	parts, gv, ok := splitAPIPath(req.URL)
+	if !ok || len(parts) == 0 {
+		return change, false
+	}
+	change.Resource = gv.WithResource("")
+	if len(parts) > 2 && parts[0] == "namespaces" && !isNamespaceSubresource(parts[2:]) {
+		change.Namespace, parts = parts[1], parts[2:]
+	}
+	change.Resource.Resource = parts[0]
+	if len(parts) > 1 {
+		change.Name = parts[1]
+	}
+	if len(parts) > 2 {
+		change.Subresource = strings.Join(parts[2:], "/")
+	}
+	switch {
+	case isConnectSubresource(change.Subresource):
+		// Connect subresources are not dry run whatever the method.
+		change.Verb = "connect"
+	case len(change.Verb) == 0:
+		return change, false
+	case change.Verb == "delete" && len(change.Name) == 0:
+		change.Verb = "deletecollection"
+	}
+	return change, true
+}
+
+// isConnectSubresource returns whether requests to the subresource connect
+// to a pod, node or service, such as pods/exec or services/proxy. The server
+// ignores dryRun for them.
+func isConnectSubresource(subresource string) bool {
+	switch strings.SplitN(subresource, "/", 2)[0] {
+	case "exec", "attach", "portforward", "proxy":
+		return true
+	}
+	return false
+}
+
+// splitAPIPath returns the path segments following the group version of a
+// request to a resource API.
+func splitAPIPath(u *url.URL) ([]string, schema.GroupVersion, bool) {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		switch {
+		case segment == "api" && len(segments) > i+1:
+			return segments[i+2:], schema.GroupVersion{Version: segments[i+1]}, true
+		case segment == "apis" && len(segments) > i+2:
+			return segments[i+3:], schema.GroupVersion{Group: segments[i+1], Version: segments[i+2]}, true
+		}
+	}
+	return nil, schema.GroupVersion{}, false
+}
+
+// isNamespaceSubresource returns whether the path segments following
+// namespaces/<name> are a subresource of the namespace itself.
+func isNamespaceSubresource(parts []string) bool {
+	return len(parts) == 1 && (parts[0] == "status" || parts[0] == "finalize")
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// newConfigMapServer returns a server for the config maps of the default
+// namespace, holding the config map "a". Mutations are never persisted and
+// fail the test unless they are dry runs.
+func newConfigMapServer(t *testing.T) *httptest.Server {
+	stored := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":            "a",
+			"namespace":       "default",
+			"resourceVersion": "1",
+			"managedFields":   []interface{}{map[string]interface{}{"manager": "test"}},
+		},
+		"data": map[string]interface{}{"key": "old"},
+	}
+	const collection = "/api/v1/namespaces/default/configmaps"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		write := func(status int, obj interface{}) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(obj)
+		}
+		notFound := func() {
+			write(http.StatusNotFound, &apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, path.Base(req.URL.Path)).ErrStatus)
+		}
+		if req.Method != http.MethodGet && req.URL.Query().Get("dryRun") != metav1.DryRunAll {
+			t.Errorf("%s %s is not a dry run", req.Method, req.URL)
+		}
+		if req.Method != http.MethodGet && req.Header.Get("Accept") != "application/json" {
+			t.Errorf("expected JSON to be accepted, got %q", req.Header.Get("Accept"))
+		}
+
+		var body map[string]interface{}
+		if req.Body != nil && req.Method != http.MethodGet && req.Method != http.MethodDelete {
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				t.Errorf("failed to decode body: %v", err)
+			}
+		}
+		switch {
+		case req.URL.Path == collection && req.Method == http.MethodPost:
+			metadata := body["metadata"].(map[string]interface{})
+			if metadata["name"] == "a" {
+				write(http.StatusConflict, &apierrors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, "a").ErrStatus)
+				return
+			}
+			write(http.StatusCreated, body)
+		case req.URL.Path != collection+"/a":
+			notFound()
+		case req.Method == http.MethodGet:
+			write(http.StatusOK, stored)
+		case req.Method == http.MethodPut:
+			write(http.StatusOK, body)
+		case req.Method == http.MethodPatch:
+			patched := map[string]interface{}{}
+			for k, v := range stored {
+				patched[k] = v
+			}
+			patched["data"] = body["data"]
+			write(http.StatusOK, patched)
+		case req.Method == http.MethodDelete:
+			write(http.StatusOK, stored)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientset(t *testing.T) {
+	server := newConfigMapServer(t)
+	recorder := NewRecorder()
+	client, err := NewClientset(&rest.Config{Host: server.URL}, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	configMaps := client.CoreV1().ConfigMaps("default")
+
+	a, err := configMaps.Get(ctx, "a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Data["key"] = "new"
+	updated, err := configMaps.Update(ctx, a, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Data["key"] != "new" {
+		t.Errorf("expected the dry run result to be returned, got %v", updated.Data)
+	}
+	created := &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b"}, Data: map[string]string{"key": "b"}}
+	if _, err := configMaps.Create(ctx, created, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	created.Name = "a"
+	if _, err := configMaps.Create(ctx, created, metav1.CreateOptions{}); !apierrors.IsAlreadyExists(err) {
+		t.Errorf("expected an AlreadyExists error, got %v", err)
+	}
+	if err := configMaps.Delete(ctx, "a", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := recorder.Changes()
+	expected := []string{
+		"update configmaps default/a",
+		"create configmaps default/b",
+		"create configmaps default",
+		"delete configmaps default/a",
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %d", len(expected), len(changes))
+	}
+	for i := range expected {
+		if got := changes[i].String(); got != expected[i] {
+			t.Errorf("change %d: expected %q, got %q", i, expected[i], got)
+		}
+	}
+
+	update := changes[0]
+	if update.Before == nil || update.After == nil || update.StatusCode != http.StatusOK {
+		t.Fatalf("expected the update to record both objects, got %#v", update)
+	}
+	if diff := update.Diff(); !strings.Contains(diff, `"old"`) || !strings.Contains(diff, `"new"`) || strings.Contains(diff, "managedFields") {
+		t.Errorf("unexpected diff of the update:\n%s", diff)
+	}
+	if create := changes[1]; create.Before != nil || create.After == nil || create.After.GetName() != "b" {
+		t.Errorf("unexpected create %#v", create)
+	}
+	if conflict := changes[2]; conflict.StatusCode != http.StatusConflict || !strings.Contains(conflict.Error, "already exists") {
+		t.Errorf("expected the conflict to be recorded, got %#v", conflict)
+	}
+	if deleted := changes[3]; deleted.Before == nil || deleted.After != nil {
+		t.Errorf("expected the delete to record the removed object, got %#v", deleted)
+	}
+
+	var report bytes.Buffer
+	if err := recorder.WriteReport(&report); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range append(expected, "rejected with 409") {
+		if !strings.Contains(report.String(), line) {
+			t.Errorf("expected %q in the report:\n%s", line, report.String())
+		}
+	}
+
+	recorder.Reset()
+	if len(recorder.Changes()) != 0 {
+		t.Errorf("expected no changes after Reset")
+	}
+}
+
+func TestDynamicClient(t *testing.T) {
+	server := newConfigMapServer(t)
+	recorder := NewRecorder()
+	client, err := NewDynamicClient(&rest.Config{Host: server.URL}, recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMaps := client.Resource(v1.SchemeGroupVersion.WithResource("configmaps")).Namespace("default")
+
+	patched, err := configMaps.Patch(context.Background(), "a", types.MergePatchType, []byte(`{"data":{"key":"patched"}}`), metav1.PatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _, _ := unstructured.NestedString(patched.Object, "data", "key"); data != "patched" {
+		t.Errorf("expected the dry run result to be returned, got %v", patched.Object)
+	}
+	changes := recorder.Changes()
+	if len(changes) != 1 || changes[0].Verb != "patch" || changes[0].Before == nil || changes[0].After == nil {
+		t.Fatalf("unexpected changes %#v", changes)
+	}
+	if diff := changes[0].Diff(); !strings.Contains(diff, `"patched"`) {
+		t.Errorf("unexpected diff of the patch:\n%s", diff)
+	}
+}
+
+func TestConnectRequestsAreRefused(t *testing.T) {
+	forwarded := 0
+	recorder := NewRecorder()
+	rt := NewRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		forwarded++
+		return &http.Response{StatusCode: http.StatusSwitchingProtocols, Header: http.Header{}, Body: http.NoBody}, nil
+	}), recorder)
+
+	requests := []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/api/v1/namespaces/default/pods/a/exec?command=rm", nil),
+		httptest.NewRequest(http.MethodGet, "/api/v1/namespaces/default/pods/a/attach", nil),
+		httptest.NewRequest(http.MethodPost, "/api/v1/namespaces/default/configmaps", nil),
+	}
+	requests[2].Header.Set("Connection", "Upgrade")
+	for _, req := range requests {
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected the request to be refused, got %d", req.Method, req.URL, resp.StatusCode)
+		}
+	}
+	if forwarded != 0 {
+		t.Errorf("expected no request to be forwarded, got %d", forwarded)
+	}
+	changes := recorder.Changes()
+	if len(changes) != 3 || changes[0].String() != "connect pods/exec default/a" || len(changes[0].Error) == 0 {
+		t.Errorf("unexpected changes %v", changes)
+	}
+}
+
+func TestNonJSONResponsesAreNotBuffered(t *testing.T) {
+	body := &trackingBody{Reader: strings.NewReader("text")}
+	rt := NewRoundTripper(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusCreated, Header: http.Header{"Content-Type": []string{"text/plain"}}, Body: body}, nil
+	}), NewRecorder())
+
+	resp, err := rt.RoundTrip(httptest.NewRequest(http.MethodPost, "/api/v1/namespaces/default/configmaps", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != body || body.read {
+		t.Errorf("expected the response body to be passed through unread")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+type trackingBody struct {
+	*strings.Reader
+	read bool
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	b.read = true
+	return b.Reader.Read(p)
+}
+
+func (b *trackingBody) Close() error { return nil }
+
+func TestParseChange(t *testing.T) {
+	tests := []struct {
+		method, url string
+		expected    string
+		ok          bool
+	}{
+		{method: "GET", url: "/api/v1/namespaces/default/pods/a"},
+		{method: "POST", url: "/version"},
+		{method: "POST", url: "/api/v1/namespaces", expected: "create namespaces", ok: true},
+		{method: "PUT", url: "/api/v1/namespaces/a/finalize", expected: "update namespaces/finalize a", ok: true},
+		{method: "POST", url: "/api/v1/namespaces/default/pods/a/eviction", expected: "create pods/eviction default/a", ok: true},
+		{method: "PATCH", url: "/prefix/apis/apps/v1/namespaces/default/deployments/a/scale", expected: "patch deployments.apps/scale default/a", ok: true},
+		{method: "DELETE", url: "/apis/apps/v1/namespaces/default/deployments", expected: "deletecollection deployments.apps default", ok: true},
+		{method: "POST", url: "/api/v1/namespaces/default/pods/a/exec", expected: "connect pods/exec default/a", ok: true},
+		{method: "GET", url: "/api/v1/namespaces/default/pods/a/portforward", expected: "connect pods/portforward default/a", ok: true},
+		{method: "GET", url: "/api/v1/namespaces/default/services/a:80/proxy/healthz", expected: "connect services/proxy/healthz default/a:80", ok: true},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.url, nil)
+		change, ok := parseChange(req)
+		if ok != test.ok || (ok && change.String() != test.expected) {
+			t.Errorf("%s %s: expected %q %v, got %q %v", test.method, test.url, test.expected, test.ok, change.String(), ok)
+		}
+	}
+}
@@ -52,6 +52,35 @@ type ResultMetric interface {
 	Increment(ctx context.Context, code string, method string, host string)
 }
 
+// RetryMetric counts the number of retries sent to the server
+// partitioned by code, method, and host.
+type RetryMetric interface {
+	IncrementRetry(ctx context.Context, code string, method string, host string)
+}
+
+// RetryReasonMetric counts the number of retries sent to the server
+// partitioned by code, method, host, and the reason of the retry.
+type RetryReasonMetric interface {
+	IncrementRetry(ctx context.Context, code string, method string, host string, reason string)
+}
+
+// TransportCacheMetric shows the number of entries in the internal transport cache.
+type TransportCacheMetric interface {
+	Observe(value int)
+}
+
+// TransportCreateCallsMetric counts the number of times a transport is created
+// partitioned by the result of the cache: hit, miss, uncacheable
+type TransportCreateCallsMetric interface {
+	Increment(result string)
+}
+
+// TransportCacheEvictionsMetric counts the transports evicted from the internal
+// transport cache partitioned by the reason of the eviction: size, idle, dropped
+type TransportCacheEvictionsMetric interface {
+	Increment(reason string)
+}
+
 // CallsMetric counts calls that take place for a specific exec plugin.
 type CallsMetric interface {
 	// Increment increments a counter per exitCode and callStatus.
@@ -63,6 +92,10 @@ var (
 	ClientCertExpiry ExpiryMetric = noopExpiry{}
 	// ClientCertRotationAge is the age of a certificate that has just been rotated.
 	ClientCertRotationAge DurationMetric = noopDuration{}
+	// TokenExpiry is the expiry time of the bearer token of a token source.
+	TokenExpiry ExpiryMetric = noopExpiry{}
+	// TokenRotationAge is the age of a bearer token that has just been rotated.
+	TokenRotationAge DurationMetric = noopDuration{}
 	// RequestLatency is the latency metric that rest clients will update.
 	RequestLatency LatencyMetric = noopLatency{}
 	// RequestSize is the request size metric that rest clients will update.
@@ -76,18 +109,40 @@ var (
 	// ExecPluginCalls is the number of calls made to an exec plugin, partitioned by
 	// exit code and call status.
 	ExecPluginCalls CallsMetric = noopCalls{}
+	// RequestRetry is the retry metric that tracks the number of
+	// retries sent to the server.
+	RequestRetry RetryMetric = noopRetry{}
+	// RequestRetryReason is the retry metric that tracks the number of
+	// retries sent to the server by the reason of the retry.
+	RequestRetryReason RetryReasonMetric = noopRetryReason{}
+	// TransportCacheEntries is the metric that tracks the number of entries in the
+	// internal transport cache.
+	TransportCacheEntries TransportCacheMetric = noopTransportCache{}
+	// TransportCreateCalls is the metric that counts the number of times a new transport
+	// is created
+	TransportCreateCalls TransportCreateCallsMetric = noopTransportCreateCalls{}
+	// TransportCacheEvictions is the metric that counts the transports evicted from
+	// the internal transport cache.
+	TransportCacheEvictions TransportCacheEvictionsMetric = noopTransportCacheEvictions{}
 )
 
 // RegisterOpts contains all the metrics to register. Metrics may be nil.
 type RegisterOpts struct {
-	ClientCertExpiry      ExpiryMetric
-	ClientCertRotationAge DurationMetric
-	RequestLatency        LatencyMetric
-	RequestSize           SizeMetric
-	ResponseSize          SizeMetric
-	RateLimiterLatency    LatencyMetric
-	RequestResult         ResultMetric
-	ExecPluginCalls       CallsMetric
+	ClientCertExpiry        ExpiryMetric
+	ClientCertRotationAge   DurationMetric
+	TokenExpiry             ExpiryMetric
+	TokenRotationAge        DurationMetric
+	RequestLatency          LatencyMetric
+	RequestSize             SizeMetric
+	ResponseSize            SizeMetric
+	RateLimiterLatency      LatencyMetric
+	RequestResult           ResultMetric
+	ExecPluginCalls         CallsMetric
+	RequestRetry            RetryMetric
+	RequestRetryReason      RetryReasonMetric
+	TransportCacheEntries   TransportCacheMetric
+	TransportCreateCalls    TransportCreateCallsMetric
+	TransportCacheEvictions TransportCacheEvictionsMetric
 }
 
 // Register registers metrics for the rest client to use. This can
@@ -100,6 +155,12 @@ func Register(opts RegisterOpts) {
 		if opts.ClientCertRotationAge != nil {
 			ClientCertRotationAge = opts.ClientCertRotationAge
 		}
+		if opts.TokenExpiry != nil {
+			TokenExpiry = opts.TokenExpiry
+		}
+		if opts.TokenRotationAge != nil {
+			TokenRotationAge = opts.TokenRotationAge
+		}
 		if opts.RequestLatency != nil {
 			RequestLatency = opts.RequestLatency
 		}
@@ -118,6 +179,21 @@ func Register(opts RegisterOpts) {
 		if opts.ExecPluginCalls != nil {
 			ExecPluginCalls = opts.ExecPluginCalls
 		}
+		if opts.RequestRetry != nil {
+			RequestRetry = opts.RequestRetry
+		}
+		if opts.RequestRetryReason != nil {
+			RequestRetryReason = opts.RequestRetryReason
+		}
+		if opts.TransportCacheEntries != nil {
+			TransportCacheEntries = opts.TransportCacheEntries
+		}
+		if opts.TransportCreateCalls != nil {
+			TransportCreateCalls = opts.TransportCreateCalls
+		}
+		if opts.TransportCacheEvictions != nil {
+			TransportCacheEvictions = opts.TransportCacheEvictions
+		}
 	})
 }
 
@@ -144,3 +220,23 @@ func (noopResult) Increment(context.Context, string, string, string) {}
 type noopCalls struct{}
 
 func (noopCalls) Increment(int, string) {}
+
+type noopRetry struct{}
+
+func (noopRetry) IncrementRetry(context.Context, string, string, string) {}
+
+type noopRetryReason struct{}
+
+func (noopRetryReason) IncrementRetry(context.Context, string, string, string, string) {}
+
+type noopTransportCache struct{}
+
+func (noopTransportCache) Observe(int) {}
+
+type noopTransportCreateCalls struct{}
+
+func (noopTransportCreateCalls) Increment(string) {}
+
+type noopTransportCacheEvictions struct{}
+
+func (noopTransportCacheEvictions) Increment(string) {}
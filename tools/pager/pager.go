@@ -41,6 +41,11 @@ func SimplePageFunc(fn func(opts metav1.ListOptions) (runtime.Object, error)) Li
 	}
 }
 
+// ListStreamFunc lists the items for the given list options one at a time,
+// calling fn for every item, and returns the ListMeta of the list, see
+// rest.Request.StreamList.
+type ListStreamFunc func(ctx context.Context, opts metav1.ListOptions, fn func(item runtime.Object) error) (*metav1.ListMeta, error)
+
 // ListPager assists client code in breaking large list queries into multiple
 // smaller chunks of PageSize or smaller. PageFn is expected to accept a
 // metav1.ListOptions that supports paging and return a list. The pager does
@@ -49,6 +54,11 @@ type ListPager struct {
 	PageSize int64
 	PageFn   ListPageFunc
 
+	// StreamFn, if set, is used by EachListItem and StreamList to decode the
+	// items of every page as they are received, instead of materializing
+	// whole pages with PageFn.
+	StreamFn ListStreamFunc
+
 	FullListIfExpired bool
 
 	// Number of pages to buffer
@@ -157,11 +167,69 @@ func (p *ListPager) List(ctx context.Context, options metav1.ListOptions) (runti
 // Items are retrieved in chunks from the server to reduce the impact on the server with up to
 // ListPager.PageBufferSize chunks buffered concurrently in the background.
 func (p *ListPager) EachListItem(ctx context.Context, options metav1.ListOptions, fn func(obj runtime.Object) error) error {
+	if p.StreamFn != nil {
+		_, _, err := p.StreamList(ctx, options, fn)
+		return err
+	}
 	return p.eachListChunkBuffered(ctx, options, func(obj runtime.Object) error {
 		return meta.EachListItem(obj, fn)
 	})
 }
 
+// NewStreaming creates a new pager listing items with the provided stream
+// function using the default options. The returned pager does not support
+// List, since it never materializes a whole list.
+func NewStreaming(fn ListStreamFunc) *ListPager {
+	return &ListPager{
+		PageSize:       defaultPageSize,
+		StreamFn:       fn,
+		PageBufferSize: defaultPageBufferSize,
+	}
+}
+
+// StreamList fetches the items of a list in chunks using StreamFn and
+// invokes fn on each item as soon as it is decoded. It returns the ListMeta
+// of the last chunk, whose resource version is the one of the whole list,
+// and whether the list was paginated. If fn returns an error, processing
+// stops and that error is returned.
+//
+// Unlike List, StreamList does not fall back to a full list if a chunk
+// fails with an "Expired" error, since the items of earlier chunks were
+// already passed to fn; the error is returned instead.
+func (p *ListPager) StreamList(ctx context.Context, options metav1.ListOptions, fn func(item runtime.Object) error) (*metav1.ListMeta, bool, error) {
+	if p.StreamFn == nil {
+		return nil, false, fmt.Errorf("ListPager.StreamFn must be set to stream lists")
+	}
+	if options.Limit == 0 {
+		options.Limit = p.PageSize
+	}
+	paginated := false
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, paginated, ctx.Err()
+		default:
+		}
+
+		listMeta, err := p.StreamFn(ctx, options, fn)
+		if err != nil {
+			return nil, paginated, err
+		}
+		// if we have no more items, return.
+		if len(listMeta.Continue) == 0 {
+			return listMeta, paginated, nil
+		}
+		// set the next loop up
+		options.Continue = listMeta.Continue
+		// Clear the ResourceVersion(Match) on the subsequent List calls to avoid the
+		// `specifying resource version is not allowed when using continue` error.
+		// See https://github.com/kubernetes/kubernetes/issues/85221#issuecomment-553748143.
+		options.ResourceVersion = ""
+		options.ResourceVersionMatch = ""
+		paginated = true
+	}
+}
+
 // eachListChunkBuffered fetches runtimeObject list chunks using this ListPager and invokes fn on
 // each list chunk.  If fn returns an error, processing stops and that error is returned. If fn does
 // not return an error, any error encountered while retrieving the list from the server is
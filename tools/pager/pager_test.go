@@ -125,6 +125,21 @@ func (p *testPager) ExpiresOnSecondPageThenFullList(ctx context.Context, options
 	return p.PagedList(ctx, options)
 }
 
+// StreamedList serves the pages of PagedList item by item.
+func (p *testPager) StreamedList(ctx context.Context, options metav1.ListOptions, fn func(runtime.Object) error) (*metav1.ListMeta, error) {
+	obj, err := p.PagedList(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	list := obj.(*metainternalversion.List)
+	for _, item := range list.Items {
+		if err := fn(item); err != nil {
+			return nil, err
+		}
+	}
+	return &list.ListMeta, nil
+}
+
 func TestListPager_List(t *testing.T) {
 	type fields struct {
 		PageSize          int64
@@ -469,3 +484,50 @@ func TestListPager_eachListPageBuffered(t *testing.T) {
 		})
 	}
 }
+
+func TestListPager_StreamList(t *testing.T) {
+	tp := &testPager{t: t, expectPage: 10, remaining: 25, rv: "rv:20"}
+	p := NewStreaming(tp.StreamedList)
+	p.PageSize = 10
+
+	var names []string
+	listMeta, paginated, err := p.StreamList(context.Background(), metav1.ListOptions{ResourceVersion: "0"}, func(obj runtime.Object) error {
+		names = append(names, obj.(*metav1beta1.PartialObjectMetadata).Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !paginated || listMeta.ResourceVersion != "rv:20" || len(names) != 25 || names[24] != "24" {
+		t.Errorf("unexpected result: paginated %t, list metadata %#v, items %v", paginated, listMeta, names)
+	}
+
+	// EachListItem streams as well and stops at the first error.
+	tp = &testPager{t: t, expectPage: 10, remaining: 25, rv: "rv:20"}
+	p = NewStreaming(tp.StreamedList)
+	p.PageSize = 10
+	count := 0
+	err = p.EachListItem(context.Background(), metav1.ListOptions{}, func(obj runtime.Object) error {
+		count++
+		if count == 12 {
+			return fmt.Errorf("stop")
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "stop" || count != 12 {
+		t.Errorf("expected processing to stop at the 12th item, got %v after %d items", err, count)
+	}
+
+	// Expired continuations are returned, not retried.
+	tp = &testPager{t: t, expectPage: 10, remaining: 25, rv: "rv:20"}
+	p = NewStreaming(func(ctx context.Context, options metav1.ListOptions, fn func(runtime.Object) error) (*metav1.ListMeta, error) {
+		if _, err := tp.ExpiresOnSecondPage(ctx, options); err != nil {
+			return nil, err
+		}
+		return &metav1.ListMeta{ResourceVersion: "rv:20", Continue: "rv:20:10"}, nil
+	})
+	p.PageSize = 10
+	if _, _, err := p.StreamList(context.Background(), metav1.ListOptions{}, func(runtime.Object) error { return nil }); !errors.IsResourceExpired(err) {
+		t.Errorf("expected an expired error, got %v", err)
+	}
+}
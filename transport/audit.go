@@ -0,0 +1,376 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// AuditEvent describes a single API call made by the client.
+type AuditEvent struct {
+	// Timestamp is the time the request was sent.
+	Timestamp time.Time `json:"timestamp"`
+	// Verb is the Kubernetes verb of the request, such as get, list, watch,
+	// create, update, patch, delete or deletecollection. Requests for
+	// non-resource URLs use the lower case HTTP method.
+	Verb string `json:"verb"`
+	// Method is the HTTP method of the request.
+	Method string `json:"method"`
+	// Path is the URL path of the request.
+	Path string `json:"path"`
+
+	Group       string `json:"group,omitempty"`
+	Version     string `json:"version,omitempty"`
+	Resource    string `json:"resource,omitempty"`
+	Subresource string `json:"subresource,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Name        string `json:"name,omitempty"`
+
+	// StatusCode is the status code of the response, it is zero if no
+	// response was received.
+	StatusCode int `json:"statusCode,omitempty"`
+	// Error is the error which prevented a response from being received or
+	// its body from being read.
+	Error string `json:"error,omitempty"`
+	// LatencySeconds is the time until the response headers were received.
+	LatencySeconds float64 `json:"latencySeconds"`
+	// ResponseSize is the number of bytes of the response body read by the
+	// client. For watches, it covers the whole stream.
+	ResponseSize int64 `json:"responseSize"`
+
+	UserAgent   string              `json:"userAgent,omitempty"`
+	Impersonate *AuditImpersonation `json:"impersonate,omitempty"`
+}
+
+// AuditImpersonation is the identity a request impersonated.
+type AuditImpersonation struct {
+	UserName string              `json:"userName,omitempty"`
+	UID      string              `json:"uid,omitempty"`
+	Groups   []string            `json:"groups,omitempty"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// AuditSink receives the events of audited requests. Implementations must
+// be safe for concurrent use.
+type AuditSink interface {
+	Write(event *AuditEvent)
+}
+
+// AuditSinkFunc adapts a function to an AuditSink.
+type AuditSinkFunc func(event *AuditEvent)
+
+func (f AuditSinkFunc) Write(event *AuditEvent) {
+	f(event)
+}
+
+// NewJSONAuditSink returns a sink writing every event as a single line of
+// JSON to w. Errors writing to w are ignored.
+func NewJSONAuditSink(w io.Writer) AuditSink {
+	return &jsonAuditSink{encoder: json.NewEncoder(w)}
+}
+
+type jsonAuditSink struct {
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+func (s *jsonAuditSink) Write(event *AuditEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.encoder.Encode(event)
+}
+
+// AuditOptions configures the round tripper returned by
+// NewAuditRoundTripper.
+type AuditOptions struct {
+	// Sink receives the audit events. It is required.
+	Sink AuditSink
+	// Sample decides whether the request of an event is logged. It is called
+	// once the request completes. If nil, all requests are logged.
+	Sample func(event *AuditEvent) bool
+	// Redact may modify an event before it is written to the sink, for
+	// example to hide the names of sensitive objects.
+	Redact func(event *AuditEvent)
+}
+
+// SampleRate returns a sampling function logging the given fraction of
+// requests, along with all requests which failed.
+func SampleRate(rate float64) func(event *AuditEvent) bool {
+	return func(event *AuditEvent) bool {
+		if len(event.Error) > 0 || event.StatusCode >= http.StatusBadRequest {
+			return true
+		}
+		return rand.Float64() < rate
+	}
+}
+
+// RedactNames returns a redaction function replacing the names of objects of
+// the given resources, such as "secrets", with "<masked>". Impersonated extra
+// values are always masked by it, since they may carry credentials.
+func RedactNames(resources ...string) func(event *AuditEvent) {
+	masked := make(map[string]bool, len(resources))
+	for _, resource := range resources {
+		masked[resource] = true
+	}
+	return func(event *AuditEvent) {
+		if masked[event.Resource] && len(event.Name) > 0 {
+			event.Name = "<masked>"
+			event.Path = ""
+		}
+		if event.Impersonate != nil {
+			for key, values := range event.Impersonate.Extra {
+				for i := range values {
+					values[i] = "<masked>"
+				}
+				event.Impersonate.Extra[key] = values
+			}
+		}
+	}
+}
+
+// AuditWrapper returns a WrapperFunc auditing requests with the given
+// options. When passed to Config.Wrap, the user agent and impersonation
+// headers set by the config are part of the audited requests.
+func AuditWrapper(opts AuditOptions) WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return NewAuditRoundTripper(rt, opts)
+	}
+}
+
+// NewAuditRoundTripper returns a round tripper writing an AuditEvent for
+// every request through rt. The event of a request is written once its
+// response body is closed or read to the end, or when the request failed.
+func NewAuditRoundTripper(rt http.RoundTripper, opts AuditOptions) http.RoundTripper {
+	return &auditRoundTripper{rt: rt, opts: opts}
+}
+
+type auditRoundTripper struct {
+	rt   http.RoundTripper
+	opts AuditOptions
+}
+
+var _ utilnet.RoundTripperWrapper = &auditRoundTripper{}
+
+func (rt *auditRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	event := newAuditEvent(req)
+	start := time.Now()
+	resp, err := rt.rt.RoundTrip(req)
+	event.LatencySeconds = time.Since(start).Seconds()
+	if err != nil {
+		event.Error = err.Error()
+		rt.write(event)
+		return nil, err
+	}
+	event.StatusCode = resp.StatusCode
+	if resp.Body == nil {
+		rt.write(event)
+		return resp, nil
+	}
+	resp.Body = &auditBody{ReadCloser: resp.Body, rt: rt, event: event}
+	return resp, nil
+}
+
+func (rt *auditRoundTripper) write(event *AuditEvent) {
+	if rt.opts.Sample != nil && !rt.opts.Sample(event) {
+		return
+	}
+	if rt.opts.Redact != nil {
+		rt.opts.Redact(event)
+	}
+	rt.opts.Sink.Write(event)
+}
+
+func (rt *auditRoundTripper) CancelRequest(req *http.Request) {
+	tryCancelRequest(rt.WrappedRoundTripper(), req)
+}
+
+func (rt *auditRoundTripper) WrappedRoundTripper() http.RoundTripper { return rt.rt }
+
+// auditBody counts the bytes read from a response body and writes the event
+// of the request once the body is done. A watch body may be closed while it
+// is being read, so the event is guarded by a lock.
+type auditBody struct {
+	io.ReadCloser
+	rt *auditRoundTripper
+
+	lock    sync.Mutex
+	event   *AuditEvent
+	written bool
+}
+
+func (b *auditBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.lock.Lock()
+	b.event.ResponseSize += int64(n)
+	if err != nil && err != io.EOF {
+		b.event.Error = err.Error()
+	}
+	b.lock.Unlock()
+	if err != nil {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *auditBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.done()
+	return err
+}
+
+func (b *auditBody) done() {
+	b.lock.Lock()
+	if b.written {
+		b.lock.Unlock()
+		return
+	}
+	b.written = true
+	event := *b.event
+	b.lock.Unlock()
+	b.rt.write(&event)
+}
+
+func newAuditEvent(req *http.Request) *AuditEvent {
+	event := &AuditEvent{
+		Timestamp: time.Now(),
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		UserAgent: req.Header.Get("User-Agent"),
+	}
+	parseAuditRequest(event, req.URL)
+
+	if user := req.Header.Get(ImpersonateUserHeader); len(user) > 0 {
+		impersonate := &AuditImpersonation{
+			UserName: user,
+			UID:      req.Header.Get(ImpersonateUIDHeader),
+			Groups:   req.Header.Values(ImpersonateGroupHeader),
+		}
+		for key, values := range req.Header {
+			if !strings.HasPrefix(key, ImpersonateUserExtraHeaderPrefix) {
+				continue
+			}
+			if impersonate.Extra == nil {
+				impersonate.Extra = map[string][]string{}
+			}
+			extraKey := strings.TrimPrefix(key, ImpersonateUserExtraHeaderPrefix)
+			if unescaped, err := url.PathUnescape(extraKey); err == nil {
+				extraKey = unescaped
+			}
+			impersonate.Extra[strings.ToLower(extraKey)] = append([]string(nil), values...)
+		}
+		event.Impersonate = impersonate
+	}
+	return event
+}
+
+// parseAuditRequest fills the verb and the resource attributes of the event
+// from the request URL, following the URL layout of the API server:
+//
+//	/api/{version}[/watch][/namespaces/{namespace}]/{resource}[/{name}[/{subresource}]]
+//	/apis/{group}/{version}[/watch][/namespaces/{namespace}]/{resource}[/{name}[/{subresource}]]
+//
+// The API prefix may be preceded by a path prefix of the server.
+func parseAuditRequest(event *AuditEvent, u *url.URL) {
+	event.Verb = strings.ToLower(event.Method)
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	prefix := -1
+	for i, segment := range segments {
+		if segment == "api" || segment == "apis" {
+			prefix = i
+			break
+		}
+	}
+	if prefix < 0 {
+		return
+	}
+	parts := segments[prefix+1:]
+	if segments[prefix] == "apis" {
+		if len(parts) == 0 {
+			return
+		}
+		event.Group, parts = parts[0], parts[1:]
+	}
+	if len(parts) == 0 {
+		return
+	}
+	event.Version, parts = parts[0], parts[1:]
+	if len(parts) == 0 {
+		return
+	}
+
+	watch := false
+	if parts[0] == "watch" {
+		watch, parts = true, parts[1:]
+	}
+	if len(parts) > 2 && parts[0] == "namespaces" && !isNamespaceSubresource(parts[2:]) {
+		event.Namespace, parts = parts[1], parts[2:]
+	}
+	if len(parts) == 0 || len(parts[0]) == 0 {
+		return
+	}
+	event.Resource = parts[0]
+	if len(parts) > 1 {
+		event.Name = parts[1]
+	}
+	if len(parts) > 2 {
+		event.Subresource = strings.Join(parts[2:], "/")
+	}
+
+	if value := u.Query().Get("watch"); value == "true" || value == "1" {
+		watch = true
+	}
+	switch event.Method {
+	case http.MethodGet, http.MethodHead:
+		switch {
+		case watch:
+			event.Verb = "watch"
+		case len(event.Name) > 0:
+			event.Verb = "get"
+		default:
+			event.Verb = "list"
+		}
+	case http.MethodPost:
+		event.Verb = "create"
+	case http.MethodPut:
+		event.Verb = "update"
+	case http.MethodPatch:
+		event.Verb = "patch"
+	case http.MethodDelete:
+		if len(event.Name) > 0 {
+			event.Verb = "delete"
+		} else {
+			event.Verb = "deletecollection"
+		}
+	}
+}
+
+// isNamespaceSubresource reports whether the path segments following
+// /namespaces/{name} are a subresource of the namespace rather than a
+// namespaced resource.
+func isNamespaceSubresource(parts []string) bool {
+	return len(parts) == 1 && (parts[0] == "status" || parts[0] == "finalize")
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAuditRequest(t *testing.T) {
+	testCases := []struct {
+		method   string
+		url      string
+		expected AuditEvent
+	}{
+		{
+			method:   "GET",
+			url:      "/api/v1/namespaces/ns/pods/a",
+			expected: AuditEvent{Verb: "get", Version: "v1", Resource: "pods", Namespace: "ns", Name: "a"},
+		},
+		{
+			method:   "GET",
+			url:      "/api/v1/pods?limit=500",
+			expected: AuditEvent{Verb: "list", Version: "v1", Resource: "pods"},
+		},
+		{
+			method:   "GET",
+			url:      "/apis/apps/v1/namespaces/ns/deployments?watch=true&resourceVersion=1",
+			expected: AuditEvent{Verb: "watch", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "ns"},
+		},
+		{
+			method:   "GET",
+			url:      "/api/v1/watch/namespaces/ns/pods",
+			expected: AuditEvent{Verb: "watch", Version: "v1", Resource: "pods", Namespace: "ns"},
+		},
+		{
+			method:   "POST",
+			url:      "/api/v1/namespaces/ns/pods/a/eviction",
+			expected: AuditEvent{Verb: "create", Version: "v1", Resource: "pods", Subresource: "eviction", Namespace: "ns", Name: "a"},
+		},
+		{
+			method:   "PUT",
+			url:      "/api/v1/namespaces/ns/status",
+			expected: AuditEvent{Verb: "update", Version: "v1", Resource: "namespaces", Subresource: "status", Name: "ns"},
+		},
+		{
+			method:   "DELETE",
+			url:      "/api/v1/namespaces/ns",
+			expected: AuditEvent{Verb: "delete", Version: "v1", Resource: "namespaces", Name: "ns"},
+		},
+		{
+			method:   "DELETE",
+			url:      "/prefix/apis/batch/v1/namespaces/ns/jobs",
+			expected: AuditEvent{Verb: "deletecollection", Group: "batch", Version: "v1", Resource: "jobs", Namespace: "ns"},
+		},
+		{
+			method:   "PATCH",
+			url:      "/apis/apps/v1/namespaces/ns/deployments/d/scale",
+			expected: AuditEvent{Verb: "patch", Group: "apps", Version: "v1", Resource: "deployments", Subresource: "scale", Namespace: "ns", Name: "d"},
+		},
+		{
+			method:   "GET",
+			url:      "/apis/apps/v1",
+			expected: AuditEvent{Verb: "get", Group: "apps", Version: "v1"},
+		},
+		{
+			method:   "GET",
+			url:      "/api/v1/watch",
+			expected: AuditEvent{Verb: "get", Version: "v1"},
+		},
+		{
+			method:   "GET",
+			url:      "/api",
+			expected: AuditEvent{Verb: "get"},
+		},
+		{
+			method:   "GET",
+			url:      "/healthz",
+			expected: AuditEvent{Verb: "get"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.method+" "+tc.url, func(t *testing.T) {
+			u, err := url.Parse(tc.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			event := AuditEvent{Method: tc.method}
+			parseAuditRequest(&event, u)
+			tc.expected.Method = tc.method
+			if !reflect.DeepEqual(event, tc.expected) {
+				t.Errorf("expected %#v, got %#v", tc.expected, event)
+			}
+		})
+	}
+}
+
+func TestAuditRoundTripper(t *testing.T) {
+	var buf bytes.Buffer
+	rt := &testRoundTripper{Response: &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(`{"kind":"Secret"}`)),
+	}}
+	audit := NewAuditRoundTripper(rt, AuditOptions{
+		Sink:   NewJSONAuditSink(&buf),
+		Redact: RedactNames("secrets"),
+	})
+	impersonating := NewImpersonatingRoundTripper(ImpersonationConfig{
+		UserName: "alice",
+		Groups:   []string{"devs"},
+		Extra:    map[string][]string{"token": {"secret-value"}},
+	}, audit)
+	client := NewUserAgentRoundTripper("test-agent", impersonating)
+
+	req, _ := http.NewRequest("GET", "https://host/api/v1/namespaces/ns/secrets/db-password", nil)
+	resp, err := client.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected the event to be written once the body is done, got %s", buf.String())
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected a single line, got %q", buf.String())
+	}
+	if strings.Contains(lines[0], "db-password") || strings.Contains(lines[0], "secret-value") {
+		t.Errorf("expected sensitive values to be redacted: %s", lines[0])
+	}
+	event := AuditEvent{}
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Verb != "get" || event.Resource != "secrets" || event.Namespace != "ns" || event.Name != "<masked>" {
+		t.Errorf("unexpected request attributes %#v", event)
+	}
+	if event.StatusCode != http.StatusOK || event.ResponseSize != int64(len(`{"kind":"Secret"}`)) {
+		t.Errorf("unexpected response attributes %#v", event)
+	}
+	if event.UserAgent != "test-agent" {
+		t.Errorf("unexpected user agent %q", event.UserAgent)
+	}
+	expected := &AuditImpersonation{UserName: "alice", Groups: []string{"devs"}, Extra: map[string][]string{"token": {"<masked>"}}}
+	if !reflect.DeepEqual(event.Impersonate, expected) {
+		t.Errorf("expected impersonation %#v, got %#v", expected, event.Impersonate)
+	}
+}
+
+func TestAuditRoundTripperErrorsAndSampling(t *testing.T) {
+	var events []*AuditEvent
+	rt := &testRoundTripper{Err: errors.New("connection refused")}
+	audit := NewAuditRoundTripper(rt, AuditOptions{
+		Sink:   AuditSinkFunc(func(event *AuditEvent) { events = append(events, event) }),
+		Sample: SampleRate(0),
+	})
+
+	req, _ := http.NewRequest("POST", "https://host/api/v1/namespaces/ns/pods", nil)
+	if _, err := audit.RoundTrip(req); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(events) != 1 || events[0].Verb != "create" || events[0].Error != "connection refused" {
+		t.Fatalf("expected failed request to be logged, got %#v", events)
+	}
+
+	rt.Err = nil
+	rt.Response = &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}
+	resp, err := audit.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(events) != 1 {
+		t.Errorf("expected successful request to be sampled out, got %#v", events)
+	}
+}
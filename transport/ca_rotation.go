@@ -0,0 +1,247 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/clock"
+)
+
+// CAFileRefreshDuration is how often CA files are checked for changes. It
+// is exposed so that integration tests can crank up the reload speed.
+var CAFileRefreshDuration = time.Minute
+
+// CARotationTransitionDuration is how long the certificate authorities of
+// a CA file are still trusted after the file changed, so that servers can
+// be moved to certificates of the new authorities while clients accept
+// both.
+var CARotationTransitionDuration = 10 * time.Minute
+
+// dynamicCA verifies connections against the certificate authorities of a
+// CA file, which is reloaded periodically. When the file changes, the
+// previous authorities stay trusted for CARotationTransitionDuration and
+// idle connections are closed, once when the file changes and again when
+// the transition ends, so that new connections are verified against the
+// reloaded authorities. Active connections are left to drain.
+//
+// Verification happens in dialTLS, which performs the TLS handshake for
+// the transport. Connections through a proxy using CONNECT are set up by
+// the transport itself and keep being verified against the authorities
+// loaded when the transport was created. The transport also uses dialTLS
+// to dial HTTPS proxies, which are verified against the system roots and
+// their own host name instead.
+type dynamicCA struct {
+	caFile    string
+	tlsConfig *tls.Config
+	clock     clock.PassiveClock
+	dial      utilnet.DialFunc
+
+	// closeIdleConnections closes the idle connections of the transport
+	// using dialTLS, it is set once the transport was created.
+	closeIdleConnections func()
+
+	mtx sync.RWMutex
+	// caData is the last content of the file, previousCAData the content
+	// before the last change, trusted until transitionEnd.
+	caData         []byte
+	previousCAData []byte
+	transitionEnd  time.Time
+	pool           *x509.CertPool
+	// proxies holds the addresses of the HTTPS proxies returned by the
+	// proxy function of the transport.
+	proxies map[string]bool
+
+	// queue only ever has one item, but it has nice error handling backoff/retry semantics
+	queue workqueue.RateLimitingInterface
+}
+
+// caRotatingDialer returns a dynamicCA for the CA file of the given TLS
+// config, whose root certificate authorities were loaded from caData.
+// Connections dialed by dialTLS use tlsConfig with the reloaded authorities
+// as RootCAs.
+func caRotatingDialer(caFile string, caData []byte, tlsConfig *tls.Config, dial utilnet.DialFunc) *dynamicCA {
+	return &dynamicCA{
+		caFile:               caFile,
+		tlsConfig:            tlsConfig,
+		clock:                clock.RealClock{},
+		dial:                 dial,
+		closeIdleConnections: func() {},
+		caData:               caData,
+		pool:                 tlsConfig.RootCAs,
+		proxies:              map[string]bool{},
+		queue:                workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "DynamicCA"),
+	}
+}
+
+// wrapProxy returns a proxy function for the transport which records the
+// HTTPS proxies returned by proxy, so that dialTLS can tell them apart from
+// servers.
+func (c *dynamicCA) wrapProxy(proxy func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxyURL, err := proxy(req)
+		if err == nil && proxyURL != nil && proxyURL.Scheme == "https" {
+			port := proxyURL.Port()
+			if len(port) == 0 {
+				port = "443"
+			}
+			c.mtx.Lock()
+			c.proxies[net.JoinHostPort(proxyURL.Hostname(), port)] = true
+			c.mtx.Unlock()
+		}
+		return proxyURL, err
+	}
+}
+
+// loadCA reads the CA file, updates the trusted certificate authorities
+// and closes connections if they changed.
+func (c *dynamicCA) loadCA() error {
+	caData, err := os.ReadFile(c.caFile)
+	if err != nil {
+		return err
+	}
+	if len(caData) == 0 {
+		// An empty pool means trusting the system roots, never switch to it.
+		return fmt.Errorf("CA file %s is empty", c.caFile)
+	}
+	now := c.clock.Now()
+
+	c.mtx.Lock()
+	changed := !bytes.Equal(c.caData, caData)
+	transitionEnded := c.previousCAData != nil && !now.Before(c.transitionEnd)
+	if !changed && !transitionEnded {
+		c.mtx.Unlock()
+		return nil
+	}
+	pool, err := rootCertPool(caData)
+	if err != nil {
+		c.mtx.Unlock()
+		return fmt.Errorf("unable to load root certificates from %s: %w", c.caFile, err)
+	}
+	var previousCAData []byte
+	if changed && CARotationTransitionDuration > 0 {
+		previousCAData = c.caData
+		pool.AppendCertsFromPEM(previousCAData)
+	}
+	c.caData = caData
+	c.previousCAData = previousCAData
+	c.transitionEnd = now.Add(CARotationTransitionDuration)
+	c.pool = pool
+	c.mtx.Unlock()
+
+	if changed {
+		klog.V(1).Infof("CA file %s changed, closing idle client connections to verify servers against the new certificate authorities", c.caFile)
+	} else {
+		klog.V(1).Infof("CA rotation transition of %s ended, closing idle client connections verified against the previous certificate authorities", c.caFile)
+	}
+	c.closeIdleConnections()
+	return nil
+}
+
+// dialTLS dials a connection and performs the TLS handshake, verifying the
+// server against the current certificate authorities.
+func (c *dynamicCA) dialTLS(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := c.dial(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+
+	c.mtx.RLock()
+	var tlsConfig *tls.Config
+	if c.proxies[address] {
+		// Proxies are not part of the cluster, neither are their
+		// certificates issued by its authorities.
+		tlsConfig = &tls.Config{ServerName: host, MinVersion: c.tlsConfig.MinVersion}
+	} else {
+		tlsConfig = c.tlsConfig.Clone()
+		if len(tlsConfig.ServerName) == 0 {
+			tlsConfig.ServerName = host
+		}
+		tlsConfig.RootCAs = c.pool
+	}
+	c.mtx.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+	defer cancel()
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// Run starts the controller and blocks until stopCh is closed.
+func (c *dynamicCA) Run(stopCh <-chan struct{}) {
+	defer utilruntime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	klog.V(3).Infof("Starting CA file rotation controller")
+	defer klog.V(3).Infof("Shutting down CA file rotation controller")
+
+	go wait.Until(c.runWorker, time.Second, stopCh)
+
+	go wait.PollImmediateUntil(CAFileRefreshDuration, func() (bool, error) {
+		c.queue.Add(workItemKey)
+		return false, nil
+	}, stopCh)
+
+	<-stopCh
+}
+
+func (c *dynamicCA) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *dynamicCA) processNextWorkItem() bool {
+	dsKey, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(dsKey)
+
+	err := c.loadCA()
+	if err == nil {
+		c.queue.Forget(dsKey)
+		return true
+	}
+
+	utilruntime.HandleError(fmt.Errorf("%v failed with : %v", dsKey, err))
+	c.queue.AddRateLimited(dsKey)
+
+	return true
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// serving returns a serving certificate for 127.0.0.1 signed by the CA.
+func (ca *testCA) serving(t *testing.T) *tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// newCARotationTestServer starts an HTTPS server serving the certificate
+// stored in cert.
+func newCARotationTestServer(t *testing.T, cert *atomic.Pointer[tls.Certificate]) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}),
+		TLSConfig: &tls.Config{
+			GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return cert.Load(), nil
+			},
+		},
+	}
+	go server.ServeTLS(listener, "", "")
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func writeCAFile(t *testing.T, caFile string, data []byte) {
+	if err := os.WriteFile(caFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDynamicCA(t *testing.T) {
+	oldCA, newCA := newTestCA(t, "old"), newTestCA(t, "new")
+	oldCert, newCert := oldCA.serving(t), newCA.serving(t)
+	var cert atomic.Pointer[tls.Certificate]
+	cert.Store(oldCert)
+	addr := newCARotationTestServer(t, &cert)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	writeCAFile(t, caFile, oldCA.pem)
+	config := &Config{TLS: TLSConfig{CAFile: caFile}}
+	tlsConfig, err := TLSConfigFor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !config.TLS.ReloadCAFile {
+		t.Fatal("expected the CA file to be reloaded")
+	}
+	clock := testingclock.NewFakePassiveClock(time.Now())
+	ca := caRotatingDialer(caFile, config.TLS.CAData, tlsConfig, (&net.Dialer{}).DialContext)
+	ca.clock = clock
+	idleClosed := 0
+	ca.closeIdleConnections = func() { idleClosed++ }
+
+	dial := func(serving *tls.Certificate) error {
+		t.Helper()
+		cert.Store(serving)
+		conn, err := ca.dialTLS(context.Background(), "tcp", addr)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	}
+
+	if err := dial(oldCert); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := dial(newCert); err == nil {
+		t.Fatal("expected the certificate of the new CA to be rejected before the CA file changed")
+	}
+	cert.Store(oldCert)
+	established, err := ca.dialTLS(context.Background(), "tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer established.Close()
+
+	// Both CAs are trusted during the transition, and idle connections are
+	// closed when the file changes. Active connections are left alone.
+	writeCAFile(t, caFile, newCA.pem)
+	if err := ca.loadCA(); err != nil {
+		t.Fatal(err)
+	}
+	if idleClosed != 1 {
+		t.Errorf("expected idle connections to be closed once, got %d", idleClosed)
+	}
+	established.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := established.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected established connections to stay open, got %v", err)
+	}
+	if err := dial(newCert); err != nil {
+		t.Errorf("expected the new CA to be trusted: %v", err)
+	}
+	if err := dial(oldCert); err != nil {
+		t.Errorf("expected the old CA to be trusted during the transition: %v", err)
+	}
+
+	// Invalid content keeps the current CAs.
+	writeCAFile(t, caFile, nil)
+	if err := ca.loadCA(); err == nil {
+		t.Error("expected an empty CA file to be rejected")
+	}
+	writeCAFile(t, caFile, []byte("not a certificate"))
+	if err := ca.loadCA(); err == nil {
+		t.Error("expected an invalid CA file to be rejected")
+	}
+	writeCAFile(t, caFile, newCA.pem)
+
+	clock.SetTime(clock.Now().Add(CARotationTransitionDuration))
+	if err := ca.loadCA(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dial(newCert); err != nil {
+		t.Errorf("expected the new CA to be trusted: %v", err)
+	}
+	if err := dial(oldCert); err == nil {
+		t.Error("expected the old CA to be rejected after the transition")
+	}
+	if idleClosed != 2 {
+		t.Errorf("expected idle connections to be closed again after the transition, got %d", idleClosed)
+	}
+}
+
+func TestDynamicCAProxy(t *testing.T) {
+	ca := newTestCA(t, "cluster")
+	var cert atomic.Pointer[tls.Certificate]
+	cert.Store(ca.serving(t))
+	addr := newCARotationTestServer(t, &cert)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	writeCAFile(t, caFile, ca.pem)
+	config := &Config{TLS: TLSConfig{CAFile: caFile, ServerName: "kubernetes"}}
+	tlsConfig, err := TLSConfigFor(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dynamicCA := caRotatingDialer(caFile, config.TLS.CAData, tlsConfig, (&net.Dialer{}).DialContext)
+
+	proxyURL := &url.URL{Scheme: "https", Host: addr}
+	proxy := dynamicCA.wrapProxy(http.ProxyURL(proxyURL))
+	if _, err := proxy(httptest.NewRequest(http.MethodGet, "https://kubernetes/api", nil)); err != nil {
+		t.Fatal(err)
+	}
+	// The proxy is verified against the system roots and its own name, so
+	// the certificate issued by the cluster CA is not trusted.
+	_, err = dynamicCA.dialTLS(context.Background(), "tcp", addr)
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		t.Errorf("expected the proxy to be verified against the system roots, got %v", err)
+	}
+}
+
+func TestCAFileReload(t *testing.T) {
+	defer func(refresh time.Duration, stopCh <-chan struct{}) {
+		CAFileRefreshDuration = refresh
+		DialerStopCh = stopCh
+	}(CAFileRefreshDuration, DialerStopCh)
+	CAFileRefreshDuration = 10 * time.Millisecond
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	DialerStopCh = stopCh
+
+	oldCA, newCA := newTestCA(t, "old"), newTestCA(t, "new")
+	var cert atomic.Pointer[tls.Certificate]
+	cert.Store(oldCA.serving(t))
+	addr := newCARotationTestServer(t, &cert)
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	writeCAFile(t, caFile, oldCA.pem)
+	rt, err := New(&Config{TLS: TLSConfig{CAFile: caFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rt}
+	get := func() error {
+		resp, err := client.Get("https://" + addr)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.ProtoMajor != 2 {
+			t.Errorf("expected HTTP/2 to be negotiated, got %s", resp.Proto)
+		}
+		return nil
+	}
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+
+	cert.Store(newCA.serving(t))
+	writeCAFile(t, caFile, newCA.pem)
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return get() == nil, nil
+	}); err != nil {
+		t.Fatalf("expected the reloaded CA to be trusted: %v", get())
+	}
+}
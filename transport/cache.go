@@ -17,16 +17,22 @@ limitations under the License.
 package transport
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	utilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/metrics"
+	"k8s.io/utils/clock"
 )
 
 // TlsTransportCache caches TLS http.RoundTrippers different configurations. The
@@ -34,27 +40,152 @@ import (
 // the config has no custom TLS options, http.DefaultTransport is returned.
 type tlsTransportCache struct {
 	mu         sync.Mutex
-	transports map[tlsCacheKey]*http.Transport
+	transports map[tlsCacheKey]*list.Element
+	// lru holds the cached transports, the most recently used first.
+	lru *list.List
+	// evicted holds the evicted transports which still reload their
+	// certificates, because clients may still use them. Their reloading is
+	// stopped once they are idle.
+	evicted map[*cachedTransport]struct{}
+	opts    TransportCacheOptions
+	clock   clock.PassiveClock
 }
 
+type cachedTransport struct {
+	key       tlsCacheKey
+	transport *http.Transport
+	// stopCh is closed once the transport is evicted and idle, it stops
+	// the goroutines reloading the certificates of the transport. It is
+	// nil if the transport does not reload certificates.
+	stopCh chan struct{}
+	// lastUsed is the time, in nanoseconds since the epoch, the transport
+	// was last returned by New or sent a request.
+	lastUsed atomic.Int64
+	// openConns is the number of open connections of the transport.
+	openConns atomic.Int64
+}
+
+// touch records that the transport was used at the given time.
+func (t *cachedTransport) touch(now time.Time) {
+	t.lastUsed.Store(now.UnixNano())
+}
+
+// idleSince returns the time since the transport was last used, it is
+// zero while the transport has open connections.
+func (t *cachedTransport) idleSince(now time.Time) time.Duration {
+	if t.openConns.Load() > 0 {
+		return 0
+	}
+	return now.Sub(time.Unix(0, t.lastUsed.Load()))
+}
+
+// trackProxy returns a proxy function which records every request of the
+// transport, the transport calls it for every request it sends.
+func (t *cachedTransport) trackProxy(proxy func(*http.Request) (*url.URL, error), clock clock.PassiveClock) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		t.touch(clock.Now())
+		return proxy(req)
+	}
+}
+
+// trackDial returns a dial function which counts the open connections of
+// the transport.
+func (t *cachedTransport) trackDial(dial utilnet.DialFunc) utilnet.DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		t.openConns.Add(1)
+		return &trackedConn{Conn: conn, openConns: &t.openConns}, nil
+	}
+}
+
+// trackedConn decrements the open connections of a transport once it is
+// closed.
+type trackedConn struct {
+	net.Conn
+	once      sync.Once
+	openConns *atomic.Int64
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.openConns.Add(-1) })
+	return c.Conn.Close()
+}
+
+// TransportCacheOptions bounds the cache of transports shared by configs
+// with identical TLS options. Zero values do not bound the cache.
+type TransportCacheOptions struct {
+	// MaxSize is the maximum number of cached transports. When it is
+	// exceeded, the least recently used transport is evicted.
+	MaxSize int
+	// IdleTimeout evicts transports which have no open connections and
+	// neither sent a request nor were returned by New for the given
+	// duration. Evicted transports stop reloading their certificate and
+	// CA files once they were idle for this duration, they never stop if
+	// it is zero.
+	IdleTimeout time.Duration
+}
+
+// Reasons for evicting transports from the cache, as reported to the
+// TransportCacheEvictions metric.
+const (
+	evictionReasonSize    = "size"
+	evictionReasonIdle    = "idle"
+	evictionReasonDropped = "dropped"
+)
+
 // DialerStopCh is stop channel that is passed down to dynamic cert dialer.
 // It's exposed as variable for testing purposes to avoid testing for goroutine
-// leakages.
+// leakages. The dialers of cached transports are also stopped when the
+// transport was evicted and is idle.
 var DialerStopCh = wait.NeverStop
 
-const idleConnsPerHost = 25
+const (
+	idleConnsPerHost    = 25
+	tlsHandshakeTimeout = 10 * time.Second
+)
+
+var tlsCache = newTLSTransportCache()
+
+func newTLSTransportCache() *tlsTransportCache {
+	return &tlsTransportCache{
+		transports: make(map[tlsCacheKey]*list.Element),
+		lru:        list.New(),
+		evicted:    make(map[*cachedTransport]struct{}),
+		clock:      clock.RealClock{},
+	}
+}
+
+// SetTransportCacheOptions bounds the cache of transports returned by New,
+// evicting transports which exceed the new bounds. Evicted transports keep
+// working for clients using them, but their idle connections are closed and
+// later calls to New create a new transport. They keep reloading their
+// certificate and CA files until they were idle for opts.IdleTimeout. By
+// default, the cache is not bounded.
+func SetTransportCacheOptions(opts TransportCacheOptions) {
+	tlsCache.setOptions(opts)
+}
 
-var tlsCache = &tlsTransportCache{transports: make(map[tlsCacheKey]*http.Transport)}
+// DropCachedTransport evicts the cached transport for the TLS options of
+// config, if any, and closes its idle connections. It returns whether a
+// transport was evicted.
+func DropCachedTransport(config *Config) (bool, error) {
+	return tlsCache.drop(config)
+}
 
 type tlsCacheKey struct {
 	insecure           bool
 	caData             string
+	caFile             string
 	certData           string
 	keyData            string `datapolicy:"security-key"`
 	certFile           string
 	keyFile            string
 	serverName         string
 	nextProtos         string
+	pins               string
 	disableCompression bool
 	// these functions are wrapped to allow them to be used as map keys
 	getCert *GetCertHolder
@@ -80,11 +211,20 @@ func (c *tlsTransportCache) get(config *Config) (http.RoundTripper, error) {
 		// Ensure we only create a single transport for the given TLS options
 		c.mu.Lock()
 		defer c.mu.Unlock()
+		defer func() { metrics.TransportCacheEntries.Observe(len(c.transports)) }()
+		c.evictIdleLocked()
 
 		// See if we already have a custom transport for this config
-		if t, ok := c.transports[key]; ok {
-			return t, nil
+		if elem, ok := c.transports[key]; ok {
+			metrics.TransportCreateCalls.Increment("hit")
+			entry := elem.Value.(*cachedTransport)
+			entry.touch(c.clock.Now())
+			c.lru.MoveToFront(elem)
+			return entry.transport, nil
 		}
+		metrics.TransportCreateCalls.Increment("miss")
+	} else {
+		metrics.TransportCreateCalls.Increment("uncacheable")
 	}
 
 	// Get the TLS options for this client config
@@ -107,37 +247,167 @@ func (c *tlsTransportCache) get(config *Config) (http.RoundTripper, error) {
 		}).DialContext
 	}
 
+	// The proxy function is wrapped below, so apply the default of
+	// SetTransportDefaults, which respects CIDRs in NO_PROXY, up front.
+	proxy := utilnet.NewProxierWithNoProxyCIDR(http.ProxyFromEnvironment)
+	if config.Proxy != nil {
+		proxy = config.Proxy
+	}
+
+	var entry *cachedTransport
+	stopCh := DialerStopCh
+	if canCache {
+		entry = &cachedTransport{key: key}
+		entry.touch(c.clock.Now())
+		dial = entry.trackDial(dial)
+		proxy = entry.trackProxy(proxy, c.clock)
+		if config.TLS.ReloadTLSFiles || config.TLS.ReloadCAFile {
+			entry.stopCh = make(chan struct{})
+			stopCh = stopOnEither(DialerStopCh, entry.stopCh)
+		}
+	}
+
 	// If we use are reloading files, we need to handle certificate rotation properly
 	// TODO(jackkleeman): We can also add rotation here when config.HasCertCallback() is true
 	if config.TLS.ReloadTLSFiles {
 		dynamicCertDialer := certRotatingDialer(tlsConfig.GetClientCertificate, dial)
 		tlsConfig.GetClientCertificate = dynamicCertDialer.GetClientCertificate
 		dial = dynamicCertDialer.connDialer.DialContext
-		go dynamicCertDialer.Run(DialerStopCh)
+		go dynamicCertDialer.Run(stopCh)
 	}
 
-	proxy := http.ProxyFromEnvironment
-	if config.Proxy != nil {
-		proxy = config.Proxy
+	// If we are reloading the CA file, we need to verify servers against the reloaded CAs
+	var dynamicCA *dynamicCA
+	var dialTLS func(ctx context.Context, network, address string) (net.Conn, error)
+	if config.TLS.ReloadCAFile && tlsConfig != nil && !tlsConfig.InsecureSkipVerify {
+		dynamicCA = caRotatingDialer(config.TLS.CAFile, config.TLS.CAData, tlsConfig, dial)
+		dialTLS = dynamicCA.dialTLS
+		proxy = dynamicCA.wrapProxy(proxy)
 	}
 
 	transport := utilnet.SetTransportDefaults(&http.Transport{
 		Proxy:               proxy,
-		TLSHandshakeTimeout: 10 * time.Second,
+		TLSHandshakeTimeout: tlsHandshakeTimeout,
 		TLSClientConfig:     tlsConfig,
 		MaxIdleConnsPerHost: idleConnsPerHost,
 		DialContext:         dial,
+		DialTLSContext:      dialTLS,
 		DisableCompression:  config.DisableCompression,
 	})
 
+	if dynamicCA != nil {
+		dynamicCA.closeIdleConnections = transport.CloseIdleConnections
+		go dynamicCA.Run(stopCh)
+	}
+
 	if canCache {
 		// Cache a single transport for these options
-		c.transports[key] = transport
+		entry.transport = transport
+		c.transports[key] = c.lru.PushFront(entry)
+		c.evictOverflowLocked()
 	}
 
 	return transport, nil
 }
 
+// stopOnEither returns a channel which is closed once either a or b is
+// closed.
+func stopOnEither(a <-chan struct{}, b <-chan struct{}) <-chan struct{} {
+	stopCh := make(chan struct{})
+	go func() {
+		defer close(stopCh)
+		select {
+		case <-a:
+		case <-b:
+		}
+	}()
+	return stopCh
+}
+
+func (c *tlsTransportCache) setOptions(opts TransportCacheOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opts = opts
+	c.evictIdleLocked()
+	c.evictOverflowLocked()
+	metrics.TransportCacheEntries.Observe(len(c.transports))
+}
+
+func (c *tlsTransportCache) drop(config *Config) (bool, error) {
+	key, canCache, err := tlsConfigKey(config)
+	if err != nil || !canCache {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.transports[key]
+	if !ok {
+		return false, nil
+	}
+	c.evictLocked(elem, evictionReasonDropped)
+	metrics.TransportCacheEntries.Observe(len(c.transports))
+	return true, nil
+}
+
+// evictIdleLocked evicts the transports unused for longer than the idle
+// timeout, and stops reloading the certificates of evicted transports
+// which are unused for as long.
+func (c *tlsTransportCache) evictIdleLocked() {
+	if c.opts.IdleTimeout <= 0 {
+		return
+	}
+	now := c.clock.Now()
+	for entry := range c.evicted {
+		if entry.idleSince(now) >= c.opts.IdleTimeout {
+			close(entry.stopCh)
+			delete(c.evicted, entry)
+		}
+	}
+	for elem := c.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if elem.Value.(*cachedTransport).idleSince(now) >= c.opts.IdleTimeout {
+			c.evictLocked(elem, evictionReasonIdle)
+		}
+		elem = prev
+	}
+}
+
+// evictOverflowLocked evicts the least recently used transports until the
+// cache is within its maximum size. Transports are ordered by their last
+// use, and by their last return from New if they were last used at the
+// same time.
+func (c *tlsTransportCache) evictOverflowLocked() {
+	if c.opts.MaxSize <= 0 {
+		return
+	}
+	for c.lru.Len() > c.opts.MaxSize {
+		lru := c.lru.Back()
+		for elem := lru.Prev(); elem != nil; elem = elem.Prev() {
+			if elem.Value.(*cachedTransport).lastUsed.Load() < lru.Value.(*cachedTransport).lastUsed.Load() {
+				lru = elem
+			}
+		}
+		c.evictLocked(lru, evictionReasonSize)
+	}
+}
+
+// evictLocked removes the transport from the cache and closes its idle
+// connections. Clients may still use it, so it keeps reloading its
+// certificates unless it was evicted for being idle.
+func (c *tlsTransportCache) evictLocked(elem *list.Element, reason string) {
+	entry := c.lru.Remove(elem).(*cachedTransport)
+	delete(c.transports, entry.key)
+	if entry.stopCh != nil {
+		if reason == evictionReasonIdle {
+			close(entry.stopCh)
+		} else {
+			c.evicted[entry] = struct{}{}
+		}
+	}
+	entry.transport.CloseIdleConnections()
+	metrics.TransportCacheEvictions.Increment(reason)
+}
+
 // tlsConfigKey returns a unique key for tls.Config objects returned from TLSConfigFor
 func tlsConfigKey(c *Config) (tlsCacheKey, bool, error) {
 	// Make sure ca/key/cert content is loaded
@@ -152,14 +422,20 @@ func tlsConfigKey(c *Config) (tlsCacheKey, bool, error) {
 
 	k := tlsCacheKey{
 		insecure:           c.TLS.Insecure,
-		caData:             string(c.TLS.CAData),
 		serverName:         c.TLS.ServerName,
 		nextProtos:         strings.Join(c.TLS.NextProtos, ","),
+		pins:               strings.Join(sortedPins(c.TLS.Pins), ","),
 		disableCompression: c.DisableCompression,
 		getCert:            c.TLS.GetCertHolder,
 		dial:               c.DialHolder,
 	}
 
+	if c.TLS.ReloadCAFile {
+		k.caFile = c.TLS.CAFile
+	} else {
+		k.caData = string(c.TLS.CAData)
+	}
+
 	if c.TLS.ReloadTLSFiles {
 		k.certFile = c.TLS.CertFile
 		k.keyFile = c.TLS.KeyFile
@@ -170,3 +446,11 @@ func tlsConfigKey(c *Config) (tlsCacheKey, bool, error) {
 
 	return k, true, nil
 }
+
+// sortedPins returns a sorted copy of pins, so that configs listing the same
+// pins in a different order share a transport.
+func sortedPins(pins []string) []string {
+	sorted := append([]string(nil), pins...)
+	sort.Strings(sorted)
+	return sorted
+}
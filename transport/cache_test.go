@@ -22,8 +22,15 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"path/filepath"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/metrics"
+	testingclock "k8s.io/utils/clock/testing"
 )
 
 func TestTLSConfigKey(t *testing.T) {
@@ -143,6 +150,7 @@ func TestTLSConfigKey(t *testing.T) {
 		},
 		"http2, http1.1": {TLS: TLSConfig{NextProtos: []string{"h2", "http/1.1"}}},
 		"http1.1-only":   {TLS: TLSConfig{NextProtos: []string{"http/1.1"}}},
+		"pins":           {TLS: TLSConfig{Pins: []string{"sha256/a", "sha256/b"}}},
 	}
 	for nameA, valueA := range uniqueConfigurations {
 		for nameB, valueB := range uniqueConfigurations {
@@ -187,4 +195,243 @@ func TestTLSConfigKey(t *testing.T) {
 			}
 		}
 	}
+
+	// Make sure the order of pins doesn't affect the cache key
+	pins := []string{"sha256/b", "sha256/a"}
+	keyA, _, err := tlsConfigKey(&Config{TLS: TLSConfig{Pins: []string{"sha256/a", "sha256/b"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, _, err := tlsConfigKey(&Config{TLS: TLSConfig{Pins: pins}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyA != keyB {
+		t.Errorf("Expected identical cache keys for reordered pins, got:\n\t%s\n\t%s", keyA, keyB)
+	}
+	if pins[0] != "sha256/b" {
+		t.Errorf("Expected the pins of the config to be left alone, got %v", pins)
+	}
+}
+
+type fakeCounter map[string]int
+
+func (c fakeCounter) Increment(label string) { c[label]++ }
+
+type fakeTransportCacheMetrics struct {
+	entries   int
+	calls     fakeCounter
+	evictions fakeCounter
+}
+
+func (m *fakeTransportCacheMetrics) Observe(value int) { m.entries = value }
+
+func TestTransportCacheEviction(t *testing.T) {
+	defer func(entries metrics.TransportCacheMetric, calls metrics.TransportCreateCallsMetric, evictions metrics.TransportCacheEvictionsMetric) {
+		metrics.TransportCacheEntries = entries
+		metrics.TransportCreateCalls = calls
+		metrics.TransportCacheEvictions = evictions
+	}(metrics.TransportCacheEntries, metrics.TransportCreateCalls, metrics.TransportCacheEvictions)
+	m := &fakeTransportCacheMetrics{calls: fakeCounter{}, evictions: fakeCounter{}}
+	metrics.TransportCacheEntries = m
+	metrics.TransportCreateCalls = m.calls
+	metrics.TransportCacheEvictions = m.evictions
+
+	clock := testingclock.NewFakePassiveClock(time.Now())
+	cache := newTLSTransportCache()
+	cache.clock = clock
+	cache.setOptions(TransportCacheOptions{MaxSize: 2, IdleTimeout: time.Minute})
+
+	configFor := func(serverName string) *Config {
+		return &Config{TLS: TLSConfig{ServerName: serverName}}
+	}
+	get := func(serverName string) http.RoundTripper {
+		t.Helper()
+		rt, err := cache.get(configFor(serverName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rt
+	}
+
+	a := get("a")
+	get("b")
+	if get("a") != a {
+		t.Fatal("expected the cached transport to be returned")
+	}
+	// b is the least recently used transport.
+	get("c")
+	if m.entries != 2 || m.evictions[evictionReasonSize] != 1 {
+		t.Errorf("expected b to be evicted, got %d entries and evictions %v", m.entries, m.evictions)
+	}
+	if get("a") != a {
+		t.Error("expected a to stay cached")
+	}
+	get("b")
+	if m.calls["hit"] != 2 || m.calls["miss"] != 4 {
+		t.Errorf("unexpected calls %v", m.calls)
+	}
+
+	clock.SetTime(clock.Now().Add(time.Minute))
+	if get("a") == a {
+		t.Error("expected idle transports to be evicted")
+	}
+	if m.entries != 1 || m.evictions[evictionReasonIdle] != 2 {
+		t.Errorf("expected all idle transports to be evicted, got %d entries and evictions %v", m.entries, m.evictions)
+	}
+
+	dropped, err := cache.drop(configFor("a"))
+	if !dropped || err != nil {
+		t.Errorf("expected a to be dropped, got %v %v", dropped, err)
+	}
+	dropped, err = cache.drop(configFor("a"))
+	if dropped || err != nil {
+		t.Errorf("expected a to be dropped only once, got %v %v", dropped, err)
+	}
+	if m.entries != 0 || m.evictions[evictionReasonDropped] != 1 {
+		t.Errorf("unexpected %d entries and evictions %v", m.entries, m.evictions)
+	}
+}
+
+func TestTransportCacheIdleUse(t *testing.T) {
+	// httptest.Server is not used since closing it sets up
+	// http.DefaultTransport, which TestNew expects to be untouched.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	clock := testingclock.NewFakePassiveClock(time.Now())
+	cache := newTLSTransportCache()
+	cache.clock = clock
+	cache.setOptions(TransportCacheOptions{IdleTimeout: time.Minute})
+
+	config := &Config{TLS: TLSConfig{ServerName: "a"}}
+	rt, err := cache.get(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "http://"+listener.Addr().String(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	evicted := func() bool {
+		t.Helper()
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		cache.evictIdleLocked()
+		return cache.lru.Len() == 0
+	}
+
+	// Transports with open connections are not idle.
+	get()
+	clock.SetTime(clock.Now().Add(2 * time.Minute))
+	if evicted() {
+		t.Fatal("expected a transport with open connections to stay cached")
+	}
+	// Requests count as use.
+	rt.(*http.Transport).CloseIdleConnections()
+	get()
+	rt.(*http.Transport).CloseIdleConnections()
+	clock.SetTime(clock.Now().Add(30 * time.Second))
+	if evicted() {
+		t.Fatal("expected a recently used transport to stay cached")
+	}
+	clock.SetTime(clock.Now().Add(30 * time.Second))
+	if !evicted() {
+		t.Error("expected the unused transport to be evicted")
+	}
+}
+
+func TestTransportCacheEvictedTransportsReload(t *testing.T) {
+	defer func(refresh time.Duration, stopCh <-chan struct{}) {
+		CAFileRefreshDuration = refresh
+		DialerStopCh = stopCh
+	}(CAFileRefreshDuration, DialerStopCh)
+	CAFileRefreshDuration = 10 * time.Millisecond
+	dialerStopCh := make(chan struct{})
+	defer close(dialerStopCh)
+	DialerStopCh = dialerStopCh
+
+	oldCA, newCA := newTestCA(t, "old"), newTestCA(t, "new")
+	var cert atomic.Pointer[tls.Certificate]
+	cert.Store(oldCA.serving(t))
+	addr := newCARotationTestServer(t, &cert)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	writeCAFile(t, caFile, oldCA.pem)
+
+	clock := testingclock.NewFakePassiveClock(time.Now())
+	cache := newTLSTransportCache()
+	cache.clock = clock
+	cache.setOptions(TransportCacheOptions{MaxSize: 1, IdleTimeout: time.Minute})
+
+	config := &Config{TLS: TLSConfig{CAFile: caFile}}
+	rt, err := cache.get(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _, err := tlsConfigKey(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopCh := cache.transports[key].Value.(*cachedTransport).stopCh
+	get := func() error {
+		req, err := http.NewRequest(http.MethodGet, "https://"+addr, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if err := get(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Evict the transport for the size of the cache.
+	if _, err := cache.get(&Config{TLS: TLSConfig{CAData: newCA.pem}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.transports[key]; ok {
+		t.Fatal("expected the transport to be evicted")
+	}
+
+	// Clients still using the evicted transport trust the rotated CA.
+	cert.Store(newCA.serving(t))
+	writeCAFile(t, caFile, newCA.pem)
+	if err := wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return get() == nil, nil
+	}); err != nil {
+		t.Fatalf("expected the evicted transport to reload the CA: %v", get())
+	}
+	select {
+	case <-stopCh:
+		t.Fatal("expected the evicted transport to keep reloading the CA while it is used")
+	default:
+	}
+
+	// Reloading stops once the evicted transport is idle.
+	rt.(*http.Transport).CloseIdleConnections()
+	clock.SetTime(clock.Now().Add(time.Minute))
+	cache.mu.Lock()
+	cache.evictIdleLocked()
+	cache.mu.Unlock()
+	select {
+	case <-stopCh:
+	default:
+		t.Error("expected the idle evicted transport to stop reloading the CA")
+	}
 }
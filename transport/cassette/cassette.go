@@ -0,0 +1,122 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cassette records the HTTP interactions of a client with an API
+// server into a cassette file, and replays them in tests without a server.
+//
+// A Recorder wraps the transport of a client talking to a real cluster:
+//
+//	recorder := cassette.NewRecorder()
+//	config.Wrap(recorder.Wrap)
+//	... exercise the client ...
+//	err := recorder.Save("testdata/my-test.json")
+//
+// A Replayer serves the recorded responses:
+//
+//	replayer, err := cassette.NewReplayerFromFile("testdata/my-test.json", nil)
+//	config := &rest.Config{Host: "https://example.com", Transport: replayer}
+//
+// Authorization headers and the data of Secrets are redacted before they
+// are recorded.
+package cassette
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"unicode/utf8"
+)
+
+// Cassette is a sequence of recorded HTTP interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response.
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+	// Stream is true for responses to watch requests. Their body holds all
+	// the data received until the stream was closed.
+	Stream bool `json:"stream,omitempty"`
+}
+
+// Body is a recorded request or response body. It is stored as a string if
+// it is valid UTF-8, and base64 encoded otherwise.
+type Body []byte
+
+type encodedBody struct {
+	Base64 []byte `json:"base64"`
+}
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(encodedBody{Base64: b})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var encoded encodedBody
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("body must be a string or an object with a base64 field: %v", err)
+	}
+	*b = encoded.Base64
+	return nil
+}
+
+// Load reads a cassette from the given file.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("error decoding cassette %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save writes the cassette to the given file.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
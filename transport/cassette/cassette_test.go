@@ -0,0 +1,265 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func newCassetteTestServer(t *testing.T) *httptest.Server {
+	writeJSON := func(w http.ResponseWriter, obj interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(obj)
+	}
+	pod := func(name string) v1.Pod {
+		return v1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: name, ResourceVersion: "1"},
+		}
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer s3cr3t-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case req.URL.Path == "/api/v1/namespaces/ns/secrets/creds":
+			writeJSON(w, &v1.Secret{
+				TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "creds"},
+				Data:       map[string][]byte{"password": []byte("s3cr3t-password")},
+			})
+		case req.URL.Path == "/api/v1/namespaces/ns/secrets" && req.Method == "POST":
+			secret := &v1.Secret{}
+			json.NewDecoder(req.Body).Decode(secret)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(secret)
+		case req.URL.Path == "/api/v1/namespaces/ns/pods" && req.URL.Query().Get("watch") == "true":
+			w.Header().Set("Content-Type", "application/json")
+			for _, event := range []watch.EventType{watch.Added, watch.Modified} {
+				data, _ := json.Marshal(pod("a"))
+				json.NewEncoder(w).Encode(metav1.WatchEvent{Type: string(event), Object: runtime.RawExtension{Raw: data}})
+				w.(http.Flusher).Flush()
+			}
+		case req.URL.Path == "/api/v1/namespaces/ns/pods":
+			writeJSON(w, &v1.PodList{
+				TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"},
+				Items:    []v1.Pod{pod("a"), pod("b")},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type cassetteTestResult struct {
+	password   string
+	created    string
+	pods       []string
+	events     []watch.EventType
+	notFoundOK bool
+}
+
+func exerciseCassetteClient(t *testing.T, client kubernetes.Interface) cassetteTestResult {
+	ctx := context.Background()
+	result := cassetteTestResult{}
+
+	secret, err := client.CoreV1().Secrets("ns").Get(ctx, "creds", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result.password = string(secret.Data["password"])
+
+	created, err := client.CoreV1().Secrets("ns").Create(ctx, &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "new"},
+		StringData: map[string]string{"token": "s3cr3t-string-data"},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result.created = created.StringData["token"]
+
+	pods, err := client.CoreV1().Pods("ns").List(ctx, metav1.ListOptions{ResourceVersion: "0", Limit: 500})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, pod := range pods.Items {
+		result.pods = append(result.pods, pod.Name)
+	}
+
+	w, err := client.CoreV1().Pods("ns").Watch(ctx, metav1.ListOptions{ResourceVersion: "1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for event := range w.ResultChan() {
+		result.events = append(result.events, event.Type)
+	}
+
+	_, err = client.CoreV1().ConfigMaps("ns").Get(ctx, "missing", metav1.GetOptions{})
+	result.notFoundOK = err != nil
+	return result
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := newCassetteTestServer(t)
+	recorder := NewRecorder()
+	config := &rest.Config{Host: server.URL, BearerToken: "s3cr3t-token"}
+	config.Wrap(recorder.Wrap)
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := exerciseCassetteClient(t, client)
+	want := cassetteTestResult{
+		password:   "s3cr3t-password",
+		created:    "s3cr3t-string-data",
+		pods:       []string{"a", "b"},
+		events:     []watch.EventType{watch.Added, watch.Modified},
+		notFoundOK: true,
+	}
+	if !reflect.DeepEqual(recorded, want) {
+		t.Fatalf("expected %#v, got %#v", want, recorded)
+	}
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"s3cr3t", "czNjcjN0"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains secret %q:\n%s", secret, data)
+		}
+	}
+
+	replayer, err := NewReplayerFromFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err = kubernetes.NewForConfig(&rest.Config{Host: "https://replay.invalid", Transport: replayer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := exerciseCassetteClient(t, client)
+	want.password = Redacted
+	want.created = Redacted
+	if !reflect.DeepEqual(replayed, want) {
+		t.Errorf("expected %#v, got %#v", want, replayed)
+	}
+	if remaining := replayer.Remaining(); len(remaining) != 0 {
+		t.Errorf("unexpected remaining interactions %#v", remaining)
+	}
+
+	// Every interaction is only replayed once.
+	if _, err := client.CoreV1().Pods("ns").List(context.Background(), metav1.ListOptions{ResourceVersion: "0", Limit: 500}); err == nil {
+		t.Errorf("expected error for request without recorded interaction")
+	}
+}
+
+func TestReplayerMatching(t *testing.T) {
+	c := &Cassette{Interactions: []Interaction{
+		{
+			Request:  Request{Method: "POST", URL: "https://a/api?x=1&y=2", Body: Body(`{"a":1}`)},
+			Response: Response{StatusCode: http.StatusCreated, Body: Body("first")},
+		},
+		{
+			Request:  Request{Method: "POST", URL: "https://a/api?x=1&y=2", Body: Body(`{"a":2}`)},
+			Response: Response{StatusCode: http.StatusCreated, Body: Body("second")},
+		},
+	}}
+	do := func(rt http.RoundTripper, body string) string {
+		req, _ := http.NewRequest("POST", "http://b/api?y=2&x=1", strings.NewReader(body))
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return err.Error()
+		}
+		data := make([]byte, 16)
+		n, _ := resp.Body.Read(data)
+		return string(data[:n])
+	}
+
+	replayer := NewReplayer(c, nil)
+	if got := do(replayer, `{"a":2}`); got != "first" {
+		t.Errorf("expected the first interaction in order, got %q", got)
+	}
+
+	replayer = NewReplayer(c, MatchAll(MatchMethodAndURL, MatchBody))
+	if got := do(replayer, `{"a":2}`); got != "second" {
+		t.Errorf("expected the interaction with the same body, got %q", got)
+	}
+	if got := do(replayer, `{"a":2}`); !strings.Contains(got, "no recorded interaction") {
+		t.Errorf("expected error, got %q", got)
+	}
+}
+
+func TestBodyJSON(t *testing.T) {
+	for _, body := range []Body{Body("text"), Body{0xff, 0x00, 0x01}, nil} {
+		data, err := json.Marshal(struct {
+			Body Body `json:"body,omitempty"`
+		}{body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded struct {
+			Body Body `json:"body,omitempty"`
+		}
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if string(decoded.Body) != string(body) {
+			t.Errorf("expected %q after round trip through %s, got %q", body, data, decoded.Body)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	list := `{"kind":"SecretList","items":[{"metadata":{"name":"a"},"data":{"k":"c2VjcmV0"}}]}`
+	if got := string(redactBody("/api/v1/secrets", []byte(list))); strings.Contains(got, "c2VjcmV0") {
+		t.Errorf("expected list items to be redacted, got %s", got)
+	}
+	configMap := `{"kind":"ConfigMap","data":{"k":"v"}}`
+	if got := string(redactBody("/api/v1/configmaps", []byte(configMap))); got != configMap {
+		t.Errorf("expected body to be unchanged, got %s", got)
+	}
+	if got := redactBody("/api/v1/namespaces/ns/secrets/a", []byte{0x6b, 0x38, 0x73, 0x00}); got != nil {
+		t.Errorf("expected non-JSON secret body to be dropped, got %q", got)
+	}
+	if got := string(redactBody("/api/v1/pods", []byte("not json"))); got != "not json" {
+		t.Errorf("expected non-JSON body to be unchanged, got %q", got)
+	}
+}
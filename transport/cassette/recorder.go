@@ -0,0 +1,179 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassette
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// Recorder records the interactions of round trippers wrapped by it.
+// Interactions are recorded in the order their responses are received.
+// The body of a watch response is recorded as it is read by the client,
+// so a watch should be stopped before the cassette is saved.
+type Recorder struct {
+	lock         sync.Mutex
+	interactions []*Interaction
+}
+
+// NewRecorder returns an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Wrap returns a round tripper recording all interactions through rt into
+// the recorder. If rt is nil, http.DefaultTransport is used. Wrap can be
+// passed to rest.Config.Wrap.
+func (r *Recorder) Wrap(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &recordingRoundTripper{recorder: r, rt: rt}
+}
+
+// Cassette returns the interactions recorded so far, with credentials and
+// Secret data redacted.
+func (r *Recorder) Cassette() *Cassette {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	c := &Cassette{Interactions: []Interaction{}}
+	for _, i := range r.interactions {
+		path := requestPath(i.Request.URL)
+		c.Interactions = append(c.Interactions, Interaction{
+			Request: Request{
+				Method: i.Request.Method,
+				URL:    i.Request.URL,
+				Header: redactHeader(i.Request.Header),
+				Body:   redactBody(path, i.Request.Body),
+			},
+			Response: Response{
+				StatusCode: i.Response.StatusCode,
+				Header:     redactHeader(i.Response.Header),
+				Body:       redactBody(path, i.Response.Body),
+				Stream:     i.Response.Stream,
+			},
+		})
+	}
+	return c
+}
+
+// Save writes the interactions recorded so far to the given file.
+func (r *Recorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+func (r *Recorder) add(i *Interaction) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.interactions = append(r.interactions, i)
+}
+
+func (r *Recorder) appendBody(i *Interaction, data []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	i.Response.Body = append(i.Response.Body, data...)
+}
+
+type recordingRoundTripper struct {
+	recorder *Recorder
+	rt       http.RoundTripper
+}
+
+var _ utilnet.RoundTripperWrapper = &recordingRoundTripper{}
+
+func (rt *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := rt.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: req.Header.Clone(),
+			Body:   body,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+			Stream:     isWatch(req),
+		},
+	}
+	rt.recorder.add(i)
+
+	if i.Response.Stream {
+		resp.Body = &recordingBody{ReadCloser: resp.Body, recorder: rt.recorder, interaction: i}
+		return resp, nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	rt.recorder.appendBody(i, data)
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+func (rt *recordingRoundTripper) WrappedRoundTripper() http.RoundTripper { return rt.rt }
+
+// recordingBody records the data of a streamed response as it is read.
+type recordingBody struct {
+	io.ReadCloser
+	recorder    *Recorder
+	interaction *Interaction
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.recorder.appendBody(b.interaction, p[:n])
+	}
+	return n, err
+}
+
+func isWatch(req *http.Request) bool {
+	if strings.Contains(req.URL.Path, "/watch/") {
+		return true
+	}
+	switch req.URL.Query().Get("watch") {
+	case "true", "1":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Redacted replaces redacted header values and Secret data.
+const Redacted = "REDACTED"
+
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization"}
+
+// redactHeader returns a copy of the header with credentials replaced.
+func redactHeader(header http.Header) http.Header {
+	if len(header) == 0 {
+		return nil
+	}
+	header = header.Clone()
+	for _, key := range redactedHeaders {
+		if len(header.Values(key)) > 0 {
+			header.Set(key, Redacted)
+		}
+	}
+	return header
+}
+
+// redactBody replaces the data of all Secrets in a JSON body, which may be a
+// stream of JSON values such as watch events. Bodies which are not JSON are
+// dropped entirely if they belong to a request for secrets, since their
+// content cannot be inspected.
+func redactBody(path string, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	var values []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	for {
+		var value interface{}
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if isSecretsPath(path) {
+				return nil
+			}
+			return body
+		}
+		values = append(values, value)
+	}
+
+	changed := false
+	for _, value := range values {
+		if redactValue(value) {
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, value := range values {
+		if err := encoder.Encode(value); err != nil {
+			return nil
+		}
+	}
+	return buf.Bytes()
+}
+
+// redactValue replaces the data of all Secrets found in the decoded JSON
+// value and reports whether anything was replaced.
+func redactValue(value interface{}) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch v["kind"] {
+		case "Secret":
+			changed = redactSecret(v)
+		case "SecretList":
+			// Items of lists do not carry their kind.
+			if items, ok := v["items"].([]interface{}); ok {
+				for _, item := range items {
+					if secret, ok := item.(map[string]interface{}); ok && redactSecret(secret) {
+						changed = true
+					}
+				}
+			}
+		}
+		for _, field := range v {
+			if redactValue(field) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if redactValue(item) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func redactSecret(secret map[string]interface{}) bool {
+	changed := false
+	if data, ok := secret["data"].(map[string]interface{}); ok {
+		encoded := base64.StdEncoding.EncodeToString([]byte(Redacted))
+		for key := range data {
+			data[key] = encoded
+			changed = true
+		}
+	}
+	if data, ok := secret["stringData"].(map[string]interface{}); ok {
+		for key := range data {
+			data[key] = Redacted
+			changed = true
+		}
+	}
+	// The last applied configuration of kubectl apply holds the data as well.
+	if metadata, ok := secret["metadata"].(map[string]interface{}); ok {
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+			if _, ok := annotations[lastApplied]; ok {
+				annotations[lastApplied] = Redacted
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func isSecretsPath(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "secrets" {
+			return true
+		}
+	}
+	return false
+}
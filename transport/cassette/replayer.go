@@ -0,0 +1,172 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sync"
+)
+
+// MatchFunc reports whether a recorded request matches the request being
+// replayed. body is the body of the request being replayed, redacted the
+// same way as recorded bodies.
+type MatchFunc func(req *http.Request, body []byte, recorded *Request) bool
+
+// MatchMethodAndURL matches requests with the same method, path and query
+// parameters, regardless of the order of the parameters. The scheme and
+// host are ignored so that cassettes can be replayed against any server
+// address. It is the default MatchFunc.
+func MatchMethodAndURL(req *http.Request, _ []byte, recorded *Request) bool {
+	if req.Method != recorded.Method {
+		return false
+	}
+	u, err := url.Parse(recorded.URL)
+	if err != nil {
+		return false
+	}
+	return req.URL.Path == u.Path && reflect.DeepEqual(req.URL.Query(), u.Query())
+}
+
+// MatchBody matches requests with identical bodies.
+func MatchBody(_ *http.Request, body []byte, recorded *Request) bool {
+	return bytes.Equal(body, recorded.Body)
+}
+
+// MatchAll returns a MatchFunc matching requests matched by all fns.
+func MatchAll(fns ...MatchFunc) MatchFunc {
+	return func(req *http.Request, body []byte, recorded *Request) bool {
+		for _, fn := range fns {
+			if !fn(req, body, recorded) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Replayer is a round tripper serving the responses of a cassette. Every
+// recorded interaction is replayed at most once, a request is answered with
+// the first matching interaction which has not been replayed yet. Requests
+// without such an interaction fail.
+type Replayer struct {
+	cassette *Cassette
+	match    MatchFunc
+
+	lock     sync.Mutex
+	replayed []bool
+}
+
+var _ http.RoundTripper = &Replayer{}
+
+// NewReplayer returns a replayer for the given cassette. If match is nil,
+// MatchMethodAndURL is used.
+func NewReplayer(cassette *Cassette, match MatchFunc) *Replayer {
+	if match == nil {
+		match = MatchMethodAndURL
+	}
+	return &Replayer{
+		cassette: cassette,
+		match:    match,
+		replayed: make([]bool, len(cassette.Interactions)),
+	}
+}
+
+// NewReplayerFromFile loads the cassette in the given file and returns a
+// replayer for it.
+func NewReplayerFromFile(path string, match MatchFunc) (*Replayer, error) {
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(c, match), nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	body = redactBody(req.URL.Path, body)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range r.cassette.Interactions {
+		if r.replayed[i] {
+			continue
+		}
+		interaction := &r.cassette.Interactions[i]
+		if !r.match(req, body, &interaction.Request) {
+			continue
+		}
+		r.replayed[i] = true
+		return newResponse(req, &interaction.Response), nil
+	}
+	return nil, fmt.Errorf("cassette: no recorded interaction left for %s %s", req.Method, req.URL)
+}
+
+// Remaining returns the interactions which have not been replayed yet.
+func (r *Replayer) Remaining() []Interaction {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var remaining []Interaction
+	for i, interaction := range r.cassette.Interactions {
+		if !r.replayed[i] {
+			remaining = append(remaining, interaction)
+		}
+	}
+	return remaining
+}
+
+func newResponse(req *http.Request, recorded *Response) *http.Response {
+	contentLength := int64(len(recorded.Body))
+	if recorded.Stream {
+		contentLength = -1
+	}
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: contentLength,
+		Request:       req,
+	}
+}
+
+func requestPath(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
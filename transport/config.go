@@ -22,6 +22,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 )
 
 // Config holds various options for establishing a transport.
@@ -77,6 +78,20 @@ type Config struct {
 	//
 	// socks5 proxying does not currently support spdy streaming endpoints.
 	Proxy func(*http.Request) (*url.URL, error)
+
+	// Endpoints is an optional list of equivalent API server URLs sharing
+	// the TLS settings of this config. If more than one endpoint is set,
+	// requests addressed to any of them are distributed across the healthy
+	// endpoints according to EndpointSelection.
+	Endpoints []string
+
+	// EndpointSelection controls how requests are distributed across
+	// Endpoints. Defaults to EndpointSelectionOrdered.
+	EndpointSelection EndpointSelection
+
+	// EndpointHealthCheckInterval is how often Endpoints are health checked.
+	// Defaults to DefaultEndpointHealthCheckInterval.
+	EndpointHealthCheckInterval time.Duration
 }
 
 // DialHolder is used to make the wrapped function comparable so that it can be used as a map key.
@@ -135,6 +150,7 @@ type TLSConfig struct {
 	CertFile       string // Path of the PEM-encoded client certificate.
 	KeyFile        string // Path of the PEM-encoded client key.
 	ReloadTLSFiles bool   // Set to indicate that the original config provided files, and that they should be reloaded
+	ReloadCAFile   bool   // Set to indicate that the original config provided a CA file, and that it should be reloaded
 
 	Insecure   bool   // Server should be accessed without verifying the certificate. For testing only.
 	ServerName string // Override for the server name passed to the server for SNI and used to verify certificates.
@@ -149,6 +165,11 @@ type TLSConfig struct {
 	// To use only http/1.1, set to ["http/1.1"].
 	NextProtos []string
 
+	// Pins are certificate and public key pins of the server, in the format
+	// described by PublicKeyPinPrefix and CertificatePinPrefix. If set, the
+	// server must match at least one of them in addition to being verified.
+	Pins []string
+
 	// Callback that returns a TLS client certificate. CertData, CertFile, KeyData and KeyFile supercede this field.
 	// This struct indirection is used to make transport configs cacheable.
 	GetCertHolder *GetCertHolder
@@ -0,0 +1,429 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/klog/v2"
+)
+
+// EndpointSelection controls how requests are distributed across the
+// endpoints of a Config.
+type EndpointSelection string
+
+const (
+	// EndpointSelectionOrdered sends every request to the first healthy
+	// endpoint in the configured order. Later endpoints are only used while
+	// the earlier ones are unhealthy.
+	EndpointSelectionOrdered EndpointSelection = "Ordered"
+	// EndpointSelectionRandom spreads requests randomly across all healthy
+	// endpoints.
+	EndpointSelectionRandom EndpointSelection = "Random"
+)
+
+const (
+	// DefaultEndpointHealthCheckInterval is used when
+	// Config.EndpointHealthCheckInterval is not set.
+	DefaultEndpointHealthCheckInterval = 10 * time.Second
+
+	endpointHealthCheckTimeout = 5 * time.Second
+	endpointHealthCheckPath    = "/readyz"
+)
+
+// endpoint is a single API server endpoint and its last known health.
+type endpoint struct {
+	url *url.URL
+
+	lock      sync.Mutex
+	healthy   bool
+	checking  bool
+	lastCheck time.Time
+	watches   map[*endpointWatchBody]struct{}
+}
+
+// endpointRoundTripper sends requests addressed to any of its endpoints to
+// a healthy one, failing over to the next endpoint when a connection cannot
+// be established. Endpoints are health checked against /readyz; watches
+// established against an endpoint which turns unhealthy are closed so that
+// the caller re-establishes them against a healthy one.
+type endpointRoundTripper struct {
+	rt        http.RoundTripper
+	endpoints []*endpoint
+	selection EndpointSelection
+	interval  time.Duration
+
+	lock       sync.Mutex
+	rand       *rand.Rand
+	monitoring bool
+}
+
+var _ utilnet.RoundTripperWrapper = &endpointRoundTripper{}
+
+// NewEndpointRoundTripper returns a round tripper which distributes requests
+// across the given endpoints according to selection, health checking them
+// every interval. Endpoints must be absolute URLs; an optional path is
+// treated as the prefix all API paths are relative to, as in rest.Config.Host.
+// Requests addressed to a URL which matches none of the endpoints are passed
+// through unmodified.
+func NewEndpointRoundTripper(rt http.RoundTripper, endpoints []string, selection EndpointSelection, interval time.Duration) (http.RoundTripper, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("at least one endpoint is required")
+	}
+	switch selection {
+	case "":
+		selection = EndpointSelectionOrdered
+	case EndpointSelectionOrdered, EndpointSelectionRandom:
+	default:
+		return nil, fmt.Errorf("unknown endpoint selection %q", selection)
+	}
+	if interval <= 0 {
+		interval = DefaultEndpointHealthCheckInterval
+	}
+	e := &endpointRoundTripper{
+		rt:        rt,
+		selection: selection,
+		interval:  interval,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, s := range endpoints {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint %q: %v", s, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q: must be an absolute URL", s)
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = ""
+		e.endpoints = append(e.endpoints, &endpoint{
+			url:     u,
+			healthy: true,
+			watches: map[*endpointWatchBody]struct{}{},
+		})
+	}
+	return e, nil
+}
+
+func (rt *endpointRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	source := rt.match(req.URL)
+	if source == nil {
+		return rt.rt.RoundTrip(req)
+	}
+	rt.checkHealth()
+
+	var lastErr error
+	for i, target := range rt.candidates() {
+		if i > 0 {
+			if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+				break
+			}
+			if req.Context().Err() != nil {
+				break
+			}
+		}
+		r, err := rewriteRequest(req, source, target.url, i > 0)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := rt.rt.RoundTrip(r)
+		if err != nil {
+			lastErr = err
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			rt.setHealthy(target, false)
+			if !isDialError(err) && !isIdempotent(req.Method) {
+				return nil, err
+			}
+			klog.V(4).Infof("Request to %s failed, trying next endpoint: %v", target.url.Host, err)
+			continue
+		}
+		if resp.StatusCode >= http.StatusInternalServerError {
+			// The server answered but may be on its way out; verify in the
+			// background rather than failing the response over.
+			rt.probe(target)
+		} else {
+			rt.setHealthy(target, true)
+		}
+		if resp.StatusCode == http.StatusOK && isWatchRequest(req) {
+			resp.Body = rt.trackWatch(target, resp.Body)
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+func (rt *endpointRoundTripper) CancelRequest(req *http.Request) {
+	tryCancelRequest(rt.WrappedRoundTripper(), req)
+}
+
+func (rt *endpointRoundTripper) WrappedRoundTripper() http.RoundTripper { return rt.rt }
+
+// match returns the endpoint the given URL is addressed to, or nil.
+func (rt *endpointRoundTripper) match(u *url.URL) *endpoint {
+	for _, e := range rt.endpoints {
+		if u.Scheme != e.url.Scheme || u.Host != e.url.Host {
+			continue
+		}
+		if e.url.Path == "" || u.Path == e.url.Path || strings.HasPrefix(u.Path, e.url.Path+"/") {
+			return e
+		}
+	}
+	return nil
+}
+
+// candidates returns all endpoints in the order they should be tried:
+// healthy endpoints according to the selection policy, followed by the
+// unhealthy ones as a last resort.
+func (rt *endpointRoundTripper) candidates() []*endpoint {
+	var healthy, unhealthy []*endpoint
+	for _, e := range rt.endpoints {
+		e.lock.Lock()
+		ok := e.healthy
+		e.lock.Unlock()
+		if ok {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	if rt.selection == EndpointSelectionRandom {
+		rt.lock.Lock()
+		rt.rand.Shuffle(len(healthy), func(i, j int) { healthy[i], healthy[j] = healthy[j], healthy[i] })
+		rt.lock.Unlock()
+	}
+	return append(healthy, unhealthy...)
+}
+
+// checkHealth starts a health check of every endpoint whose last check is
+// older than the health check interval.
+func (rt *endpointRoundTripper) checkHealth() {
+	for _, e := range rt.endpoints {
+		e.lock.Lock()
+		due := time.Since(e.lastCheck) >= rt.interval
+		e.lock.Unlock()
+		if due {
+			rt.probe(e)
+		}
+	}
+}
+
+// probe asynchronously health checks the endpoint unless a check is
+// already in progress.
+func (rt *endpointRoundTripper) probe(e *endpoint) {
+	e.lock.Lock()
+	if e.checking {
+		e.lock.Unlock()
+		return
+	}
+	e.checking = true
+	e.lock.Unlock()
+
+	go func() {
+		healthy := rt.healthCheck(e)
+		e.lock.Lock()
+		e.checking = false
+		e.lastCheck = time.Now()
+		e.lock.Unlock()
+		rt.setHealthy(e, healthy)
+	}()
+}
+
+// healthCheck reports whether the endpoint's readyz endpoint reports ready.
+// The check is sent without credentials, so a server which rejects
+// anonymous requests is considered healthy as well.
+func (rt *endpointRoundTripper) healthCheck(e *endpoint) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), endpointHealthCheckTimeout)
+	defer cancel()
+	u := *e.url
+	u.Path += endpointHealthCheckPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := rt.rt.RoundTrip(req)
+	if err != nil {
+		klog.V(4).Infof("Health check of %s failed: %v", e.url.Host, err)
+		return false
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	klog.V(4).Infof("Health check of %s returned %d", e.url.Host, resp.StatusCode)
+	return false
+}
+
+// setHealthy records the health of the endpoint. When an endpoint turns
+// unhealthy all watches established against it are closed.
+func (rt *endpointRoundTripper) setHealthy(e *endpoint, healthy bool) {
+	e.lock.Lock()
+	changed := e.healthy != healthy
+	e.healthy = healthy
+	var watches []*endpointWatchBody
+	if changed && !healthy {
+		for w := range e.watches {
+			watches = append(watches, w)
+		}
+	}
+	e.lock.Unlock()
+
+	if !changed {
+		return
+	}
+	if healthy {
+		klog.V(2).Infof("API server endpoint %s is healthy", e.url.Host)
+		return
+	}
+	klog.V(2).Infof("API server endpoint %s is unhealthy, closing %d watches", e.url.Host, len(watches))
+	for _, w := range watches {
+		w.Close()
+	}
+}
+
+// trackWatch registers the watch response body with the endpoint and makes
+// sure the endpoints are health checked while it is open, even if no other
+// requests are made.
+func (rt *endpointRoundTripper) trackWatch(e *endpoint, body io.ReadCloser) io.ReadCloser {
+	w := &endpointWatchBody{ReadCloser: body}
+	w.onClose = func() {
+		e.lock.Lock()
+		delete(e.watches, w)
+		e.lock.Unlock()
+	}
+	e.lock.Lock()
+	e.watches[w] = struct{}{}
+	e.lock.Unlock()
+
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	if !rt.monitoring {
+		rt.monitoring = true
+		go rt.monitor()
+	}
+	return w
+}
+
+// monitor periodically health checks the endpoints for as long as any
+// watch is open.
+func (rt *endpointRoundTripper) monitor() {
+	ticker := time.NewTicker(rt.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if rt.openWatches() == 0 {
+			rt.lock.Lock()
+			// Re-check under the lock, trackWatch might have registered a
+			// watch in the meantime.
+			if rt.openWatches() == 0 {
+				rt.monitoring = false
+				rt.lock.Unlock()
+				return
+			}
+			rt.lock.Unlock()
+		}
+		rt.checkHealth()
+	}
+}
+
+func (rt *endpointRoundTripper) openWatches() int {
+	n := 0
+	for _, e := range rt.endpoints {
+		e.lock.Lock()
+		n += len(e.watches)
+		e.lock.Unlock()
+	}
+	return n
+}
+
+// endpointWatchBody is the body of a watch response which is closed when
+// the endpoint serving it turns unhealthy.
+type endpointWatchBody struct {
+	io.ReadCloser
+	once    sync.Once
+	onClose func()
+	err     error
+}
+
+func (w *endpointWatchBody) Close() error {
+	w.once.Do(func() {
+		w.onClose()
+		w.err = w.ReadCloser.Close()
+	})
+	return w.err
+}
+
+// rewriteRequest returns a copy of req addressed to target instead of
+// source. If reset is true, the request body is recreated.
+func rewriteRequest(req *http.Request, source *endpoint, target *url.URL, reset bool) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	u := *req.URL
+	u.Scheme = target.Scheme
+	u.Host = target.Host
+	u.Path = target.Path + strings.TrimPrefix(req.URL.Path, source.url.Path)
+	u.RawPath = ""
+	r.URL = &u
+	// The Host header belongs to the original endpoint.
+	r.Host = ""
+	if reset && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return r, nil
+}
+
+// isDialError reports whether the request failed before it could have been
+// sent to the server.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func isWatchRequest(req *http.Request) bool {
+	if strings.Contains(req.URL.Path, "/watch/") {
+		return true
+	}
+	switch req.URL.Query().Get("watch") {
+	case "true", "1":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// endpointTestServer is used instead of httptest.Server, whose Close
+// modifies http.DefaultTransport which other tests in this package inspect.
+type endpointTestServer struct {
+	*http.Server
+	URL      string
+	name     string
+	requests int32
+	ready    atomic.Bool
+}
+
+func newEndpointTestServer(t *testing.T, name string) *endpointTestServer {
+	s := &endpointTestServer{name: name}
+	s.ready.Store(true)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.URL = "http://" + listener.Addr().String()
+	s.Server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/readyz" {
+			if !s.ready.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		atomic.AddInt32(&s.requests, 1)
+		if req.URL.Query().Get("watch") == "true" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-req.Context().Done()
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		w.Write([]byte(s.name + ":" + req.URL.Path + ":" + string(body)))
+	})}
+	go s.Serve(listener)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func doEndpointRequest(t *testing.T, rt http.RoundTripper, method, url, body string) string {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestEndpointRoundTripperFailover(t *testing.T) {
+	a := newEndpointTestServer(t, "a")
+	b := newEndpointTestServer(t, "b")
+	// Keep-alives are disabled so that the mutation below fails to dial
+	// rather than failing on a connection closed by the stopped server.
+	rt, err := NewEndpointRoundTripper(&http.Transport{DisableKeepAlives: true}, []string{a.URL + "/prefix", b.URL}, EndpointSelectionOrdered, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := doEndpointRequest(t, rt, "GET", a.URL+"/prefix/api", ""); got != "a:/prefix/api:" {
+		t.Errorf("unexpected response %q", got)
+	}
+	if got := doEndpointRequest(t, rt, "GET", b.URL+"/api", ""); got != "a:/prefix/api:" {
+		t.Errorf("expected the first endpoint to be preferred, got %q", got)
+	}
+
+	// Connections to the first endpoint are refused, mutations with a
+	// replayable body fail over as well.
+	a.Close()
+	if got := doEndpointRequest(t, rt, "POST", a.URL+"/prefix/api", "body"); got != "b:/api:body" {
+		t.Errorf("unexpected response %q", got)
+	}
+	before := atomic.LoadInt32(&b.requests)
+	if got := doEndpointRequest(t, rt, "GET", a.URL+"/prefix/api", ""); got != "b:/api:" {
+		t.Errorf("unexpected response %q", got)
+	}
+	if atomic.LoadInt32(&b.requests) != before+1 {
+		t.Errorf("expected a single request to the healthy endpoint")
+	}
+}
+
+func TestEndpointRoundTripperPassThrough(t *testing.T) {
+	a := newEndpointTestServer(t, "a")
+	b := newEndpointTestServer(t, "b")
+	other := newEndpointTestServer(t, "other")
+	rt, err := NewEndpointRoundTripper(&http.Transport{}, []string{a.URL, b.URL}, EndpointSelectionOrdered, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doEndpointRequest(t, rt, "GET", other.URL+"/api", ""); got != "other:/api:" {
+		t.Errorf("unexpected response %q", got)
+	}
+}
+
+func TestEndpointRoundTripperRandom(t *testing.T) {
+	a := newEndpointTestServer(t, "a")
+	b := newEndpointTestServer(t, "b")
+	rt, err := NewEndpointRoundTripper(&http.Transport{}, []string{a.URL, b.URL}, EndpointSelectionRandom, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		doEndpointRequest(t, rt, "GET", a.URL+"/api", "")
+	}
+	if atomic.LoadInt32(&a.requests) == 0 || atomic.LoadInt32(&b.requests) == 0 {
+		t.Errorf("expected requests to be spread across endpoints, got %d and %d", a.requests, b.requests)
+	}
+}
+
+func TestEndpointRoundTripperHealthCheck(t *testing.T) {
+	a := newEndpointTestServer(t, "a")
+	b := newEndpointTestServer(t, "b")
+	rt, err := NewEndpointRoundTripper(&http.Transport{}, []string{a.URL, b.URL}, EndpointSelectionOrdered, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", a.URL+"/api/v1/pods?watch=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(io.Discard, resp.Body)
+	}()
+
+	// The watch is closed once its endpoint reports not ready.
+	a.ready.Store(false)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("watch was not closed")
+	}
+	if got := doEndpointRequest(t, rt, "GET", a.URL+"/api", ""); got != "b:/api:" {
+		t.Errorf("unexpected response %q", got)
+	}
+
+	// Requests return to the preferred endpoint once it recovers.
+	a.ready.Store(true)
+	err = wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return doEndpointRequest(t, rt, "GET", a.URL+"/api", "") == "a:/api:", nil
+	})
+	if err != nil {
+		t.Errorf("expected the recovered endpoint to be used: %v", err)
+	}
+}
+
+func TestNewWithEndpoints(t *testing.T) {
+	b := newEndpointTestServer(t, "b")
+	rt, err := New(&Config{
+		Endpoints: []string{"http://127.0.0.1:1", b.URL},
+		Transport: &http.Transport{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doEndpointRequest(t, rt, "GET", "http://127.0.0.1:1/api", ""); got != "b:/api:" {
+		t.Errorf("unexpected response %q", got)
+	}
+
+	if _, err := New(&Config{Endpoints: []string{"http://a", "b:443"}}); err == nil {
+		t.Errorf("expected error for endpoint without scheme")
+	}
+}
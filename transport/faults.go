@@ -0,0 +1,342 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+)
+
+// Fault is the misbehavior injected into a request. Several faults may be
+// combined, the latency is injected first.
+type Fault struct {
+	// Latency delays the request before it is sent.
+	Latency time.Duration
+	// StatusCode, if set, answers the request with a failure status of this
+	// code, such as 429, 500, 503 or 410 Gone, without sending it.
+	StatusCode int
+	// RetryAfter sets the Retry-After header of the failure status, rounded
+	// to seconds.
+	RetryAfter time.Duration
+	// TruncateBody cuts the response body off after TruncateAfter bytes,
+	// reading it fails with io.ErrUnexpectedEOF.
+	TruncateBody  bool
+	TruncateAfter int64
+	// DropWatchAfter, if set, drops watch streams after the given time, as
+	// if the connection to the server was lost.
+	DropWatchAfter time.Duration
+}
+
+// FaultRule injects a fault into matching requests.
+type FaultRule struct {
+	// Verbs, Resources and Namespaces restrict the requests the rule
+	// matches, an empty list matches all requests. Verbs are Kubernetes
+	// verbs such as get, list, watch or create. Resources may be qualified
+	// with their group and a subresource, for example "deployments.apps" or
+	// "pods/log".
+	Verbs      []string
+	Resources  []string
+	Namespaces []string
+
+	// Skip is the number of matching requests the rule ignores before it
+	// fires for the first time.
+	Skip int
+	// Every fires the rule for every n-th matching request after Skip.
+	Every int
+	// Probability fires the rule for matching requests with the given
+	// probability between 0 and 1. The rule fires for every request if
+	// neither Every nor Probability is set.
+	Probability float64
+	// Limit is the maximum number of times the rule fires, zero is
+	// unlimited.
+	Limit int
+
+	Fault Fault
+}
+
+// FaultInjectionOptions configures the faults injected into requests.
+type FaultInjectionOptions struct {
+	// Rules are evaluated in order, the first rule which fires for a
+	// request decides its fault.
+	Rules []FaultRule
+	// Seed seeds the random numbers of probabilistic rules. The same seed
+	// injects the same faults into the same sequence of requests.
+	Seed int64
+	// OnFault, if set, is called for every request with an injected fault,
+	// with the index of the rule that fired.
+	OnFault func(req *http.Request, rule int)
+}
+
+// FaultInjectionWrapper returns a WrapperFunc injecting faults into
+// requests, for testing how clients cope with a misbehaving server.
+func FaultInjectionWrapper(opts FaultInjectionOptions) WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return NewFaultInjectionRoundTripper(rt, opts)
+	}
+}
+
+// NewFaultInjectionRoundTripper returns a round tripper injecting faults
+// into the requests sent to rt according to the rules of opts.
+func NewFaultInjectionRoundTripper(rt http.RoundTripper, opts FaultInjectionOptions) http.RoundTripper {
+	return &faultInjectionRoundTripper{
+		rt:      rt,
+		opts:    opts,
+		rand:    rand.New(rand.NewSource(opts.Seed)),
+		matches: make([]int, len(opts.Rules)),
+		fired:   make([]int, len(opts.Rules)),
+	}
+}
+
+type faultInjectionRoundTripper struct {
+	rt   http.RoundTripper
+	opts FaultInjectionOptions
+
+	lock    sync.Mutex
+	rand    *rand.Rand
+	matches []int
+	fired   []int
+}
+
+var _ utilnet.RoundTripperWrapper = &faultInjectionRoundTripper{}
+
+func (rt *faultInjectionRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	event := &AuditEvent{Method: req.Method}
+	parseAuditRequest(event, req.URL)
+	index, fault := rt.fault(event)
+	if fault == nil {
+		return rt.rt.RoundTrip(req)
+	}
+	if rt.opts.OnFault != nil {
+		rt.opts.OnFault(req, index)
+	}
+
+	if fault.Latency > 0 {
+		t := time.NewTimer(fault.Latency)
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			t.Stop()
+			closeRequestBody(req)
+			return nil, req.Context().Err()
+		}
+	}
+	if fault.StatusCode != 0 {
+		closeRequestBody(req)
+		return faultResponse(req, fault), nil
+	}
+
+	resp, err := rt.rt.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	if fault.TruncateBody {
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: fault.TruncateAfter}
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+	}
+	if fault.DropWatchAfter > 0 && event.Verb == "watch" {
+		resp.Body = newDroppedBody(resp.Body, fault.DropWatchAfter)
+	}
+	return resp, nil
+}
+
+// fault returns the fault of the first rule firing for the request.
+func (rt *faultInjectionRoundTripper) fault(event *AuditEvent) (int, *Fault) {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	for i := range rt.opts.Rules {
+		rule := &rt.opts.Rules[i]
+		if !rule.matches(event) {
+			continue
+		}
+		rt.matches[i]++
+		n := rt.matches[i] - rule.Skip
+		if n <= 0 || (rule.Limit > 0 && rt.fired[i] >= rule.Limit) {
+			continue
+		}
+		if rule.Every > 0 && n%rule.Every != 0 {
+			continue
+		}
+		if rule.Probability > 0 && rt.rand.Float64() >= rule.Probability {
+			continue
+		}
+		rt.fired[i]++
+		return i, &rule.Fault
+	}
+	return -1, nil
+}
+
+func (rt *faultInjectionRoundTripper) CancelRequest(req *http.Request) {
+	tryCancelRequest(rt.WrappedRoundTripper(), req)
+}
+
+func (rt *faultInjectionRoundTripper) WrappedRoundTripper() http.RoundTripper { return rt.rt }
+
+func (r *FaultRule) matches(event *AuditEvent) bool {
+	if len(r.Verbs) > 0 && !containsString(r.Verbs, event.Verb) {
+		return false
+	}
+	if len(r.Namespaces) > 0 && !containsString(r.Namespaces, event.Namespace) {
+		return false
+	}
+	if len(r.Resources) == 0 {
+		return true
+	}
+	resources := []string{event.Resource}
+	if len(event.Group) > 0 {
+		resources = append(resources, event.Resource+"."+event.Group)
+	}
+	if len(event.Subresource) > 0 {
+		for _, resource := range resources {
+			resources = append(resources, resource+"/"+event.Subresource)
+		}
+	}
+	for _, resource := range resources {
+		if containsString(r.Resources, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// faultStatus is the failure status returned by the API server.
+type faultStatus struct {
+	Kind       string            `json:"kind"`
+	APIVersion string            `json:"apiVersion"`
+	Metadata   map[string]string `json:"metadata"`
+	Status     string            `json:"status"`
+	Message    string            `json:"message"`
+	Reason     string            `json:"reason,omitempty"`
+	Code       int               `json:"code"`
+}
+
+var faultReasons = map[int]string{
+	http.StatusGone:                "Expired",
+	http.StatusTooManyRequests:     "TooManyRequests",
+	http.StatusInternalServerError: "InternalError",
+	http.StatusServiceUnavailable:  "ServiceUnavailable",
+	http.StatusGatewayTimeout:      "Timeout",
+}
+
+// closeRequestBody closes the body of a request which is not sent, as
+// RoundTrippers have to.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func faultResponse(req *http.Request, fault *Fault) *http.Response {
+	body, _ := json.Marshal(&faultStatus{
+		Kind:       "Status",
+		APIVersion: "v1",
+		Metadata:   map[string]string{},
+		Status:     "Failure",
+		Message:    fmt.Sprintf("injected fault: %s", http.StatusText(fault.StatusCode)),
+		Reason:     faultReasons[fault.StatusCode],
+		Code:       fault.StatusCode,
+	})
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if fault.RetryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(fault.RetryAfter.Round(time.Second)/time.Second)))
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fault.StatusCode, http.StatusText(fault.StatusCode)),
+		StatusCode:    fault.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// truncatedBody fails with io.ErrUnexpectedEOF once the remaining bytes
+// were read.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// droppedBody closes a watch stream after a timeout. Reads of the dropped
+// stream fail with io.ErrUnexpectedEOF, like reads of a lost connection.
+type droppedBody struct {
+	io.ReadCloser
+	timer *time.Timer
+
+	lock    sync.Mutex
+	dropped bool
+}
+
+func newDroppedBody(body io.ReadCloser, after time.Duration) *droppedBody {
+	b := &droppedBody{ReadCloser: body}
+	b.timer = time.AfterFunc(after, func() {
+		b.lock.Lock()
+		b.dropped = true
+		b.lock.Unlock()
+		b.ReadCloser.Close()
+	})
+	return b
+}
+
+func (b *droppedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.dropped {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *droppedBody) Close() error {
+	b.timer.Stop()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func okResponse(body string) *http.Response {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestFaultInjectionMatching(t *testing.T) {
+	rt := &testRoundTripper{Response: okResponse("ok")}
+	var fired []int
+	injector := NewFaultInjectionRoundTripper(rt, FaultInjectionOptions{
+		Rules: []FaultRule{{
+			Verbs:      []string{"list"},
+			Resources:  []string{"pods"},
+			Namespaces: []string{"ns"},
+			Fault:      Fault{StatusCode: http.StatusServiceUnavailable, RetryAfter: 2 * time.Second},
+		}, {
+			Resources: []string{"deployments.apps/scale"},
+			Fault:     Fault{StatusCode: http.StatusGone},
+		}},
+		OnFault: func(req *http.Request, rule int) { fired = append(fired, rule) },
+	})
+
+	testCases := []struct {
+		method, url string
+		status      int
+	}{
+		{method: "GET", url: "/api/v1/namespaces/ns/pods", status: http.StatusServiceUnavailable},
+		{method: "GET", url: "/api/v1/namespaces/ns/pods/a", status: http.StatusOK},
+		{method: "GET", url: "/api/v1/namespaces/other/pods", status: http.StatusOK},
+		{method: "GET", url: "/api/v1/namespaces/ns/configmaps", status: http.StatusOK},
+		{method: "PUT", url: "/apis/apps/v1/namespaces/ns/deployments/a/scale", status: http.StatusGone},
+		{method: "PUT", url: "/apis/apps/v1/namespaces/ns/deployments/a", status: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		rt.Request = nil
+		resp, err := injector.RoundTrip(httptest.NewRequest(tc.method, tc.url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.url, tc.status, resp.StatusCode)
+		}
+		if injected := tc.status != http.StatusOK; injected != (rt.Request == nil) {
+			t.Errorf("%s %s: expected the request to be sent only without an injected status", tc.method, tc.url)
+		}
+	}
+	if !reflect.DeepEqual(fired, []int{0, 1}) {
+		t.Errorf("unexpected rules fired %v", fired)
+	}
+}
+
+// closeTrackingBody records whether a request body was closed.
+type closeTrackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestFaultInjectionStatus(t *testing.T) {
+	injector := NewFaultInjectionRoundTripper(&testRoundTripper{}, FaultInjectionOptions{
+		Rules: []FaultRule{{Fault: Fault{StatusCode: http.StatusTooManyRequests, RetryAfter: 1500 * time.Millisecond}}},
+	})
+	body := &closeTrackingBody{Reader: strings.NewReader("{}")}
+	resp, err := injector.RoundTrip(httptest.NewRequest("POST", "/api/v1/namespaces/ns/pods", body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !body.closed {
+		t.Errorf("expected the body of the request which was not sent to be closed")
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "2" {
+		t.Errorf("expected Retry-After 2, got %q", retryAfter)
+	}
+	var status faultStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Kind != "Status" || status.Reason != "TooManyRequests" || status.Code != http.StatusTooManyRequests {
+		t.Errorf("unexpected status %#v", status)
+	}
+}
+
+func TestFaultInjectionSchedule(t *testing.T) {
+	var fired []int
+	injector := NewFaultInjectionRoundTripper(&testRoundTripper{Response: okResponse("")}, FaultInjectionOptions{
+		Rules: []FaultRule{{Skip: 1, Every: 2, Limit: 2, Fault: Fault{StatusCode: http.StatusInternalServerError}}},
+	})
+	for i := 1; i <= 8; i++ {
+		resp, err := injector.RoundTrip(httptest.NewRequest("GET", "/api/v1/pods", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode == http.StatusInternalServerError {
+			fired = append(fired, i)
+		}
+	}
+	if !reflect.DeepEqual(fired, []int{3, 5}) {
+		t.Errorf("expected requests 3 and 5 to fail, got %v", fired)
+	}
+}
+
+func TestFaultInjectionSeed(t *testing.T) {
+	run := func(seed int64) []bool {
+		injector := NewFaultInjectionRoundTripper(&testRoundTripper{Response: okResponse("")}, FaultInjectionOptions{
+			Rules: []FaultRule{{Probability: 0.5, Fault: Fault{StatusCode: http.StatusInternalServerError}}},
+			Seed:  seed,
+		})
+		var failed []bool
+		for i := 0; i < 50; i++ {
+			resp, err := injector.RoundTrip(httptest.NewRequest("GET", "/api/v1/pods", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			failed = append(failed, resp.StatusCode != http.StatusOK)
+		}
+		return failed
+	}
+	first := run(42)
+	if !reflect.DeepEqual(first, run(42)) {
+		t.Errorf("expected the same faults for the same seed")
+	}
+	count := 0
+	for _, failed := range first {
+		if failed {
+			count++
+		}
+	}
+	if count == 0 || count == len(first) {
+		t.Errorf("expected some requests to fail, %d of %d failed", count, len(first))
+	}
+}
+
+func TestFaultInjectionTruncateBody(t *testing.T) {
+	injector := NewFaultInjectionRoundTripper(&testRoundTripper{Response: okResponse("hello world")}, FaultInjectionOptions{
+		Rules: []FaultRule{{Fault: Fault{TruncateBody: true, TruncateAfter: 5}}},
+	})
+	resp, err := injector.RoundTrip(httptest.NewRequest("GET", "/api/v1/pods", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if string(data) != "hello" || err != io.ErrUnexpectedEOF {
+		t.Errorf("expected a truncated body, got %q %v", data, err)
+	}
+}
+
+func TestFaultInjectionDropWatch(t *testing.T) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: reader}
+	injector := NewFaultInjectionRoundTripper(&testRoundTripper{Response: resp}, FaultInjectionOptions{
+		Rules: []FaultRule{{Fault: Fault{DropWatchAfter: 10 * time.Millisecond}}},
+	})
+	resp, err := injector.RoundTrip(httptest.NewRequest("GET", "/api/v1/pods?watch=true", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go writer.Write([]byte("event"))
+	buf := make([]byte, 5)
+	if n, err := resp.Body.Read(buf); err != nil || string(buf[:n]) != "event" {
+		t.Fatalf("expected the stream to work before it is dropped, got %q %v", buf[:n], err)
+	}
+	if _, err := resp.Body.Read(buf); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected the stream to be dropped, got %v", err)
+	}
+}
+
+func TestFaultInjectionLatency(t *testing.T) {
+	injector := NewFaultInjectionRoundTripper(&testRoundTripper{Response: okResponse("")}, FaultInjectionOptions{
+		Rules: []FaultRule{{Fault: Fault{Latency: 20 * time.Millisecond}}},
+	})
+	start := time.Now()
+	if _, err := injector.RoundTrip(httptest.NewRequest("GET", "/api/v1/pods", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("expected the request to be delayed, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	body := &closeTrackingBody{Reader: strings.NewReader("{}")}
+	req := httptest.NewRequest("POST", "/api/v1/namespaces/ns/pods", body).WithContext(ctx)
+	if _, err := injector.RoundTrip(req); err != context.Canceled {
+		t.Errorf("expected the delay to end with the request context, got %v", err)
+	}
+	if !body.closed {
+		t.Errorf("expected the body of the canceled request to be closed")
+	}
+}
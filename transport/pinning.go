@@ -0,0 +1,118 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	// PublicKeyPinPrefix prefixes pins of the public key of a certificate,
+	// the base64 encoded SHA-256 hash of its DER encoded SubjectPublicKeyInfo.
+	// This is the format of HTTP public key pinning and curl's --pinnedpubkey.
+	PublicKeyPinPrefix = "sha256/"
+	// CertificatePinPrefix prefixes pins of a certificate, the base64 encoded
+	// SHA-256 hash of the DER encoded certificate.
+	CertificatePinPrefix = "cert-sha256/"
+)
+
+// PublicKeyPin returns the pin of the public key of cert.
+func PublicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return PublicKeyPinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// CertificatePin returns the pin of cert.
+func CertificatePin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return CertificatePinPrefix + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ValidatePins returns an error if one of pins is malformed.
+func ValidatePins(pins []string) error {
+	for _, pin := range pins {
+		var hash string
+		switch {
+		case strings.HasPrefix(pin, PublicKeyPinPrefix):
+			hash = strings.TrimPrefix(pin, PublicKeyPinPrefix)
+		case strings.HasPrefix(pin, CertificatePinPrefix):
+			hash = strings.TrimPrefix(pin, CertificatePinPrefix)
+		default:
+			return fmt.Errorf("invalid pin %q: expected a %q or %q prefix", pin, PublicKeyPinPrefix, CertificatePinPrefix)
+		}
+		sum, err := base64.StdEncoding.DecodeString(hash)
+		if err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("invalid pin %q: expected a base64 encoded SHA-256 hash", pin)
+		}
+	}
+	return nil
+}
+
+// PinMismatchError is returned when the certificates of a server match none
+// of the pins of the config.
+type PinMismatchError struct {
+	// ServerName is the name the server was verified for.
+	ServerName string
+	// PublicKeyPin and CertificatePin are the pins of the certificate of
+	// the server.
+	PublicKeyPin   string
+	CertificatePin string
+}
+
+func (e *PinMismatchError) Error() string {
+	return fmt.Sprintf("the certificate of %s matches none of the pinned certificates and public keys: its public key pin is %s and its certificate pin is %s", e.ServerName, e.PublicKeyPin, e.CertificatePin)
+}
+
+// verifyPins returns a function for tls.Config.VerifyConnection accepting
+// connections whose certificates match at least one of pins, so that backup
+// pins can be configured ahead of a rotation. Certificate pins match the
+// certificate of the server. Public key pins match any certificate of a
+// verified chain, which allows pinning the key of a CA. When verification
+// is skipped, the chain presented by the server proves nothing, and public
+// key pins only match the certificate of the server.
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	pinned := make(map[string]bool, len(pins))
+	for _, pin := range pins {
+		pinned[pin] = true
+	}
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return fmt.Errorf("the server %s presented no certificate to match the pins against", state.ServerName)
+		}
+		leaf := state.PeerCertificates[0]
+		if pinned[CertificatePin(leaf)] || pinned[PublicKeyPin(leaf)] {
+			return nil
+		}
+		for _, chain := range state.VerifiedChains {
+			for _, cert := range chain {
+				if pinned[PublicKeyPin(cert)] {
+					return nil
+				}
+			}
+		}
+		return &PinMismatchError{
+			ServerName:     state.ServerName,
+			PublicKeyPin:   PublicKeyPin(leaf),
+			CertificatePin: CertificatePin(leaf),
+		}
+	}
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPinningTestServer starts a TLS listener completing handshakes with a
+// self-signed certificate for 127.0.0.1 and returns its address and
+// certificate.
+func newPinningTestServer(t *testing.T) (string, *x509.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "pinning-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	return listener.Addr().String(), cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestPinning(t *testing.T) {
+	addr, cert, caData := newPinningTestServer(t)
+	otherPin := PublicKeyPinPrefix + "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	testCases := map[string]struct {
+		tls      TLSConfig
+		mismatch bool
+	}{
+		"public key pin": {
+			tls: TLSConfig{CAData: caData, Pins: []string{PublicKeyPin(cert)}},
+		},
+		"certificate pin": {
+			tls: TLSConfig{CAData: caData, Pins: []string{CertificatePin(cert)}},
+		},
+		"backup pin": {
+			tls: TLSConfig{CAData: caData, Pins: []string{otherPin, PublicKeyPin(cert)}},
+		},
+		"insecure": {
+			tls: TLSConfig{Insecure: true, Pins: []string{CertificatePin(cert)}},
+		},
+		"mismatch": {
+			tls:      TLSConfig{CAData: caData, Pins: []string{otherPin}},
+			mismatch: true,
+		},
+		"insecure mismatch": {
+			tls:      TLSConfig{Insecure: true, Pins: []string{otherPin}},
+			mismatch: true,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tlsConfig, err := TLSConfigFor(&Config{TLS: tc.tls})
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn, err := tls.Dial("tcp", addr, tlsConfig)
+			if err == nil {
+				conn.Close()
+			}
+			var mismatch *PinMismatchError
+			switch {
+			case tc.mismatch && !errors.As(err, &mismatch):
+				t.Fatalf("expected a pin mismatch, got %v", err)
+			case tc.mismatch:
+				if mismatch.PublicKeyPin != PublicKeyPin(cert) || mismatch.CertificatePin != CertificatePin(cert) {
+					t.Errorf("expected the error to report the pins of the server, got %v", mismatch)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestValidatePins(t *testing.T) {
+	valid := []string{
+		PublicKeyPinPrefix + "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		CertificatePinPrefix + "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+	}
+	if err := ValidatePins(valid); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, pin := range []string{
+		"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		"sha1/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		PublicKeyPinPrefix + "not base64",
+		PublicKeyPinPrefix + "YWJj",
+	} {
+		if err := ValidatePins([]string{pin}); err == nil || !strings.Contains(err.Error(), "invalid pin") {
+			t.Errorf("expected %q to be rejected, got %v", pin, err)
+		}
+	}
+	if _, err := TLSConfigFor(&Config{TLS: TLSConfig{Pins: []string{"sha256/abc"}}}); err == nil {
+		t.Errorf("expected TLSConfigFor to reject invalid pins")
+	}
+}
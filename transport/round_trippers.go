@@ -244,20 +244,26 @@ func (rt *impersonatingRoundTripper) RoundTrip(req *http.Request) (*http.Respons
 		return rt.delegate.RoundTrip(req)
 	}
 	req = utilnet.CloneRequest(req)
-	req.Header.Set(ImpersonateUserHeader, rt.impersonate.UserName)
-	if rt.impersonate.UID != "" {
-		req.Header.Set(ImpersonateUIDHeader, rt.impersonate.UID)
+	SetImpersonationHeaders(req.Header, rt.impersonate)
+
+	return rt.delegate.RoundTrip(req)
+}
+
+// SetImpersonationHeaders sets the headers impersonating the user described
+// by impersonate on header.
+func SetImpersonationHeaders(header http.Header, impersonate ImpersonationConfig) {
+	header.Set(ImpersonateUserHeader, impersonate.UserName)
+	if impersonate.UID != "" {
+		header.Set(ImpersonateUIDHeader, impersonate.UID)
 	}
-	for _, group := range rt.impersonate.Groups {
-		req.Header.Add(ImpersonateGroupHeader, group)
+	for _, group := range impersonate.Groups {
+		header.Add(ImpersonateGroupHeader, group)
 	}
-	for k, vv := range rt.impersonate.Extra {
+	for k, vv := range impersonate.Extra {
 		for _, v := range vv {
-			req.Header.Add(ImpersonateUserExtraHeaderPrefix+headerKeyEscape(k), v)
+			header.Add(ImpersonateUserExtraHeaderPrefix+headerKeyEscape(k), v)
 		}
 	}
-
-	return rt.delegate.RoundTrip(req)
 }
 
 func (rt *impersonatingRoundTripper) CancelRequest(req *http.Request) {
@@ -17,7 +17,11 @@ limitations under the License.
 package transport
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
 	"os"
 	"strings"
@@ -27,9 +31,15 @@ import (
 	"golang.org/x/oauth2"
 
 	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/tools/metrics"
 	"k8s.io/klog/v2"
 )
 
+// refreshJitter is the maximum fraction of the lifetime of a token by which
+// its refresh is moved ahead, so that clients started together do not
+// refresh their tokens at the same time.
+const refreshJitter = 0.1
+
 // TokenSourceWrapTransport returns a WrapTransport that injects bearer tokens
 // authentication from an oauth2.TokenSource.
 func TokenSourceWrapTransport(ts oauth2.TokenSource) func(http.RoundTripper) http.RoundTripper {
@@ -70,6 +80,10 @@ func NewCachedFileTokenSource(path string) *cachingTokenSource {
 	return &cachingTokenSource{
 		now:    time.Now,
 		leeway: 10 * time.Second,
+		jitter: refreshJitter,
+		// Tokens which expire within the leeway are re-read as often as
+		// tokens without an expiry.
+		minRefresh: time.Minute,
 		base: &fileTokenSource{
 			path: path,
 			// This period was picked because it is half of the duration between when the kubelet
@@ -85,8 +99,10 @@ func NewCachedFileTokenSource(path string) *cachingTokenSource {
 // a token from a designed TokenSource if not in cache or expired.
 func NewCachedTokenSource(ts oauth2.TokenSource) *cachingTokenSource {
 	return &cachingTokenSource{
-		now:  time.Now,
-		base: ts,
+		now:        time.Now,
+		jitter:     refreshJitter,
+		minRefresh: minTokenRefreshInterval,
+		base:       ts,
 	}
 }
 
@@ -110,10 +126,42 @@ func (tst *tokenSourceTransport) RoundTrip(req *http.Request) (*http.Response, e
 	resp, err := tst.ort.RoundTrip(req)
 	if err == nil && resp != nil && resp.StatusCode == 401 && tst.src != nil {
 		tst.src.ResetTokenOlderThan(start)
+		if retry := tst.retryRequest(req, resp); retry != nil {
+			// The response is discarded in favor of the response to the
+			// request with the refreshed token.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return tst.ort.RoundTrip(retry)
+		}
 	}
 	return resp, err
 }
 
+// retryRequest returns a copy of req to retry an unauthorized request with,
+// or nil if the token did not change since the request was sent or the body
+// of the request cannot be sent again.
+func (tst *tokenSourceTransport) retryRequest(req *http.Request, resp *http.Response) *http.Request {
+	if resp.Request == nil || resp.Body == nil {
+		return nil
+	}
+	tok, err := tst.src.Token()
+	if err != nil || resp.Request.Header.Get("Authorization") == tok.Type()+" "+tok.AccessToken {
+		return nil
+	}
+	retry := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil
+		}
+		retry.Body = body
+	}
+	return retry
+}
+
 func (tst *tokenSourceTransport) CancelRequest(req *http.Request) {
 	if req.Header.Get("Authorization") != "" {
 		tryCancelRequest(tst.base, req)
@@ -147,13 +195,27 @@ func (ts *fileTokenSource) Token() (*oauth2.Token, error) {
 	}, nil
 }
 
+// minTokenRefreshInterval is the minimum time between refreshes of tokens
+// which are expired, or about to expire, when they are obtained.
+const minTokenRefreshInterval = 10 * time.Second
+
 type cachingTokenSource struct {
 	base   oauth2.TokenSource
 	leeway time.Duration
+	// jitter is the maximum fraction of the lifetime of a token by which
+	// its refresh is moved ahead.
+	jitter float64
+	// minRefresh is the minimum time until a token is refreshed, so that a
+	// base token source returning tokens which already expired, e.g.
+	// according to their exp claim, is not called for every request.
+	minRefresh time.Duration
 
 	sync.RWMutex
 	tok *oauth2.Token
 	t   time.Time
+	// refreshAt is the time at which tok is refreshed, zero to refresh it
+	// leeway before its expiry.
+	refreshAt time.Time
 
 	// for testing
 	now func() time.Time
@@ -164,17 +226,18 @@ func (ts *cachingTokenSource) Token() (*oauth2.Token, error) {
 	// fast path
 	ts.RLock()
 	tok := ts.tok
+	fresh := ts.freshLocked(now)
 	ts.RUnlock()
 
-	if tok != nil && tok.Expiry.Add(-1*ts.leeway).After(now) {
+	if fresh {
 		return tok, nil
 	}
 
 	// slow path
 	ts.Lock()
 	defer ts.Unlock()
-	if tok := ts.tok; tok != nil && tok.Expiry.Add(-1*ts.leeway).After(now) {
-		return tok, nil
+	if ts.freshLocked(now) {
+		return ts.tok, nil
 	}
 
 	tok, err := ts.base.Token()
@@ -186,16 +249,118 @@ func (ts *cachingTokenSource) Token() (*oauth2.Token, error) {
 		return ts.tok, nil
 	}
 
-	ts.t = ts.now()
+	now = ts.now()
+	tok, issued := withJWTValidity(tok, now)
+	if ts.tok != nil && ts.tok.AccessToken != tok.AccessToken && !ts.t.IsZero() {
+		metrics.TokenRotationAge.Observe(now.Sub(ts.t))
+	}
+	if tok.Expiry.IsZero() {
+		metrics.TokenExpiry.Set(nil)
+	} else {
+		expiry := tok.Expiry
+		metrics.TokenExpiry.Set(&expiry)
+	}
+
+	ts.t = now
 	ts.tok = tok
+	ts.refreshAt = ts.refreshTime(tok, issued, now)
 	return tok, nil
 }
 
+// freshLocked returns whether the cached token does not need to be
+// refreshed yet.
+func (ts *cachingTokenSource) freshLocked(now time.Time) bool {
+	if ts.tok == nil {
+		return false
+	}
+	if !ts.refreshAt.IsZero() {
+		return ts.refreshAt.After(now)
+	}
+	return ts.tok.Expiry.Add(-1 * ts.leeway).After(now)
+}
+
+// refreshTime returns the time at which tok, issued at the given time, is
+// refreshed: leeway before its expiry, moved ahead by a random fraction of
+// its lifetime bounded by jitter, but no earlier than minRefresh from now.
+func (ts *cachingTokenSource) refreshTime(tok *oauth2.Token, issued, now time.Time) time.Time {
+	if tok.Expiry.IsZero() {
+		return time.Time{}
+	}
+	refreshAt := tok.Expiry.Add(-1 * ts.leeway)
+	earliest := now.Add(ts.minRefresh)
+	if !refreshAt.After(earliest) {
+		return earliest
+	}
+	if ts.jitter <= 0 {
+		return refreshAt
+	}
+	jitter := time.Duration(rand.Float64() * ts.jitter * float64(tok.Expiry.Sub(issued)))
+	if remaining := refreshAt.Sub(earliest); jitter > remaining {
+		jitter = remaining
+	}
+	return refreshAt.Add(-jitter)
+}
+
+// withJWTValidity returns tok with its expiry bounded by the exp claim of
+// the access token if it is a JWT, and the time the token was issued at,
+// its nbf or iat claim if present, else now. tok is not modified.
+func withJWTValidity(tok *oauth2.Token, now time.Time) (*oauth2.Token, time.Time) {
+	claims, ok := parseJWTClaims(tok.AccessToken)
+	if !ok {
+		return tok, now
+	}
+	issued := now
+	switch {
+	case claims.NotBefore != nil:
+		issued = time.Unix(int64(*claims.NotBefore), 0)
+	case claims.IssuedAt != nil:
+		issued = time.Unix(int64(*claims.IssuedAt), 0)
+	}
+	if issued.After(now) {
+		klog.V(2).Infof("Token is not valid before %v, the clock may be skewed", issued)
+		issued = now
+	}
+	if claims.Expiry != nil {
+		expiry := time.Unix(int64(*claims.Expiry), 0)
+		if tok.Expiry.IsZero() || expiry.Before(tok.Expiry) {
+			copied := *tok
+			copied.Expiry = expiry
+			tok = &copied
+		}
+	}
+	return tok, issued
+}
+
+type jwtClaims struct {
+	Expiry    *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	IssuedAt  *float64 `json:"iat"`
+}
+
+// parseJWTClaims returns the time claims of token if it is a JWT. The
+// signature is not verified, the claims are only used to schedule refreshes.
+func parseJWTClaims(token string) (jwtClaims, bool) {
+	var claims jwtClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return claims, false
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, false
+	}
+	return claims, true
+}
+
 func (ts *cachingTokenSource) ResetTokenOlderThan(t time.Time) {
 	ts.Lock()
 	defer ts.Unlock()
 	if ts.t.Before(t) {
 		ts.tok = nil
 		ts.t = time.Time{}
+		ts.refreshAt = time.Time{}
 	}
 }
@@ -17,14 +17,20 @@ limitations under the License.
 package transport
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"golang.org/x/oauth2"
+
+	"k8s.io/client-go/tools/metrics"
 )
 
 type testTokenSource struct {
@@ -306,3 +312,187 @@ func (rt *testTransport) CancelRequest(req *http.Request) {
 		tryCancelRequest(rt.base, req)
 	}
 }
+
+func testJWT(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256"}`)) + "." + encode([]byte(claims)) + ".signature"
+}
+
+type fakeExpiryMetric struct{ expiry *time.Time }
+
+func (m *fakeExpiryMetric) Set(expiry *time.Time) { m.expiry = expiry }
+
+type fakeDurationMetric struct{ observed []time.Duration }
+
+func (m *fakeDurationMetric) Observe(d time.Duration) { m.observed = append(m.observed, d) }
+
+func TestCachingTokenSourceJWTExpiry(t *testing.T) {
+	defer func(expiry metrics.ExpiryMetric, age metrics.DurationMetric) {
+		metrics.TokenExpiry = expiry
+		metrics.TokenRotationAge = age
+	}(metrics.TokenExpiry, metrics.TokenRotationAge)
+	expiryMetric, ageMetric := &fakeExpiryMetric{}, &fakeDurationMetric{}
+	metrics.TokenExpiry = expiryMetric
+	metrics.TokenRotationAge = ageMetric
+
+	now := time.Unix(1000000, 0)
+	tokA := &oauth2.Token{
+		AccessToken: testJWT(fmt.Sprintf(`{"nbf":%d,"exp":%d}`, now.Unix(), now.Add(100*time.Second).Unix())),
+		// The file token source reloads tokens every minute, the token
+		// expires first.
+		Expiry: now.Add(time.Hour),
+	}
+	tts := &testTokenSource{tok: tokA}
+	ts := &cachingTokenSource{
+		base:   tts,
+		leeway: 10 * time.Second,
+		jitter: refreshJitter,
+		now:    func() time.Time { return now },
+	}
+
+	tok, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiry := now.Add(100 * time.Second)
+	if !tok.Expiry.Equal(expiry) {
+		t.Errorf("expected the expiry of the JWT, got %v", tok.Expiry)
+	}
+	if !tokA.Expiry.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected the token of the base token source not to be modified")
+	}
+	// Refreshed 10s leeway and up to 10% of the lifetime of 100s before the expiry.
+	if ts.refreshAt.Before(now.Add(80*time.Second)) || ts.refreshAt.After(now.Add(90*time.Second)) {
+		t.Errorf("unexpected refresh time %v", ts.refreshAt.Sub(now))
+	}
+	if expiryMetric.expiry == nil || !expiryMetric.expiry.Equal(expiry) {
+		t.Errorf("expected the expiry to be reported, got %v", expiryMetric.expiry)
+	}
+
+	now = now.Add(79 * time.Second)
+	if _, err := ts.Token(); err != nil || tts.calls != 1 {
+		t.Errorf("expected the token to be cached, got %d calls and %v", tts.calls, err)
+	}
+	now = now.Add(11 * time.Second)
+	tts.tok = &oauth2.Token{AccessToken: "b", Expiry: now.Add(time.Minute)}
+	if tok, err := ts.Token(); err != nil || tok.AccessToken != "b" {
+		t.Errorf("expected the token to be refreshed before its expiry, got %v %v", tok, err)
+	}
+	if !reflect.DeepEqual(ageMetric.observed, []time.Duration{90 * time.Second}) {
+		t.Errorf("expected the age of the rotated token to be reported, got %v", ageMetric.observed)
+	}
+}
+
+func TestCachingTokenSourceExpiredJWT(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	tts := &testTokenSource{tok: &oauth2.Token{
+		AccessToken: testJWT(fmt.Sprintf(`{"exp":%d}`, now.Add(-time.Second).Unix())),
+		Expiry:      now.Add(time.Hour),
+	}}
+	ts := &cachingTokenSource{
+		base:       tts,
+		leeway:     10 * time.Second,
+		jitter:     refreshJitter,
+		minRefresh: time.Minute,
+		now:        func() time.Time { return now },
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := ts.Token(); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(10 * time.Second)
+	}
+	if tts.calls != 1 {
+		t.Errorf("expected the expired token to be cached for the minimum refresh interval, got %d calls", tts.calls)
+	}
+	now = now.Add(30 * time.Second)
+	if _, err := ts.Token(); err != nil || tts.calls != 2 {
+		t.Errorf("expected the expired token to be refreshed after the minimum refresh interval, got %d calls and %v", tts.calls, err)
+	}
+}
+
+func TestParseJWTClaims(t *testing.T) {
+	claims, ok := parseJWTClaims(testJWT(`{"exp":1.5e9,"iat":1400000000}`))
+	if !ok || *claims.Expiry != 1.5e9 || *claims.IssuedAt != 1.4e9 || claims.NotBefore != nil {
+		t.Errorf("unexpected claims %#v %v", claims, ok)
+	}
+	for _, token := range []string{"opaque", "a.b", "a.!.c", testJWT("[]")} {
+		if _, ok := parseJWTClaims(token); ok {
+			t.Errorf("expected %q not to be parsed", token)
+		}
+	}
+}
+
+type sequenceTokenSource struct {
+	tokens []*oauth2.Token
+}
+
+func (ts *sequenceTokenSource) Token() (*oauth2.Token, error) {
+	tok := ts.tokens[0]
+	if len(ts.tokens) > 1 {
+		ts.tokens = ts.tokens[1:]
+	}
+	return tok, nil
+}
+
+// authorizingTransport accepts requests with the "new" token and records
+// the bodies of all requests.
+type authorizingTransport struct {
+	bodies []string
+}
+
+func (rt *authorizingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		data, _ := io.ReadAll(req.Body)
+		body = string(data)
+	}
+	rt.bodies = append(rt.bodies, body)
+	status := http.StatusUnauthorized
+	if req.Header.Get("Authorization") == "Bearer new" {
+		status = http.StatusOK
+	}
+	return &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+func TestTokenSourceTransportRetryUnauthorized(t *testing.T) {
+	expiry := time.Now().Add(time.Hour)
+	newTransport := func(tokens ...string) (*authorizingTransport, http.RoundTripper) {
+		ts := &sequenceTokenSource{}
+		for _, token := range tokens {
+			ts.tokens = append(ts.tokens, &oauth2.Token{AccessToken: token, Expiry: expiry})
+		}
+		cached := NewCachedTokenSource(ts)
+		// The cached token was acquired before the request.
+		cached.Token()
+		cached.t = cached.t.Add(-time.Second)
+		base := &authorizingTransport{}
+		return base, ResettableTokenSourceWrapTransport(cached)(base)
+	}
+
+	base, rt := newTransport("old", "new")
+	req, _ := http.NewRequest("POST", "https://example.com", bytes.NewReader([]byte("body")))
+	resp, err := rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the request to be retried with the refreshed token, got %v %v", resp, err)
+	}
+	if !reflect.DeepEqual(base.bodies, []string{"body", "body"}) {
+		t.Errorf("expected the body to be sent again, got %q", base.bodies)
+	}
+
+	// Requests are not retried with the same token.
+	base, rt = newTransport("old", "old")
+	resp, err = rt.RoundTrip(req.Clone(req.Context()))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || len(base.bodies) != 1 {
+		t.Errorf("expected the request not to be retried, got %v %v after %d requests", resp, err, len(base.bodies))
+	}
+
+	// Requests whose body cannot be sent again are not retried.
+	base, rt = newTransport("old", "new")
+	req, _ = http.NewRequest("POST", "https://example.com", io.NopCloser(strings.NewReader("body")))
+	resp, err = rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || len(base.bodies) != 1 {
+		t.Errorf("expected the request not to be retried, got %v %v after %d requests", resp, err, len(base.bodies))
+	}
+}
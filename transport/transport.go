@@ -57,6 +57,13 @@ func New(config *Config) (http.RoundTripper, error) {
 		}
 	}
 
+	if len(config.Endpoints) > 1 {
+		rt, err = NewEndpointRoundTripper(rt, config.Endpoints, config.EndpointSelection, config.EndpointHealthCheckInterval)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return HTTPWrappersForConfig(config, rt)
 }
 
@@ -75,12 +82,15 @@ func isValidHolders(config *Config) bool {
 // TLSConfigFor returns a tls.Config that will provide the transport level security defined
 // by the provided Config. Will return nil if no transport level security is requested.
 func TLSConfigFor(c *Config) (*tls.Config, error) {
-	if !(c.HasCA() || c.HasCertAuth() || c.HasCertCallback() || c.TLS.Insecure || len(c.TLS.ServerName) > 0 || len(c.TLS.NextProtos) > 0) {
+	if !(c.HasCA() || c.HasCertAuth() || c.HasCertCallback() || c.TLS.Insecure || len(c.TLS.ServerName) > 0 || len(c.TLS.NextProtos) > 0 || len(c.TLS.Pins) > 0) {
 		return nil, nil
 	}
 	if c.HasCA() && c.TLS.Insecure {
 		return nil, fmt.Errorf("specifying a root certificates file with the insecure flag is not allowed")
 	}
+	if err := ValidatePins(c.TLS.Pins); err != nil {
+		return nil, err
+	}
 	if err := loadTLSFiles(c); err != nil {
 		return nil, err
 	}
@@ -95,6 +105,10 @@ func TLSConfigFor(c *Config) (*tls.Config, error) {
 		NextProtos:         c.TLS.NextProtos,
 	}
 
+	if len(c.TLS.Pins) > 0 {
+		tlsConfig.VerifyConnection = verifyPins(c.TLS.Pins)
+	}
+
 	if c.HasCA() {
 		rootCAs, err := rootCertPool(c.TLS.CAData)
 		if err != nil {
@@ -156,6 +170,11 @@ func TLSConfigFor(c *Config) (*tls.Config, error) {
 // KeyData, and CAFile fields, or returns an error. If no error is returned, all three fields are
 // either populated or were empty to start.
 func loadTLSFiles(c *Config) error {
+	// Check that we are purely loading the CA from a file
+	if len(c.TLS.CAFile) > 0 && len(c.TLS.CAData) == 0 {
+		c.TLS.ReloadCAFile = true
+	}
+
 	var err error
 	c.TLS.CAData, err = dataFromSliceOrFile(c.TLS.CAData, c.TLS.CAFile)
 	if err != nil {
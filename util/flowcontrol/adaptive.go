@@ -0,0 +1,249 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flowcontrol
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/utils/clock"
+)
+
+// FlowSchemaUIDHeader is the response header in which API Priority and
+// Fairness reports the UID of the FlowSchema a request was classified into.
+const FlowSchemaUIDHeader = "X-Kubernetes-PF-FlowSchema-UID"
+
+// Feedback is the outcome of a request, reported to a FeedbackRateLimiter.
+type Feedback struct {
+	// StatusCode is the status code of the response, zero if no response
+	// was received.
+	StatusCode int
+	// Header is the header of the response, if any.
+	Header http.Header
+	// Latency is the time until the response was received.
+	Latency time.Duration
+	// Err is the error which prevented a response from being received.
+	Err error
+}
+
+// FeedbackRateLimiter is a RateLimiter which adapts to the responses of
+// the server. rest.Request reports the outcome of every request to the rate
+// limiter of its client if it implements this interface, with the context
+// of the request as passed to Wait.
+type FeedbackRateLimiter interface {
+	RateLimiter
+	// Observe reports the outcome of a request.
+	Observe(ctx context.Context, feedback Feedback)
+}
+
+// AdaptiveOptions configures a rate limiter created by
+// NewAdaptiveRateLimiter. Zero values select the defaults.
+type AdaptiveOptions struct {
+	// MinQPS and MaxQPS bound the rate. They default to 1 and 50 times the
+	// initial rate.
+	MinQPS float32
+	MaxQPS float32
+	// Burst is the burst of the rate limiter, it defaults to 10.
+	Burst int
+	// AdditiveIncrease is added to the rate after IncreaseInterval without
+	// overload. It defaults to 1.
+	AdditiveIncrease float32
+	// IncreaseInterval defaults to one second.
+	IncreaseInterval time.Duration
+	// DecreaseFactor multiplies the rate when the server is overloaded. It
+	// defaults to 0.5.
+	DecreaseFactor float32
+	// DecreaseInterval is the minimum time between two decreases, so that
+	// a burst of rejected requests only decreases the rate once. It
+	// defaults to one second.
+	DecreaseInterval time.Duration
+	// LatencyThreshold is the latency above which the server is considered
+	// overloaded. Zero only treats 429 responses as overload.
+	LatencyThreshold time.Duration
+	// Classifier is used to remember the FlowSchema of requests. If nil,
+	// ClassifyByVerbAndResource is used.
+	Classifier FlowClassifier
+	// Clock defaults to the real clock.
+	Clock clock.PassiveClock
+}
+
+// NewAdaptiveRateLimiter returns a rate limiter following the additive
+// increase, multiplicative decrease scheme: starting at initialQPS, the
+// rate grows while requests succeed and shrinks when the server responds
+// with 429 Too Many Requests or its latency exceeds the threshold.
+//
+// Servers with API Priority and Fairness report the FlowSchema of every
+// request. The rate limiter keeps separate rates per FlowSchema, so
+// overload of one FlowSchema does not slow down requests of another. The
+// FlowSchema of a request is predicted from previous responses for
+// requests of the same flow, see WithRequestAttributes. Requests of
+// unknown flows share the rate of responses without FlowSchema.
+//
+// The returned rate limiter can be used as rest.Config.RateLimiter.
+func NewAdaptiveRateLimiter(initialQPS float32, opts AdaptiveOptions) FeedbackRateLimiter {
+	if opts.MinQPS <= 0 {
+		opts.MinQPS = 1
+	}
+	if opts.MaxQPS <= 0 {
+		opts.MaxQPS = 50 * initialQPS
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = 10
+	}
+	if opts.AdditiveIncrease <= 0 {
+		opts.AdditiveIncrease = 1
+	}
+	if opts.IncreaseInterval <= 0 {
+		opts.IncreaseInterval = time.Second
+	}
+	if opts.DecreaseFactor <= 0 || opts.DecreaseFactor >= 1 {
+		opts.DecreaseFactor = 0.5
+	}
+	if opts.DecreaseInterval <= 0 {
+		opts.DecreaseInterval = time.Second
+	}
+	if opts.Classifier == nil {
+		opts.Classifier = ClassifyByVerbAndResource
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.RealClock{}
+	}
+	l := &adaptiveRateLimiter{
+		opts:       opts,
+		initialQPS: initialQPS,
+		flows:      map[string]string{},
+		states:     map[string]*adaptiveState{},
+	}
+	l.stateLocked("")
+	return l
+}
+
+type adaptiveRateLimiter struct {
+	opts       AdaptiveOptions
+	initialQPS float32
+
+	lock sync.Mutex
+	// flows maps flows of requests to the FlowSchema of their last response.
+	flows map[string]string
+	// states holds the rate per FlowSchema UID. The empty UID is used for
+	// unknown FlowSchemas.
+	states map[string]*adaptiveState
+}
+
+type adaptiveState struct {
+	limiter      *rate.Limiter
+	qps          float32
+	lastIncrease time.Time
+	lastDecrease time.Time
+}
+
+var _ FeedbackRateLimiter = &adaptiveRateLimiter{}
+
+// stateLocked returns the state of the given FlowSchema, creating it with
+// the rate of unknown FlowSchemas if it does not exist yet.
+func (l *adaptiveRateLimiter) stateLocked(flowSchemaUID string) *adaptiveState {
+	if state, ok := l.states[flowSchemaUID]; ok {
+		return state
+	}
+	qps := l.initialQPS
+	if fallback, ok := l.states[""]; ok {
+		qps = fallback.qps
+	}
+	now := l.opts.Clock.Now()
+	state := &adaptiveState{
+		limiter:      rate.NewLimiter(rate.Limit(qps), l.opts.Burst),
+		qps:          qps,
+		lastIncrease: now,
+	}
+	l.states[flowSchemaUID] = state
+	return state
+}
+
+func (l *adaptiveRateLimiter) limiterFor(ctx context.Context) *rate.Limiter {
+	flow := l.opts.Classifier(RequestAttributesFrom(ctx))
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.stateLocked(l.flows[flow]).limiter
+}
+
+func (l *adaptiveRateLimiter) TryAccept() bool {
+	return l.limiterFor(context.Background()).AllowN(l.opts.Clock.Now(), 1)
+}
+
+func (l *adaptiveRateLimiter) Accept() {
+	l.Wait(context.Background())
+}
+
+func (l *adaptiveRateLimiter) Wait(ctx context.Context) error {
+	return l.limiterFor(ctx).Wait(ctx)
+}
+
+func (l *adaptiveRateLimiter) Stop() {}
+
+// QPS returns the current rate of requests of unknown FlowSchemas.
+func (l *adaptiveRateLimiter) QPS() float32 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.stateLocked("").qps
+}
+
+func (l *adaptiveRateLimiter) Observe(ctx context.Context, feedback Feedback) {
+	flow := l.opts.Classifier(RequestAttributesFrom(ctx))
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	flowSchemaUID := feedback.Header.Get(FlowSchemaUIDHeader)
+	if len(flowSchemaUID) > 0 {
+		l.flows[flow] = flowSchemaUID
+	} else {
+		flowSchemaUID = l.flows[flow]
+	}
+	state := l.stateLocked(flowSchemaUID)
+	now := l.opts.Clock.Now()
+
+	overloaded := feedback.StatusCode == http.StatusTooManyRequests ||
+		(l.opts.LatencyThreshold > 0 && feedback.Latency > l.opts.LatencyThreshold)
+	switch {
+	case overloaded:
+		if now.Sub(state.lastDecrease) < l.opts.DecreaseInterval {
+			return
+		}
+		state.setQPS(now, state.qps*l.opts.DecreaseFactor, l.opts)
+		state.lastDecrease = now
+		state.lastIncrease = now
+	case feedback.Err == nil && feedback.StatusCode > 0 && feedback.StatusCode < http.StatusInternalServerError:
+		if now.Sub(state.lastIncrease) < l.opts.IncreaseInterval {
+			return
+		}
+		state.setQPS(now, state.qps+l.opts.AdditiveIncrease, l.opts)
+		state.lastIncrease = now
+	}
+}
+
+func (s *adaptiveState) setQPS(now time.Time, qps float32, opts AdaptiveOptions) {
+	if qps < opts.MinQPS {
+		qps = opts.MinQPS
+	}
+	if qps > opts.MaxQPS {
+		qps = opts.MaxQPS
+	}
+	s.qps = qps
+	s.limiter.SetLimitAt(now, rate.Limit(qps))
+}
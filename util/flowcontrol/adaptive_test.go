@@ -0,0 +1,109 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flowcontrol
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	testingclock "k8s.io/utils/clock/testing"
+)
+
+func flowSchemaFeedback(status int, flowSchemaUID string) Feedback {
+	header := http.Header{}
+	if len(flowSchemaUID) > 0 {
+		header.Set(FlowSchemaUIDHeader, flowSchemaUID)
+	}
+	return Feedback{StatusCode: status, Header: header}
+}
+
+func TestAdaptiveRateLimiterAIMD(t *testing.T) {
+	clock := testingclock.NewFakePassiveClock(time.Now())
+	l := NewAdaptiveRateLimiter(10, AdaptiveOptions{MinQPS: 2, MaxQPS: 12, Clock: clock}).(*adaptiveRateLimiter)
+	ctx := context.Background()
+
+	steps := []struct {
+		elapsed  time.Duration
+		feedback Feedback
+		expected float32
+	}{
+		// Increases at most once per interval.
+		{elapsed: 500 * time.Millisecond, feedback: Feedback{StatusCode: http.StatusOK}, expected: 10},
+		{elapsed: 500 * time.Millisecond, feedback: Feedback{StatusCode: http.StatusOK}, expected: 11},
+		{elapsed: time.Second, feedback: Feedback{StatusCode: http.StatusNotFound}, expected: 12},
+		{elapsed: time.Second, feedback: Feedback{StatusCode: http.StatusOK}, expected: 12},
+		// Errors and server errors do not change the rate.
+		{elapsed: time.Second, feedback: Feedback{Err: errors.New("connection refused")}, expected: 12},
+		{elapsed: time.Second, feedback: Feedback{StatusCode: http.StatusInternalServerError}, expected: 12},
+		// Decreases once for a burst of 429s.
+		{elapsed: time.Second, feedback: Feedback{StatusCode: http.StatusTooManyRequests}, expected: 6},
+		{elapsed: 0, feedback: Feedback{StatusCode: http.StatusTooManyRequests}, expected: 6},
+		{elapsed: time.Second, feedback: Feedback{StatusCode: http.StatusTooManyRequests}, expected: 3},
+		{elapsed: time.Second, feedback: Feedback{StatusCode: http.StatusTooManyRequests}, expected: 2},
+		{elapsed: time.Second, feedback: Feedback{StatusCode: http.StatusOK}, expected: 3},
+	}
+	for i, step := range steps {
+		clock.SetTime(clock.Now().Add(step.elapsed))
+		l.Observe(ctx, step.feedback)
+		if qps := l.QPS(); qps != step.expected {
+			t.Fatalf("step %d: expected %v QPS, got %v", i, step.expected, qps)
+		}
+	}
+}
+
+func TestAdaptiveRateLimiterLatency(t *testing.T) {
+	clock := testingclock.NewFakePassiveClock(time.Now())
+	l := NewAdaptiveRateLimiter(10, AdaptiveOptions{LatencyThreshold: time.Second, Clock: clock})
+	l.Observe(context.Background(), Feedback{StatusCode: http.StatusOK, Latency: 2 * time.Second})
+	if qps := l.QPS(); qps != 5 {
+		t.Errorf("expected slow responses to decrease the rate, got %v QPS", qps)
+	}
+}
+
+func TestAdaptiveRateLimiterPerFlowSchema(t *testing.T) {
+	clock := testingclock.NewFakePassiveClock(time.Now())
+	l := NewAdaptiveRateLimiter(10, AdaptiveOptions{Clock: clock}).(*adaptiveRateLimiter)
+	lists := WithRequestAttributes(context.Background(), "GET", "pods")
+	leases := WithRequestAttributes(context.Background(), "PUT", "leases")
+
+	l.Observe(lists, flowSchemaFeedback(http.StatusTooManyRequests, "workload-low"))
+	l.Observe(leases, flowSchemaFeedback(http.StatusOK, "leader-election"))
+
+	qps := func(ctx context.Context) float32 {
+		return float32(l.limiterFor(ctx).Limit())
+	}
+	if got := qps(lists); got != 5 {
+		t.Errorf("expected the throttled FlowSchema to be slowed down, got %v QPS", got)
+	}
+	if got := qps(leases); got != 10 {
+		t.Errorf("expected other FlowSchemas to keep their rate, got %v QPS", got)
+	}
+	if got := l.QPS(); got != 10 {
+		t.Errorf("expected unknown FlowSchemas to keep their rate, got %v QPS", got)
+	}
+
+	// Responses without the header are attributed to the known FlowSchema
+	// of the flow.
+	clock.SetTime(clock.Now().Add(time.Second))
+	l.Observe(lists, flowSchemaFeedback(http.StatusTooManyRequests, ""))
+	if got := qps(lists); got != 2.5 {
+		t.Errorf("expected the FlowSchema of the flow to be slowed down, got %v QPS", got)
+	}
+}
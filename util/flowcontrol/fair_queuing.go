@@ -0,0 +1,422 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flowcontrol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/utils/clock"
+)
+
+// Priority is the priority of a request, used by the fair queuing rate
+// limiter to weigh flows against each other.
+type Priority int
+
+const (
+	// PriorityLow is for background requests, such as periodic resyncs.
+	PriorityLow Priority = iota - 1
+	// PriorityNormal is the priority of requests without an explicit priority.
+	PriorityNormal
+	// PriorityHigh is for requests which should be served before most others.
+	PriorityHigh
+	// PriorityCritical is for requests which must not be starved by other
+	// requests of the client, such as leader election renewals. They are
+	// served before all other requests and may use reserved capacity.
+	PriorityCritical
+)
+
+// RequestAttributes describe a request waiting for a rate limiter.
+type RequestAttributes struct {
+	// Verb is the HTTP method of the request, such as GET or PUT.
+	Verb string
+	// Resource is the resource of the request, if any.
+	Resource string
+	// Priority is the priority of the request.
+	Priority Priority
+}
+
+type requestAttributesKey struct{}
+
+type priorityKey struct{}
+
+// WithRequestAttributes returns a context describing the request it is used
+// for to a rate limiter. It is set by rest.Request before waiting for the
+// rate limiter of the client.
+func WithRequestAttributes(ctx context.Context, verb, resource string) context.Context {
+	return context.WithValue(ctx, requestAttributesKey{}, RequestAttributes{Verb: verb, Resource: resource})
+}
+
+// WithPriority returns a context assigning the given priority to requests
+// made with it.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// RequestAttributesFrom returns the attributes of the request ctx is used
+// for. The priority defaults to PriorityNormal.
+func RequestAttributesFrom(ctx context.Context) RequestAttributes {
+	attributes, _ := ctx.Value(requestAttributesKey{}).(RequestAttributes)
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		attributes.Priority = priority
+	}
+	return attributes
+}
+
+// FlowClassifier returns the name of the flow of a request. Requests of the
+// same flow are served in order, different flows are served fairly.
+type FlowClassifier func(attributes RequestAttributes) string
+
+// ClassifyByVerbAndResource puts requests with the same verb and resource
+// into the same flow. It is the default FlowClassifier.
+func ClassifyByVerbAndResource(attributes RequestAttributes) string {
+	return attributes.Verb + " " + attributes.Resource
+}
+
+// FairQueuingOptions configures a rate limiter created by
+// NewFairQueuingRateLimiter.
+type FairQueuingOptions struct {
+	// Classifier assigns requests to flows. If nil, ClassifyByVerbAndResource
+	// is used. Requests of different priorities are always in different
+	// flows.
+	Classifier FlowClassifier
+	// ReservedQPS and ReservedBurst are the part of the budget reserved
+	// for requests with PriorityCritical. They must either both be zero or
+	// both be positive and lower than the overall budget. Critical requests
+	// may use the remaining budget as well, other requests only the
+	// remaining budget.
+	ReservedQPS   float32
+	ReservedBurst int
+	// Clock is used for waiting, it defaults to the real clock.
+	Clock Clock
+}
+
+// ErrRateLimiterStopped is returned for requests waiting for a stopped rate
+// limiter.
+var ErrRateLimiterStopped = errors.New("rate limiter stopped")
+
+// priorityWeights is the number of requests a flow of a priority may send
+// in its turn of the round robin between flows.
+var priorityWeights = map[Priority]int{
+	PriorityLow:    1,
+	PriorityNormal: 2,
+	PriorityHigh:   4,
+}
+
+// NewFairQueuingRateLimiter returns a rate limiter with an overall budget
+// of qps and burst, shared fairly between flows of requests. As long as
+// tokens are available, requests are admitted immediately. Once the budget
+// is exhausted, requests are queued per flow and the queues are served in
+// weighted round robin order, so a single flow, such as a storm of LIST
+// requests, cannot delay the requests of other flows by more than one turn.
+// Requests with PriorityCritical are served before all other requests and
+// may additionally use the reserved budget of opts.
+//
+// The flow of a request is derived from its context, see
+// WithRequestAttributes and WithPriority. An error is returned if the
+// reserved budget of opts is invalid.
+func NewFairQueuingRateLimiter(qps float32, burst int, opts FairQueuingOptions) (RateLimiter, error) {
+	if err := validateReservedBudget(qps, burst, opts); err != nil {
+		return nil, err
+	}
+	if opts.Classifier == nil {
+		opts.Classifier = ClassifyByVerbAndResource
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.RealClock{}
+	}
+	limiter := &fairQueuingRateLimiter{
+		qps:        qps,
+		shared:     rate.NewLimiter(rate.Limit(qps-opts.ReservedQPS), burst-opts.ReservedBurst),
+		classifier: opts.Classifier,
+		clock:      opts.Clock,
+		flows:      map[flowKey]*flowQueue{},
+		stopCh:     make(chan struct{}),
+	}
+	if opts.ReservedQPS > 0 {
+		limiter.reserved = rate.NewLimiter(rate.Limit(opts.ReservedQPS), opts.ReservedBurst)
+	}
+	return limiter, nil
+}
+
+// validateReservedBudget checks that the reserved budget of opts leaves a
+// positive budget for the other requests and admits critical requests.
+func validateReservedBudget(qps float32, burst int, opts FairQueuingOptions) error {
+	switch {
+	case opts.ReservedQPS == 0 && opts.ReservedBurst == 0:
+		return nil
+	case opts.ReservedQPS <= 0 || opts.ReservedBurst <= 0:
+		return fmt.Errorf("reserved QPS %v and reserved burst %d must either both be zero or both be positive", opts.ReservedQPS, opts.ReservedBurst)
+	case opts.ReservedQPS >= qps:
+		return fmt.Errorf("reserved QPS %v must be lower than QPS %v", opts.ReservedQPS, qps)
+	case opts.ReservedBurst >= burst:
+		return fmt.Errorf("reserved burst %d must be lower than burst %d", opts.ReservedBurst, burst)
+	}
+	return nil
+}
+
+type flowKey struct {
+	name     string
+	priority Priority
+}
+
+type fairQueuingRateLimiter struct {
+	qps        float32
+	shared     *rate.Limiter
+	reserved   *rate.Limiter
+	classifier FlowClassifier
+	clock      Clock
+	stopCh     chan struct{}
+
+	lock  sync.Mutex
+	flows map[flowKey]*flowQueue
+	// critical holds the waiting requests with PriorityCritical.
+	critical []*flowWaiter
+	// active holds the flows with waiting requests in round robin order,
+	// the flow at the front has the current turn.
+	active      []*flowQueue
+	dispatching bool
+	stopped     bool
+}
+
+type flowQueue struct {
+	key     flowKey
+	weight  int
+	credit  int
+	waiters []*flowWaiter
+}
+
+type flowWaiter struct {
+	ready chan struct{}
+	err   error
+}
+
+var _ RateLimiter = &fairQueuingRateLimiter{}
+
+func (l *fairQueuingRateLimiter) QPS() float32 {
+	return l.qps
+}
+
+func (l *fairQueuingRateLimiter) TryAccept() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return !l.stopped && !l.hasWaitersLocked() && l.shared.AllowN(l.clock.Now(), 1)
+}
+
+func (l *fairQueuingRateLimiter) Accept() {
+	l.Wait(context.Background())
+}
+
+func (l *fairQueuingRateLimiter) Wait(ctx context.Context) error {
+	attributes := RequestAttributesFrom(ctx)
+	critical := attributes.Priority >= PriorityCritical
+
+	l.lock.Lock()
+	if l.stopped {
+		l.lock.Unlock()
+		return ErrRateLimiterStopped
+	}
+	now := l.clock.Now()
+	if critical && l.reserved != nil && l.reserved.AllowN(now, 1) {
+		l.lock.Unlock()
+		return nil
+	}
+	// Requests may only skip the queues if nobody is waiting, otherwise
+	// they would take the tokens the queued requests are waiting for.
+	if !l.hasWaitersLocked() && l.shared.AllowN(now, 1) {
+		l.lock.Unlock()
+		return nil
+	}
+	w := &flowWaiter{ready: make(chan struct{})}
+	if critical {
+		l.critical = append(l.critical, w)
+	} else {
+		l.enqueueLocked(attributes, w)
+	}
+	if !l.dispatching {
+		l.dispatching = true
+		go l.dispatch()
+	}
+	l.lock.Unlock()
+
+	select {
+	case <-w.ready:
+		return w.err
+	case <-ctx.Done():
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.removeLocked(w) {
+		return ctx.Err()
+	}
+	// The request was admitted concurrently.
+	return w.err
+}
+
+func (l *fairQueuingRateLimiter) Stop() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.stopped {
+		return
+	}
+	l.stopped = true
+	close(l.stopCh)
+	for _, w := range l.critical {
+		w.err = ErrRateLimiterStopped
+		close(w.ready)
+	}
+	l.critical = nil
+	for _, flow := range l.active {
+		for _, w := range flow.waiters {
+			w.err = ErrRateLimiterStopped
+			close(w.ready)
+		}
+		delete(l.flows, flow.key)
+	}
+	l.active = nil
+}
+
+func (l *fairQueuingRateLimiter) hasWaitersLocked() bool {
+	return len(l.critical) > 0 || len(l.active) > 0
+}
+
+func (l *fairQueuingRateLimiter) enqueueLocked(attributes RequestAttributes, w *flowWaiter) {
+	key := flowKey{name: l.classifier(attributes), priority: attributes.Priority}
+	flow, ok := l.flows[key]
+	if !ok {
+		weight, ok := priorityWeights[attributes.Priority]
+		if !ok {
+			weight = priorityWeights[PriorityLow]
+		}
+		flow = &flowQueue{key: key, weight: weight, credit: weight}
+		l.flows[key] = flow
+		l.active = append(l.active, flow)
+	}
+	flow.waiters = append(flow.waiters, w)
+}
+
+// removeLocked removes a waiter which gave up and reports whether it was
+// still waiting.
+func (l *fairQueuingRateLimiter) removeLocked(w *flowWaiter) bool {
+	for i := range l.critical {
+		if l.critical[i] == w {
+			l.critical = append(l.critical[:i], l.critical[i+1:]...)
+			return true
+		}
+	}
+	for i, flow := range l.active {
+		for j := range flow.waiters {
+			if flow.waiters[j] != w {
+				continue
+			}
+			flow.waiters = append(flow.waiters[:j], flow.waiters[j+1:]...)
+			if len(flow.waiters) == 0 {
+				l.active = append(l.active[:i], l.active[i+1:]...)
+				delete(l.flows, flow.key)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// nextLocked dequeues the waiter to be admitted next: critical requests
+// first, then the flows in weighted round robin order.
+func (l *fairQueuingRateLimiter) nextLocked() *flowWaiter {
+	if len(l.critical) > 0 {
+		w := l.critical[0]
+		l.critical = l.critical[1:]
+		return w
+	}
+	if len(l.active) == 0 {
+		return nil
+	}
+	flow := l.active[0]
+	w := flow.waiters[0]
+	flow.waiters = flow.waiters[1:]
+	flow.credit--
+	switch {
+	case len(flow.waiters) == 0:
+		l.active = l.active[1:]
+		delete(l.flows, flow.key)
+	case flow.credit == 0:
+		// The turn of the flow is over, move it to the back.
+		flow.credit = flow.weight
+		l.active = append(l.active[1:], flow)
+	}
+	return w
+}
+
+// dispatch admits the queued requests one by one as tokens become
+// available. It runs while requests are waiting.
+func (l *fairQueuingRateLimiter) dispatch() {
+	for {
+		l.lock.Lock()
+		// Critical requests queued while the reserved budget was exhausted
+		// do not need to wait for the shared budget once it refilled.
+		for len(l.critical) > 0 && l.reserved != nil && l.reserved.AllowN(l.clock.Now(), 1) {
+			close(l.critical[0].ready)
+			l.critical = l.critical[1:]
+		}
+		l.lock.Unlock()
+
+		now := l.clock.Now()
+		reservation := l.shared.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			if !l.sleep(delay) {
+				reservation.Cancel()
+				return
+			}
+		}
+
+		l.lock.Lock()
+		w := l.nextLocked()
+		if w == nil || l.stopped {
+			l.dispatching = false
+			l.lock.Unlock()
+			reservation.CancelAt(l.clock.Now())
+			return
+		}
+		close(w.ready)
+		if !l.hasWaitersLocked() {
+			l.dispatching = false
+			l.lock.Unlock()
+			return
+		}
+		l.lock.Unlock()
+	}
+}
+
+// sleep waits for the given duration and reports whether the rate limiter
+// is still running afterwards.
+func (l *fairQueuingRateLimiter) sleep(d time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		l.clock.Sleep(d)
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-l.stopCh:
+		return false
+	}
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flowcontrol
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newFairQueuing(t *testing.T, qps float32, burst int, opts FairQueuingOptions) *fairQueuingRateLimiter {
+	t.Helper()
+	l, err := NewFairQueuingRateLimiter(qps, burst, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l.(*fairQueuingRateLimiter)
+}
+
+// waitForQueued waits until the given number of requests is queued.
+func waitForQueued(t *testing.T, l *fairQueuingRateLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		l.lock.Lock()
+		queued := len(l.critical)
+		for _, flow := range l.active {
+			queued += len(flow.waiters)
+		}
+		l.lock.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued requests", n)
+}
+
+func TestFairQueuingBetweenFlows(t *testing.T) {
+	l := newFairQueuing(t, 200, 1, FairQueuingOptions{})
+	defer l.Stop()
+	if !l.TryAccept() {
+		t.Fatal("expected the burst to be available")
+	}
+
+	admitted := make(chan string, 20)
+	wait := func(verb, resource string) {
+		if err := l.Wait(WithRequestAttributes(context.Background(), verb, resource)); err != nil {
+			t.Error(err)
+		}
+		admitted <- verb + " " + resource
+	}
+	const storm = 10
+	for i := 0; i < storm; i++ {
+		go wait("GET", "pods")
+	}
+	waitForQueued(t, l, storm)
+	go wait("PUT", "leases")
+
+	position := -1
+	for i := 0; i < storm+1; i++ {
+		if flow := <-admitted; flow == "PUT leases" {
+			position = i
+		}
+	}
+	// The pods flow may send two requests in its turn, the leases flow must
+	// be served right after.
+	if position < 0 || position > 2 {
+		t.Errorf("expected the leases request to be served within one turn, it was request %d", position)
+	}
+}
+
+func TestFairQueuingCriticalPriority(t *testing.T) {
+	l := newFairQueuing(t, 2, 2, FairQueuingOptions{ReservedQPS: 1, ReservedBurst: 1})
+	defer l.Stop()
+	if !l.TryAccept() {
+		t.Fatal("expected the shared burst to be available")
+	}
+	if l.TryAccept() {
+		t.Fatal("expected the reserved burst not to be available to other requests")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(WithRequestAttributes(ctx, "GET", "pods")); err == nil {
+		t.Errorf("expected a normal request to wait for the shared budget")
+	}
+	waitForQueued(t, l, 0)
+
+	critical := WithPriority(WithRequestAttributes(context.Background(), "PUT", "leases"), PriorityCritical)
+	start := time.Now()
+	if err := l.Wait(critical); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("expected the critical request to use the reserved budget, it waited %v", elapsed)
+	}
+}
+
+func TestFairQueuingStop(t *testing.T) {
+	l := newFairQueuing(t, 0.001, 1, FairQueuingOptions{})
+	l.Accept()
+	result := make(chan error)
+	go func() {
+		result <- l.Wait(context.Background())
+	}()
+	waitForQueued(t, l, 1)
+	l.Stop()
+	if err := <-result; !errors.Is(err, ErrRateLimiterStopped) {
+		t.Errorf("expected ErrRateLimiterStopped, got %v", err)
+	}
+	if err := l.Wait(context.Background()); !errors.Is(err, ErrRateLimiterStopped) {
+		t.Errorf("expected ErrRateLimiterStopped, got %v", err)
+	}
+}
+
+func TestFairQueuingReservedBudgetValidation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		opts    FairQueuingOptions
+		wantErr bool
+	}{
+		{name: "no reserved budget", opts: FairQueuingOptions{}},
+		{name: "valid reserved budget", opts: FairQueuingOptions{ReservedQPS: 1, ReservedBurst: 2}},
+		{name: "reserved QPS without burst", opts: FairQueuingOptions{ReservedQPS: 1}, wantErr: true},
+		{name: "reserved burst without QPS", opts: FairQueuingOptions{ReservedBurst: 1}, wantErr: true},
+		{name: "negative reserved QPS", opts: FairQueuingOptions{ReservedQPS: -1, ReservedBurst: 1}, wantErr: true},
+		{name: "reserved QPS not lower than QPS", opts: FairQueuingOptions{ReservedQPS: 5, ReservedBurst: 1}, wantErr: true},
+		{name: "reserved burst not lower than burst", opts: FairQueuingOptions{ReservedQPS: 1, ReservedBurst: 10}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := NewFairQueuingRateLimiter(5, 10, tc.opts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expected error %v, got %v", tc.wantErr, err)
+			}
+			if l != nil {
+				l.Stop()
+			}
+		})
+	}
+}
+
+func TestRequestAttributesFrom(t *testing.T) {
+	if attributes := RequestAttributesFrom(context.Background()); attributes != (RequestAttributes{}) {
+		t.Errorf("expected empty attributes, got %#v", attributes)
+	}
+	ctx := WithPriority(context.Background(), PriorityLow)
+	ctx = WithRequestAttributes(ctx, "GET", "pods")
+	expected := RequestAttributes{Verb: "GET", Resource: "pods", Priority: PriorityLow}
+	if attributes := RequestAttributesFrom(ctx); attributes != expected {
+		t.Errorf("expected %#v, got %#v", expected, attributes)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"context"
+	"sync"
+
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+)
+
+// ProcessItemFunc processes a single item taken from a queue. The queue's
+// Done is called for the item once the function returns.
+type ProcessItemFunc func(ctx context.Context, item interface{})
+
+// RunWorkersWithContext starts the given number of workers, each of which gets
+// items from q and passes them to process until q is shut down. q is shut down
+// when ctx is done, after which RunWorkersWithContext waits for the workers to
+// finish the items they are processing before returning.
+//
+// Each worker passes process a context whose logger is the logger of ctx with
+// a "worker" key added, so that log output can be attributed to a worker.
+func RunWorkersWithContext(ctx context.Context, q Interface, workers int, process ProcessItemFunc) {
+	logger := klog.FromContext(ctx)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			q.ShutDown()
+		case <-done:
+			// q was shut down elsewhere.
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		workerCtx := klog.NewContext(ctx, klog.LoggerWithValues(logger, "worker", i))
+		go func() {
+			defer utilruntime.HandleCrash()
+			defer wg.Done()
+			for processNextItem(workerCtx, q, process) {
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// processNextItem processes one item of q and returns false once q is shut
+// down.
+func processNextItem(ctx context.Context, q Interface, process ProcessItemFunc) bool {
+	item, shutdown := q.Get()
+	if shutdown {
+		return false
+	}
+	defer q.Done(item)
+	process(ctx, item)
+	return true
+}
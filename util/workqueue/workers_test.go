@@ -0,0 +1,80 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package workqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestRunWorkersWithContext(t *testing.T) {
+	q := New()
+	for i := 0; i < 10; i++ {
+		q.Add(i)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var lock sync.Mutex
+	processed := map[interface{}]bool{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunWorkersWithContext(ctx, q, 3, func(ctx context.Context, item interface{}) {
+			lock.Lock()
+			defer lock.Unlock()
+			processed[item] = true
+			if len(processed) == 10 {
+				cancel()
+			}
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("workers did not stop after the context was cancelled")
+	}
+	if len(processed) != 10 {
+		t.Errorf("expected 10 items to be processed, got %d", len(processed))
+	}
+	if !q.ShuttingDown() {
+		t.Errorf("expected queue to be shut down")
+	}
+	if q.Len() != 0 {
+		t.Errorf("expected queue to be drained, got %d items", q.Len())
+	}
+}
+
+func TestRunWorkersWithContextQueueShutDown(t *testing.T) {
+	q := New()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunWorkersWithContext(context.Background(), q, 2, func(ctx context.Context, item interface{}) {})
+	}()
+	q.ShutDown()
+
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatal("workers did not stop after the queue was shut down")
+	}
+}